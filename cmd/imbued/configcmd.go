@@ -0,0 +1,359 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+
+	"github.com/novacove/imbued/pkg/config"
+	"github.com/novacove/imbued/pkg/trust"
+	"github.com/spf13/cobra"
+)
+
+// Exit statuses of imbued config lint
+const (
+	exitLintIssues = 1 // Errors were found, or warnings with --strict
+	exitLintFailed = 2 // The config couldn't be linted
+)
+
+// newConfigCmd creates the config command group, which works on .imbued
+// files and the global config locally without the server
+func newConfigCmd() *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Commands for working with .imbued files and the global config",
+	}
+
+	// Create keygen command
+	var keyPath string
+	keygenCmd := &cobra.Command{
+		Use:   "keygen",
+		Short: "Generate a signing key for .imbued files",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := signingKeyPath(keyPath)
+			if err != nil {
+				return err
+			}
+
+			publicKey, err := trust.GenerateSigningKey(path)
+			if err != nil {
+				return err
+			}
+
+			name := "imbued"
+			if current, err := user.Current(); err == nil {
+				name = current.Username
+			}
+			if hostname, err := os.Hostname(); err == nil {
+				name += "@" + hostname
+			}
+
+			fmt.Printf("Signing key written to %s\n", path)
+			fmt.Println("Share this line with your team to add to their ~/.imbued/trusted_keys:")
+			fmt.Printf("%s %s\n", publicKey, name)
+			return nil
+		},
+	}
+	keygenCmd.Flags().StringVar(&keyPath, "key", "", "Path of the signing key (default: ~/.imbued/signing_key)")
+
+	// Create sign command
+	signCmd := &cobra.Command{
+		Use:   "sign [path]",
+		Short: "Sign a .imbued file with your signing key",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configFilePath, err := localConfigPathArg(args)
+			if err != nil {
+				return err
+			}
+
+			path, err := signingKeyPath(keyPath)
+			if err != nil {
+				return err
+			}
+
+			privateKey, err := trust.LoadSigningKey(path)
+			if err != nil {
+				return err
+			}
+
+			projectPath, err := config.ProjectPath(configFilePath)
+			if err != nil {
+				return err
+			}
+			if err := trust.Sign(configFilePath, projectPath, privateKey); err != nil {
+				return err
+			}
+
+			fmt.Printf("Signed %s, commit %s%s along with it\n", configFilePath, configFilePath, trust.SignatureSuffix)
+			return nil
+		},
+	}
+	signCmd.Flags().StringVar(&keyPath, "key", "", "Path of the signing key (default: ~/.imbued/signing_key)")
+
+	// Create verify command
+	verifyCmd := &cobra.Command{
+		Use:   "verify [path]",
+		Short: "Verify the signatures of a .imbued file and the files it inherits from",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configFilePath, err := localConfigPathArg(args)
+			if err != nil {
+				return err
+			}
+
+			sources, err := config.Sources(configFilePath)
+			if err != nil {
+				return err
+			}
+
+			trustedKeysPath, err := getTrustedKeysPath()
+			if err != nil {
+				return err
+			}
+			keys, err := trust.LoadTrustedKeys(trustedKeysPath)
+			if err != nil {
+				return err
+			}
+
+			verified := true
+			for _, source := range sources {
+				signer, err := verifySignature(source, keys)
+				if err != nil {
+					fmt.Printf("%s: %v\n", source, err)
+					verified = false
+					continue
+				}
+				fmt.Printf("%s: signed by %s\n", source, signerName(signer))
+			}
+
+			if !verified {
+				return fmt.Errorf("%s is not signed by a trusted key", configFilePath)
+			}
+
+			// The server only honors signatures in projects the user allowed
+			trustStorePath, err := getTrustStorePath()
+			if err != nil {
+				return err
+			}
+			root, err := config.ProjectRoot(configFilePath)
+			if err != nil {
+				return err
+			}
+			if allowed, err := trust.NewStore(trustStorePath).ProjectAllowed(root); err != nil {
+				return err
+			} else if !allowed {
+				fmt.Printf("Signatures in %s aren't trusted until you allow one of its configs with `imbued allow`\n", root)
+			}
+			return nil
+		},
+	}
+
+	// Create lint command
+	var strict bool
+	lintCmd := &cobra.Command{
+		Use:   "lint [path]",
+		Short: "Check a .imbued file and the files it inherits from for mistakes",
+		Long: `Check a .imbued file and the files it inherits from for mistakes.
+
+Exits with status 0 if no errors were found, 1 if there were errors (or
+warnings, with --strict), and 2 if the config couldn't be linted at all.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			configFilePath, err := localConfigPathArg(args)
+			if err == nil {
+				_, err = os.Stat(configFilePath)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitLintFailed)
+			}
+
+			var errorCount, warningCount int
+			for _, issue := range config.Lint(configFilePath, globalConfig.Defaults()) {
+				fmt.Println(issue)
+				if issue.Severity == config.SeverityError {
+					errorCount++
+				} else {
+					warningCount++
+				}
+			}
+
+			if errorCount == 0 && warningCount == 0 {
+				fmt.Printf("%s: no issues found\n", configFilePath)
+				return
+			}
+
+			fmt.Printf("%d error(s), %d warning(s)\n", errorCount, warningCount)
+			if errorCount > 0 || strict {
+				os.Exit(exitLintIssues)
+			}
+		},
+	}
+	lintCmd.Flags().BoolVar(&strict, "strict", false, "Exit with status 1 on warnings too")
+
+	// Create schema command
+	var schemaOutput string
+	schemaCmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of .imbued files, for editors and TOML language servers",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := config.JSONSchema()
+			if err != nil {
+				return fmt.Errorf("failed to generate schema: %v", err)
+			}
+			data = append(data, '\n')
+
+			if schemaOutput == "" {
+				_, err = os.Stdout.Write(data)
+				return err
+			}
+
+			if err := os.WriteFile(schemaOutput, data, 0644); err != nil {
+				return fmt.Errorf("failed to write schema: %v", err)
+			}
+			fmt.Printf("Schema written to %s\n", schemaOutput)
+			return nil
+		},
+	}
+	schemaCmd.Flags().StringVarP(&schemaOutput, "output", "o", "", "File to write the schema to (default: stdout)")
+
+	// Create migrate command
+	var dryRun bool
+	migrateCmd := &cobra.Command{
+		Use:   "migrate [path]",
+		Short: "Update a .imbued file to the current format version",
+		Long: fmt.Sprintf(`Update a .imbued file to format version %d.
+
+Secrets written as a plain string become structured entries, and backend
+credentials written in plain text are moved to the keychain and referenced
+from the file. Comments and layout are kept. Files the config inherits from
+or includes are migrated separately.`, config.CurrentVersion),
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configFilePath, err := localConfigPathArg(args)
+			if err != nil {
+				return err
+			}
+
+			migration, err := config.Migrate(configFilePath)
+			if err != nil {
+				return err
+			}
+
+			if len(migration.Changes) == 0 {
+				fmt.Printf("%s is already at format version %d\n", configFilePath, config.CurrentVersion)
+			} else {
+				for _, change := range migration.Changes {
+					fmt.Printf("%s: %s\n", configFilePath, change)
+				}
+
+				if dryRun {
+					fmt.Println("Dry run, nothing was written. The migrated file would be:")
+					fmt.Println()
+					os.Stdout.Write(migration.Data)
+				} else {
+					if err := migration.Write(); err != nil {
+						return err
+					}
+					fmt.Printf("Migrated %s to format version %d\n", configFilePath, config.CurrentVersion)
+					fmt.Println("Its content changed: run `imbued allow` again, and `imbued config sign` if it is signed")
+				}
+			}
+
+			// Files the config inherits from or includes are left to their owners
+			sources, err := config.Sources(configFilePath)
+			if err != nil {
+				return err
+			}
+			for _, source := range sources[:len(sources)-1] {
+				if parent, err := config.Migrate(source); err == nil && len(parent.Changes) > 0 {
+					fmt.Printf("%s, which this config inherits from or includes, is outdated too: run `imbued config migrate %s`\n", source, source)
+				}
+			}
+
+			return nil
+		},
+	}
+	migrateCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the changes and the migrated file without writing anything")
+
+	// Create show command
+	var effective bool
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Show the global config of imbued",
+		Long: `Show the global config of imbued, read from imbued/config.toml in
+$XDG_CONFIG_HOME (~/.config by default) or $XDG_CONFIG_DIRS.
+
+With --effective, show the settings in effect once the defaults, the global
+config and the command line flags are merged, and where each comes from.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if effective {
+				printEffectiveConfig(cmd)
+				return nil
+			}
+
+			if globalConfig.Path == "" {
+				path, err := config.GlobalConfigPath()
+				if err != nil {
+					return err
+				}
+				fmt.Printf("No global config at %s, using the defaults (see --effective)\n", path)
+				return nil
+			}
+
+			data, err := os.ReadFile(globalConfig.Path)
+			if err != nil {
+				return fmt.Errorf("failed to read global config: %v", err)
+			}
+			fmt.Printf("# %s\n", globalConfig.Path)
+			_, err = os.Stdout.Write(data)
+			return err
+		},
+	}
+	showCmd.Flags().BoolVar(&effective, "effective", false, "Show the merged settings in effect instead of the file")
+
+	configCmd.AddCommand(keygenCmd)
+	configCmd.AddCommand(signCmd)
+	configCmd.AddCommand(verifyCmd)
+	configCmd.AddCommand(lintCmd)
+	configCmd.AddCommand(schemaCmd)
+	configCmd.AddCommand(migrateCmd)
+	configCmd.AddCommand(showCmd)
+
+	return configCmd
+}
+
+// signingKeyPath returns the signing key path given by a flag, or the default one
+func signingKeyPath(flag string) (string, error) {
+	if flag != "" {
+		return flag, nil
+	}
+	return getSigningKeyPath()
+}
+
+// localConfigPathArg returns the config named by an optional path argument,
+// searching the current and parent directories without the server otherwise
+func localConfigPathArg(args []string) (string, error) {
+	if len(args) > 0 || configPath != "" {
+		if len(args) == 0 {
+			args = []string{configPath}
+		}
+		return configPathArg(args)
+	}
+
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %v", err)
+	}
+	return config.FindConfig(currentDir, maxLevels)
+}
+
+// signerName returns a printable name of a trusted key
+func signerName(key trust.TrustedKey) string {
+	if key.Name != "" {
+		return key.Name
+	}
+	return "an unnamed trusted key"
+}
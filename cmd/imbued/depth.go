@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/novacove/imbued/pkg/config"
+)
+
+// codeOutsideValidDepth is the response code of commands refused because the
+// client's working directory is deeper below the config than its valid_depth
+const codeOutsideValidDepth = "outside_valid_depth"
+
+// exitOutsideValidDepth is the exit status of client commands refused with
+// codeOutsideValidDepth, so that shells know to clean up the config's variables
+const exitOutsideValidDepth = 3
+
+// commandDepth returns how many directories the client's working directory
+// is below the directory of its config, or -1 if it is outside of it
+func commandDepth(cmd Command) (int, error) {
+	if cmd.CurrentDir == "" {
+		return 0, fmt.Errorf("the client didn't send its working directory")
+	}
+	return config.DirDepth(config.GetConfigDir(cmd.ConfigPath), cmd.CurrentDir)
+}
+
+// withinDepth reports whether a client at the given depth may be served
+// values limited to validDepth
+func withinDepth(depth, validDepth int) bool {
+	return depth >= 0 && depth <= validDepth
+}
+
+// depthError explains why a client at the given depth is refused values
+// limited to validDepth
+func depthError(cmd Command, depth, validDepth int) string {
+	configDir := config.GetConfigDir(cmd.ConfigPath)
+	if depth < 0 {
+		return fmt.Sprintf("%s is outside of %s", cmd.CurrentDir, configDir)
+	}
+	return fmt.Sprintf("%s is %d directories below %s, deeper than the valid_depth of %d", cmd.CurrentDir, depth, configDir, validDepth)
+}
+
+// checkDepth sends an error response and returns false if the client is
+// deeper below its config than validDepth
+func checkDepth(conn net.Conn, cmd Command, validDepth int) (int, bool) {
+	depth, err := commandDepth(cmd)
+	if err != nil {
+		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to check depth: %v", err)})
+		return 0, false
+	}
+
+	if !withinDepth(depth, validDepth) {
+		sendResponse(conn, Response{Success: false, Error: depthError(cmd, depth, validDepth), Code: codeOutsideValidDepth})
+		return depth, false
+	}
+
+	return depth, true
+}
+
+// handleCheckDepth handles the check_depth command. It reports which values
+// of the config are available in the client's directory, so that shells can
+// tell when moving between directories changes them.
+func handleCheckDepth(conn net.Conn, cmd Command) {
+	// Load config
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to load config: %v", err)})
+		return
+	}
+
+	depth, ok := checkDepth(conn, cmd, cfg.MaxValidDepth())
+	if !ok {
+		return
+	}
+
+	sendResponse(conn, Response{
+		Success: true,
+		Data: map[string]string{
+			"depth":   fmt.Sprintf("%d", depth),
+			"secrets": strings.Join(cfg.SecretNamesAt(depth), ","),
+			"values":  fmt.Sprintf("%t", depth <= cfg.ValidDepth),
+		},
+	})
+}
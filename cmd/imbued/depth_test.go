@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckDepth(t *testing.T) {
+	server := startTestServer(t)
+
+	root := t.TempDir()
+	project := filepath.Join(root, "project")
+	if err := os.MkdirAll(filepath.Join(project, "a", "b", "c"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(project, ".imbued")
+	data := `backend_type = "env_file"
+valid_depth = 1
+
+[secrets]
+API_KEY = "API_KEY"
+DEEP_KEY = { valid_depth = 2 }
+`
+	if err := os.WriteFile(configPath, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	server.allow(t, configPath)
+
+	tests := []struct {
+		dir    string // Relative to the project
+		status int
+		output string
+	}{
+		{dir: ".", output: "depth: 0, secrets: API_KEY,DEEP_KEY, plain values: true"},
+		{dir: "a", output: "depth: 1, secrets: API_KEY,DEEP_KEY, plain values: true"},
+		{dir: "a/b", output: "depth: 2, secrets: DEEP_KEY, plain values: false"},
+		{dir: "a/b/c", status: exitOutsideValidDepth, output: "3 directories below " + project + ", deeper than the valid_depth of 2"},
+		{dir: "..", status: exitOutsideValidDepth, output: root + " is outside of " + project},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			output, status := server.runImbued(t, filepath.Join(project, tt.dir), "client", "check-depth", "--config", configPath)
+			if status != tt.status || !strings.Contains(output, tt.output) {
+				t.Errorf("check-depth exited with %d: %q, want %d: %q", status, output, tt.status, tt.output)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sourceBashHook sources the bash integration in dir, against the server,
+// and returns its combined output
+func (s *testServer) sourceBashHook(t *testing.T, dir string) string {
+	t.Helper()
+
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not installed")
+	}
+	script, err := filepath.Abs(filepath.Join("..", "..", "scripts", "bash", "imbued.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(bash, "-c", `source "$1"`, "bash", script)
+	cmd.Dir = dir
+	cmd.Env = append(s.environ(), "IMBUED_BIN="+os.Args[0], "IMBUED_SOCKET="+s.socketPath)
+	output, _ := run(t, cmd)
+	return output
+}
+
+func TestBashHook(t *testing.T) {
+	server := startTestServer(t)
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, ".imbued")
+	data := `version = 2
+[env]
+APP_ENV = "development"
+`
+	if err := os.WriteFile(configPath, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Configs that aren't allowed yet are found, and the hook says how to
+	// allow them
+	output := server.sourceBashHook(t, dir)
+	if !strings.Contains(output, "is not allowed yet") || strings.Contains(output, "No .imbued file found") {
+		t.Errorf("hook of an untrusted config printed:\n%s", output)
+	}
+	if strings.Contains(output, "Setting APP_ENV") {
+		t.Errorf("hook set the variables of an untrusted config:\n%s", output)
+	}
+
+	server.allow(t, configPath)
+	if output := server.sourceBashHook(t, dir); !strings.Contains(output, "Setting APP_ENV to development") {
+		t.Errorf("hook of an allowed config printed:\n%s", output)
+	}
+
+	// Directories without a config are told apart from untrusted configs
+	if output := server.sourceBashHook(t, t.TempDir()); !strings.Contains(output, "No .imbued file found") {
+		t.Errorf("hook without a config printed:\n%s", output)
+	}
+}
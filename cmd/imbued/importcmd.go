@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/novacove/imbued/pkg/config"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// What to do with the plaintext files an import read values from
+const (
+	sourceKeep      = "keep"
+	sourceDelete    = "delete"
+	sourceGitignore = "gitignore"
+)
+
+// prefixUnsafe matches the characters of a directory name left out of the
+// default secret prefix
+var prefixUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// defaultSecretPrefix returns the prefix of the secrets created for the
+// project in dir, so that projects sharing a backend don't overwrite each
+// other's values
+func defaultSecretPrefix(dir string) string {
+	return prefixUnsafe.ReplaceAllString(filepath.Base(dir), "_") + "_"
+}
+
+// newImportCmd creates the import command, which moves the variables of
+// dotenv, direnv, op template and docker-compose files into a config
+func newImportCmd() *cobra.Command {
+	var (
+		backendType string
+		backendName string
+		prefix      string
+		sources     string
+		dryRun      bool
+	)
+
+	importCmd := &cobra.Command{
+		Use:   "import [file...]",
+		Short: "Import the variables of .env, .envrc, op templates and docker-compose files",
+		Long: `Import the variables of existing files into the .imbued file of the
+current directory, creating it if needed.
+
+Reads .env files (KEY=VALUE lines), the export lines of direnv's .envrc,
+1Password templates such as .env.tpl whose values are op:// references, and
+the env_file entries of docker-compose files. Without arguments, the files
+of the current directory with these names are read: ` + strings.Join(config.ImportFileNames, ", ") + `.
+
+Values are stored in the config's backend, or the one given with --backend,
+as secrets named after their variable with --prefix in front. 1Password
+references aren't copied: they become secrets of a onepass backend. Values
+using shell expansion are skipped and reported.
+
+The files holding the values in plain text can then be deleted or added to
+.gitignore, see --sources.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			currentDir, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get current directory: %v", err)
+			}
+
+			target := configPath
+			if target == "" {
+				if target, err = config.ConfigInDir(currentDir); err != nil {
+					return err
+				}
+				if target == "" {
+					target = filepath.Join(currentDir, ".imbued")
+				}
+			}
+
+			files := args
+			if len(files) == 0 {
+				if files = config.ImportFiles(currentDir); len(files) == 0 {
+					return fmt.Errorf("nothing to import: none of %s is in %s", strings.Join(config.ImportFileNames, ", "), currentDir)
+				}
+			}
+
+			if !cmd.Flags().Changed("prefix") {
+				prefix = defaultSecretPrefix(filepath.Dir(target))
+			}
+
+			switch sources {
+			case "", sourceKeep, sourceDelete, sourceGitignore:
+			default:
+				return fmt.Errorf("invalid --sources %q (expected %s, %s or %s)", sources, sourceKeep, sourceDelete, sourceGitignore)
+			}
+
+			imp, err := config.ImportVariables(target, files, config.ImportOptions{
+				BackendType: backendType,
+				Backend:     backendName,
+				Prefix:      prefix,
+				Defaults:    globalConfig.Defaults(),
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, warning := range imp.Warnings {
+				fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+			}
+			if len(imp.Secrets) == 0 {
+				fmt.Println("No variables to import")
+				return nil
+			}
+			for _, name := range imp.SortedSecrets() {
+				fmt.Printf("%s -> secret %s\n", imp.Secrets[name], name)
+			}
+
+			if dryRun {
+				fmt.Printf("Dry run, nothing was stored or written. %s would be:\n\n", target)
+				os.Stdout.Write(imp.Data)
+				return nil
+			}
+
+			if err := imp.Write(context.Background()); err != nil {
+				return err
+			}
+			if backend := imp.BackendType(); backend != "" {
+				fmt.Printf("Stored the values in the %s backend\n", backend)
+			}
+			if imp.Create {
+				fmt.Printf("Created %s: review it, then run `imbued allow`\n", target)
+			} else {
+				fmt.Printf("Updated %s: its content changed, run `imbued allow` again, and `imbued config sign` if it is signed\n", target)
+			}
+
+			return handleImportedFiles(imp, filepath.Dir(target), sources)
+		},
+	}
+	importCmd.Flags().StringVar(&backendType, "backend-type", "", "Backend type of the .imbued file to create (default: defaults.backend_type of the global config)")
+	importCmd.Flags().StringVar(&backendName, "backend", "", "Backend of the existing .imbued file to store the values in (default: its default backend)")
+	importCmd.Flags().StringVar(&prefix, "prefix", "", "Prefix of the secret names (default: the project directory's name and _)")
+	importCmd.Flags().StringVar(&sources, "sources", "", "What to do with the files holding the values in plain text: keep, delete or gitignore (default: ask)")
+	importCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the secrets and the resulting .imbued file without storing or writing anything")
+
+	return importCmd
+}
+
+// handleImportedFiles deletes the plaintext files an import read values
+// from, or adds them to the .gitignore of dir, as chosen or asked
+func handleImportedFiles(imp *config.Import, dir, choice string) error {
+	interactive := term.IsTerminal(int(os.Stdin.Fd()))
+	reader := bufio.NewReader(os.Stdin)
+
+	for _, file := range imp.Files {
+		if !file.Plaintext {
+			continue
+		}
+
+		action := choice
+		if action == "" && interactive {
+			fmt.Printf("%s holds the imported values in plain text. [d]elete it, add it to .[g]itignore, or [k]eep it? [k] ", file.Path)
+			answer, _ := reader.ReadString('\n')
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "d", "delete":
+				action = sourceDelete
+			case "g", "gitignore":
+				action = sourceGitignore
+			}
+		}
+
+		switch action {
+		case sourceDelete:
+			if !file.Complete {
+				fmt.Printf("Kept %s: some of its lines weren't imported\n", file.Path)
+				continue
+			}
+			if err := os.Remove(file.Path); err != nil {
+				return fmt.Errorf("failed to delete %s: %v", file.Path, err)
+			}
+			fmt.Printf("Deleted %s\n", file.Path)
+		case sourceGitignore:
+			added, err := gitignore(dir, file.Path)
+			if err != nil {
+				return err
+			}
+			if added {
+				fmt.Printf("Added %s to %s\n", file.Path, filepath.Join(dir, ".gitignore"))
+			}
+		default:
+			fmt.Printf("Kept %s, which still holds the values in plain text\n", file.Path)
+		}
+	}
+
+	return nil
+}
+
+// gitignore adds path to the .gitignore of dir, unless it is already listed,
+// and reports whether it was added
+func gitignore(dir, path string) (bool, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, fmt.Errorf("failed to get absolute path: %v", err)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to get absolute path: %v", err)
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false, fmt.Errorf("can't add %s to %s/.gitignore: it is outside of the project", path, dir)
+	}
+	pattern := "/" + filepath.ToSlash(rel)
+
+	ignorePath := filepath.Join(absDir, ".gitignore")
+	data, err := os.ReadFile(ignorePath)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read %s: %v", ignorePath, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == pattern || line == filepath.ToSlash(rel) {
+			return false, nil
+		}
+	}
+
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		data = append(data, '\n')
+	}
+	data = append(data, pattern+"\n"...)
+	if err := os.WriteFile(ignorePath, data, 0644); err != nil {
+		return false, fmt.Errorf("failed to write %s: %v", ignorePath, err)
+	}
+	return true, nil
+}
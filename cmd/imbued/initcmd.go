@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/novacove/imbued/pkg/auth"
+	"github.com/novacove/imbued/pkg/config"
+	"github.com/novacove/imbued/pkg/secrets"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// newInitCmd creates the init command, which walks through creating the
+// .imbued file of a project
+func newInitCmd() *cobra.Command {
+	var (
+		backendType string
+		envNames    []string
+		prefix      string
+		storeValues bool
+		allow       bool
+	)
+
+	initCmd := &cobra.Command{
+		Use:   "init",
+		Short: "Create the .imbued file of the current directory interactively",
+		Long: `Create the .imbued file of the current directory.
+
+Looks for the secret stores available on this machine (macOS Keychain,
+1Password's op CLI, Vault from VAULT_ADDR and VAULT_TOKEN, and reports
+Secret Service and pass, which have no backend yet), then asks for the
+backend and the environment variables the project needs, and writes a
+commented .imbued file. Credentials of the backend, such as the Vault
+token, are stored in the keychain rather than in the file.
+
+The config is then allowed, and the value of each secret can be stored
+through the server. Questions answered by flags aren't asked.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setupDefaultPaths(); err != nil {
+				return err
+			}
+
+			currentDir, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get current directory: %v", err)
+			}
+			if existing, err := config.ConfigInDir(currentDir); err != nil {
+				return err
+			} else if existing != "" {
+				return fmt.Errorf("%s already exists, edit it or add variables with `imbued import`", existing)
+			}
+			target := filepath.Join(currentDir, ".imbued")
+
+			interactive := term.IsTerminal(int(os.Stdin.Fd()))
+			reader := bufio.NewReader(os.Stdin)
+			ask := func(question, answer string) string {
+				if !interactive {
+					return answer
+				}
+				if answer != "" {
+					fmt.Printf("%s [%s] ", question, answer)
+				} else {
+					fmt.Printf("%s ", question)
+				}
+				line, _ := reader.ReadString('\n')
+				if line = strings.TrimSpace(line); line != "" {
+					return line
+				}
+				return answer
+			}
+			confirm := func(flag, question string, answer bool) bool {
+				if flagChanged(cmd, flag) || !interactive {
+					return answer
+				}
+				hint := "Y/n"
+				if !answer {
+					hint = "y/N"
+				}
+				switch strings.ToLower(ask(question, hint)) {
+				case "y", "yes":
+					return true
+				case "n", "no":
+					return false
+				default:
+					return answer
+				}
+			}
+
+			opts := config.InitOptions{Path: target, Prefix: prefix}
+			if !flagChanged(cmd, "prefix") {
+				opts.Prefix = defaultSecretPrefix(currentDir)
+			}
+
+			// Pick the backend among the stores found on the machine
+			if backendType != "" {
+				if _, ok := secrets.OptionsFor(backendType); !ok {
+					return fmt.Errorf("unknown backend type %q (expected one of %s)", backendType, strings.Join(secrets.BackendTypeNames(), ", "))
+				}
+				opts.BackendType = backendType
+			} else {
+				detections := secrets.DetectBackends()
+				var usable []secrets.Detection
+				fmt.Println("Secret stores on this machine:")
+				for _, detection := range detections {
+					if detection.Usable() {
+						usable = append(usable, detection)
+						fmt.Printf("  %d) %s: %s\n", len(usable), detection.Name, detection.Note)
+					} else {
+						fmt.Printf("  -  %s: %s\n", detection.Name, detection.Note)
+					}
+				}
+				if globalConfig.DefaultBackend != nil {
+					fmt.Printf("  %d) defaults.backend_type of the global config (%s)\n", len(usable)+1, globalConfig.DefaultBackend.Type)
+				}
+
+				choices := len(usable)
+				if globalConfig.DefaultBackend != nil {
+					choices++
+				}
+				if choices == 0 {
+					fmt.Println("  none")
+					return fmt.Errorf("no usable secret store found, choose one with --backend-type (one of %s)", strings.Join(secrets.BackendTypeNames(), ", "))
+				}
+
+				choice, err := strconv.Atoi(ask("Backend to use:", "1"))
+				if err != nil || choice < 1 || choice > choices {
+					return fmt.Errorf("invalid choice, expected a number from 1 to %d", choices)
+				}
+				if choice <= len(usable) {
+					detection := usable[choice-1]
+					opts.BackendType = detection.Type
+					opts.BackendConfig = detection.Config
+					opts.BackendNote = detection.Name + ", " + detection.Note
+				}
+			}
+
+			// Ask for the variables the project needs
+			if len(envNames) == 0 {
+				if !interactive {
+					return fmt.Errorf("--env is required when the input isn't a terminal")
+				}
+				answer := ask("Environment variables the project needs (separated by spaces or commas):", "")
+				envNames = strings.FieldsFunc(answer, func(r rune) bool { return r == ',' || r == ' ' })
+			}
+			seen := make(map[string]bool)
+			for _, env := range envNames {
+				if env = strings.TrimSpace(env); env != "" && !seen[env] {
+					seen[env] = true
+					opts.EnvNames = append(opts.EnvNames, env)
+				}
+			}
+
+			// Credentials found on the machine are moved to the keychain
+			// rather than written to the file
+			credentials := make(map[string]string)
+			for name, value := range opts.BackendConfig {
+				if secrets.IsCredential(opts.BackendType, name) {
+					credentials[config.DefaultBackendName+"."+name] = value
+					opts.BackendConfig[name] = secrets.KeychainReference(config.DefaultBackendName + "." + name)
+				}
+			}
+
+			data, err := config.InitialConfig(opts)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(target, data, 0644); err != nil {
+				return fmt.Errorf("failed to write config file: %v", err)
+			}
+			fmt.Printf("Created %s\n", target)
+
+			for name, value := range credentials {
+				if _, err := secrets.StoreReference(target, name, value); err != nil {
+					return fmt.Errorf("failed to store %s in the keychain: %v", name, err)
+				}
+				fmt.Printf("Stored %s in the keychain\n", name)
+			}
+
+			// The server only serves and stores secrets of allowed configs
+			if !confirm("allow", "Allow the config now?", allow) {
+				fmt.Println("Review it, then run `imbued allow`")
+				return nil
+			}
+			resp, err := runClient(socketPath, Command{Action: "allow_config", ConfigPath: target})
+			if err != nil {
+				return fmt.Errorf("failed to allow config: %v", err)
+			} else if !resp.Success {
+				return fmt.Errorf("failed to allow config: %s", resp.Error)
+			}
+			fmt.Printf("Allowed %s\n", target)
+
+			if len(opts.EnvNames) == 0 || !confirm("store-values", "Store the values of the secrets now?", storeValues) {
+				return nil
+			}
+			if !interactive {
+				fmt.Println("Values can only be entered from a terminal, store them with `imbued client set-secret`")
+				return nil
+			}
+
+			processID := auth.GetParentProcessID()
+			resp, err = runClient(socketPath, Command{Action: "authenticate", ConfigPath: target, ProcessID: processID})
+			if err != nil {
+				return fmt.Errorf("failed to authenticate: %v", err)
+			} else if !resp.Success {
+				return fmt.Errorf("authentication failed: %s", resp.Error)
+			}
+
+			for _, env := range opts.EnvNames {
+				name := opts.Prefix + env
+				value, err := secrets.PromptForSecureInput(fmt.Sprintf("Value of %s (empty to skip): ", env))
+				if err != nil {
+					return fmt.Errorf("failed to read secret value: %v", err)
+				}
+				if value == "" {
+					continue
+				}
+
+				resp, err := runClient(socketPath, Command{
+					Action:      "set_secret",
+					ConfigPath:  target,
+					ProcessID:   processID,
+					SecretName:  name,
+					Environment: map[string]string{"value": value},
+				})
+				if err != nil {
+					return fmt.Errorf("failed to set secret: %v", err)
+				} else if !resp.Success {
+					fmt.Fprintf(os.Stderr, "Warning: failed to store %s: %s\n", name, resp.Error)
+					continue
+				}
+				fmt.Printf("Stored %s\n", name)
+			}
+
+			return nil
+		},
+	}
+	initCmd.Flags().StringVar(&backendType, "backend-type", "", "Backend type of the config, instead of choosing among the detected stores")
+	initCmd.Flags().StringSliceVar(&envNames, "env", nil, "Environment variables the project needs, instead of asking")
+	initCmd.Flags().StringVar(&prefix, "prefix", "", "Prefix of the secret names (default: the project directory's name and _)")
+	initCmd.Flags().BoolVar(&allow, "allow", true, "Allow the config once it is written")
+	initCmd.Flags().BoolVar(&storeValues, "store-values", true, "Ask for the value of each secret and store it")
+
+	return initCmd
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -10,13 +11,17 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/novacove/imbued/pkg/auth"
+	"github.com/novacove/imbued/pkg/cache"
 	"github.com/novacove/imbued/pkg/config"
 	"github.com/novacove/imbued/pkg/secrets"
+	"github.com/novacove/imbued/pkg/snapshot"
 	"github.com/novacove/imbued/pkg/tracking"
+	"github.com/novacove/imbued/pkg/trust"
 	"github.com/spf13/cobra"
 )
 
@@ -30,14 +35,19 @@ type Command struct {
 	CurrentDir  string            `json:"current_dir,omitempty"`
 	Environment map[string]string `json:"environment,omitempty"`
 	BackendType string            `json:"backend_type,omitempty"`
+	Profile     string            `json:"profile,omitempty"`
+	EnvNames    []string          `json:"env_names,omitempty"` // Names of the variables set in the client's shell
 }
 
 // Response represents a response sent from server to client
 type Response struct {
-	Success bool              `json:"success"`
-	Error   string            `json:"error,omitempty"`
-	Data    map[string]string `json:"data,omitempty"`
-	Output  string            `json:"output,omitempty"`
+	Success  bool              `json:"success"`
+	Error    string            `json:"error,omitempty"`
+	Data     map[string]string `json:"data,omitempty"`
+	Output   string            `json:"output,omitempty"`
+	Warnings []string          `json:"warnings,omitempty"`
+	Offline  []string          `json:"offline,omitempty"` // Secrets served from the offline snapshot
+	Code     string            `json:"code,omitempty"`    // Machine readable reason of a failure
 }
 
 var (
@@ -47,45 +57,44 @@ var (
 	logFile      string
 	authDuration time.Duration
 	socketPath   string
+
+	// Server flags
+	backendIdleTimeout time.Duration
+	trustSigned        bool
 )
 
 var (
 	lgr *slog.Logger
 )
 
+// getLogger returns the logger of the client commands, writing to log.file
+// of the global config at log.level
 func getLogger() *slog.Logger {
 	if lgr == nil {
-		logFile, err := os.OpenFile(filepath.Join(
-			os.Getenv("HOME"),
-			".imbued",
-			"logs",
-			"info.log",
-		), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err := os.MkdirAll(filepath.Dir(globalConfig.LogFile), 0755); err != nil {
+			log.Fatalf("failed to create log directory: %v", err)
+		}
+		logFile, err := os.OpenFile(globalConfig.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
 			log.Fatalf("failed to open log file: %v", err)
 		}
-		lgr = slog.New(slog.NewJSONHandler(logFile, nil))
+		lgr = slog.New(slog.NewJSONHandler(logFile, &slog.HandlerOptions{Level: globalConfig.LogLevel}))
 	}
 	return lgr
 }
 
-// getDefaultSocketPath returns the default path for the Unix socket
-func getDefaultSocketPath() (string, error) {
+// getSnapshotDir returns the directory holding offline snapshots
+func getSnapshotDir() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "", fmt.Errorf("failed to get user home directory: %v", err)
 	}
 
-	socketDir := filepath.Join(homeDir, ".imbued")
-	if err := os.MkdirAll(socketDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create socket directory: %v", err)
-	}
-
-	return filepath.Join(socketDir, "imbued.sock"), nil
+	return filepath.Join(homeDir, ".imbued", "snapshots"), nil
 }
 
 // runServer starts the imbued server
-func runServer(socketPath string, tracker tracking.Tracker, authenticator auth.Authenticator) error {
+func runServer(socketPath string, tracker tracking.Tracker, authenticator auth.Authenticator, res *resolver, profiles *profileStore, policy *trustPolicy) error {
 	// Remove socket if it already exists
 	if err := os.RemoveAll(socketPath); err != nil {
 		return fmt.Errorf("failed to remove existing socket: %v", err)
@@ -107,12 +116,12 @@ func runServer(socketPath string, tracker tracking.Tracker, authenticator auth.A
 			continue
 		}
 
-		go handleConnection(conn, tracker, authenticator)
+		go handleConnection(conn, tracker, authenticator, res, profiles, policy)
 	}
 }
 
 // handleConnection handles a client connection
-func handleConnection(conn net.Conn, tracker tracking.Tracker, authenticator auth.Authenticator) {
+func handleConnection(conn net.Conn, tracker tracking.Tracker, authenticator auth.Authenticator, res *resolver, profiles *profileStore, policy *trustPolicy) {
 	defer conn.Close()
 
 	// Read command from client
@@ -132,6 +141,27 @@ func handleConnection(conn net.Conn, tracker tracking.Tracker, authenticator aut
 	}
 	log.Default().Printf("Received command: %s\n", stringifiedCmd)
 
+	// Configs are only loaded once allowed, see untrustedActions
+	if !untrustedActions[cmd.Action] {
+		if err := policy.checkTrust(cmd.ConfigPath); err != nil {
+			sendResponse(conn, Response{Success: false, Error: err.Error(), Code: codeConfigUntrusted})
+			return
+		}
+	}
+
+	// Profile rules are evaluated whenever the environment is injected
+	if cmd.Action == "inject_env" || cmd.Action == "inject_plain_env" {
+		applyProfileRules(cmd, profiles, tracker)
+	}
+
+	// Apply the profile the session selected, unless the client names one
+	if cmd.Profile == "" && cmd.Action != "use_profile" {
+		cmd.Profile = profiles.Get(cmd.ProcessID, cmd.ConfigPath)
+	}
+
+	// Backend calls are bounded by each backend's policy rather than a deadline here
+	ctx := context.Background()
+
 	// Process command
 	switch cmd.Action {
 	case "check_auth":
@@ -139,29 +169,46 @@ func handleConnection(conn net.Conn, tracker tracking.Tracker, authenticator aut
 	case "authenticate":
 		handleAuthenticate(conn, cmd, tracker, authenticator)
 	case "get_secret":
-		handleGetSecret(conn, cmd, tracker, authenticator)
+		handleGetSecret(ctx, conn, cmd, tracker, authenticator, res)
 	case "list_secrets":
 		handleListSecrets(conn, cmd)
 	case "inject_env":
-		handleInjectEnv(conn, cmd, tracker, authenticator)
+		handleInjectEnv(ctx, conn, cmd, tracker, authenticator, res)
+	case "inject_plain_env":
+		handleInjectPlainEnv(conn, cmd)
 	case "clean_env":
 		handleCleanEnv(conn, cmd)
+	case "explain":
+		handleExplain(ctx, conn, cmd, tracker, authenticator, res)
 	case "show_config":
-		handleShowConfig(conn, cmd)
+		handleShowConfig(conn, cmd, res, profiles)
 	case "find_config":
 		handleFindConfig(conn, cmd)
 	case "store_secrets":
-		handleStoreSecrets(conn, cmd, tracker, authenticator)
+		handleStoreSecrets(ctx, conn, cmd, tracker, authenticator, res)
 	case "set_secret":
-		handleSetSecret(conn, cmd, authenticator)
+		handleSetSecret(ctx, conn, cmd, authenticator, res)
+	case "flush_cache":
+		handleFlushCache(conn, cmd, res)
+	case "use_profile":
+		handleUseProfile(conn, cmd, profiles)
+	case "allow_config":
+		handleAllowConfig(conn, cmd, policy.store, res.pool)
+	case "deny_config":
+		handleDenyConfig(conn, cmd, policy.store, res.pool)
+	case "check_depth":
+		handleCheckDepth(conn, cmd)
+	case "check_trust":
+		// Untrusted configs were refused above
+		sendResponse(conn, Response{Success: true})
 	default:
 		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Unknown action: %s", cmd.Action)})
 	}
 }
 
-func handleSetSecret(conn net.Conn, cmd Command, authenticator auth.Authenticator) {
+func handleSetSecret(ctx context.Context, conn net.Conn, cmd Command, authenticator auth.Authenticator, res *resolver) {
 	// Load config
-	cfg, err := config.LoadConfig(cmd.ConfigPath)
+	cfg, err := loadConfig(cmd)
 	if err != nil {
 		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to load config: %v", err)})
 		return
@@ -173,33 +220,44 @@ func handleSetSecret(conn net.Conn, cmd Command, authenticator auth.Authenticato
 		return
 	}
 
-	// Initialize secret backend
-	backend, err := secrets.NewBackend(cfg.BackendType)
+	// Find the backend the secret belongs to
+	backendDef, err := cfg.BackendFor(cmd.SecretName)
 	if err != nil {
-		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to create secret backend: %v", err)})
+		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to get secret backend: %v", err)})
 		return
 	}
 
-	if err := backend.Initialize(cfg.BackendConfig); err != nil {
-		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to initialize secret backend: %v", err)})
+	// Get an initialized secret backend from the pool
+	backend, release, err := res.pool.Acquire(ctx, cmd.ConfigPath, backendDef.Source, backendDef.Type, backendDef.Config, backendDef.Policy)
+	if err != nil {
+		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to get secret backend: %v", err)})
 		return
 	}
-	defer backend.Close()
+	defer release()
 
 	// Store the secret
-	if err = backend.StoreSecrets(map[string]string{
-		cmd.SecretName: cmd.Environment["value"],
+	if err = backend.StoreSecrets(ctx, map[string]string{
+		cfg.BackendName(cmd.SecretName): cmd.Environment["value"],
 	}); err != nil {
 		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to store secret: %v", err)})
 		return
 	}
 
+	// Drop any cached value that may now be stale
+	res.cache.Flush(cmd.ConfigPath)
+
 	sendResponse(conn, Response{Success: true})
 }
 
-// handleCheckAuth handles the check_auth command
+// handleCheckAuth handles the check_auth command. A config that only has
+// plain environment values never requires authentication.
 func handleCheckAuth(conn net.Conn, cmd Command, authenticator auth.Authenticator) {
 	isAuthenticated := authenticator.IsAuthenticated(cmd.ProcessID)
+	if !isAuthenticated && cmd.ConfigPath != "" {
+		if cfg, err := loadConfig(cmd); err == nil && !cfg.HasSecrets() {
+			isAuthenticated = true
+		}
+	}
 	sendResponse(conn, Response{
 		Success: true,
 		Data: map[string]string{
@@ -211,17 +269,14 @@ func handleCheckAuth(conn net.Conn, cmd Command, authenticator auth.Authenticato
 // handleAuthenticate handles the authenticate command
 func handleAuthenticate(conn net.Conn, cmd Command, tracker tracking.Tracker, authenticator auth.Authenticator) {
 	// Load config
-	cfg, err := config.LoadConfig(cmd.ConfigPath)
+	cfg, err := loadConfig(cmd)
 	if err != nil {
 		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to load config: %v", err)})
 		return
 	}
 
 	// Get secret names
-	secretNames := make([]string, 0, len(cfg.Secrets))
-	for secretName := range cfg.Secrets {
-		secretNames = append(secretNames, secretName)
-	}
+	secretNames := cfg.SecretNames()
 
 	// Track authentication request
 	if err := tracker.TrackAuthenticationRequest(cmd.ProcessID, secretNames); err != nil {
@@ -254,21 +309,26 @@ func handleAuthenticate(conn net.Conn, cmd Command, tracker tracking.Tracker, au
 }
 
 // handleGetSecret handles the get_secret command
-func handleGetSecret(conn net.Conn, cmd Command, tracker tracking.Tracker, authenticator auth.Authenticator) {
+func handleGetSecret(ctx context.Context, conn net.Conn, cmd Command, tracker tracking.Tracker, authenticator auth.Authenticator, res *resolver) {
 	// Load config
-	cfg, err := config.LoadConfig(cmd.ConfigPath)
+	cfg, err := loadConfig(cmd)
 	if err != nil {
 		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to load config: %v", err)})
 		return
 	}
 
 	// Check if secret exists
-	envName, ok := cfg.Secrets[cmd.SecretName]
+	secret, ok := cfg.Secrets[cmd.SecretName]
 	if !ok {
 		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Secret not found: %s", cmd.SecretName)})
 		return
 	}
 
+	// Check if the secret is available in the client's directory
+	if _, ok := checkDepth(conn, cmd, cfg.ValidDepthFor(cmd.SecretName)); !ok {
+		return
+	}
+
 	// Check if authenticated
 	if !authenticator.IsAuthenticated(cmd.ProcessID) {
 		sendResponse(conn, Response{Success: false, Error: "Process is not authenticated"})
@@ -280,22 +340,9 @@ func handleGetSecret(conn net.Conn, cmd Command, tracker tracking.Tracker, authe
 		log.Printf("Failed to track secret access: %v", err)
 	}
 
-	// Initialize secret backend
-	backend, err := secrets.NewBackend(cfg.BackendType)
-	if err != nil {
-		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to create secret backend: %v", err)})
-		return
-	}
-
-	if err := backend.Initialize(cfg.BackendConfig); err != nil {
-		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to initialize secret backend: %v", err)})
-		return
-	}
-	defer backend.Close()
-
-	// Get the secret
-	secretValue, err := backend.GetSecret(cmd.SecretName)
-	if err != nil {
+	// Get the secret, from the cache or the backend
+	resolved := res.resolve(ctx, cmd.ConfigPath, cfg, []string{cmd.SecretName})
+	if err := resolved.Errors[cmd.SecretName]; err != nil {
 		if err := tracker.TrackSecretAccessFailure(cmd.ProcessID, []string{cmd.SecretName}, err); err != nil {
 			log.Printf("Failed to track secret access failure: %v", err)
 		}
@@ -306,16 +353,18 @@ func handleGetSecret(conn net.Conn, cmd Command, tracker tracking.Tracker, authe
 	sendResponse(conn, Response{
 		Success: true,
 		Data: map[string]string{
-			"env_name": envName,
-			"value":    secretValue,
+			"env_name": secret.EnvNames(),
+			"value":    resolved.Values[cmd.SecretName],
 		},
+		Warnings: append(cfg.Deprecations, resolved.warnings()...),
+		Offline:  resolved.offlineNames(),
 	})
 }
 
-func handleStoreSecrets(conn net.Conn, cmd Command, tracker tracking.Tracker, authenticator auth.Authenticator) {
+func handleStoreSecrets(ctx context.Context, conn net.Conn, cmd Command, tracker tracking.Tracker, authenticator auth.Authenticator, res *resolver) {
 	// Load config
 	log.Default().Printf("Loading config from %q", cmd.ConfigPath)
-	cfg, err := config.LoadConfig(cmd.ConfigPath)
+	cfg, err := loadConfig(cmd)
 	if err != nil {
 		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to load config: %v", err)})
 		return
@@ -333,33 +382,42 @@ func handleStoreSecrets(conn net.Conn, cmd Command, tracker tracking.Tracker, au
 		log.Printf("Failed to track secret access: %v", err)
 	}
 
-	// Initialize secret backend
-	backend, err := secrets.NewBackend(cfg.BackendType)
+	// Find the backend the secret belongs to
+	backendDef, err := cfg.BackendFor(cmd.SecretName)
 	if err != nil {
-		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to create secret backend: %v", err)})
+		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to get secret backend: %v", err)})
 		return
 	}
 
-	if err := backend.Initialize(cfg.BackendConfig); err != nil {
-		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to initialize secret backend: %v", err)})
+	// Get an initialized secret backend from the pool
+	backend, release, err := res.pool.Acquire(ctx, cmd.ConfigPath, backendDef.Source, backendDef.Type, backendDef.Config, backendDef.Policy)
+	if err != nil {
+		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to get secret backend: %v", err)})
 		return
 	}
-	defer backend.Close()
+	defer release()
 
-	// Store the secrets
-	err = backend.StoreSecrets(cmd.Environment)
+	// Store the secrets, under their name in the backend
+	values := make(map[string]string, len(cmd.Environment))
+	for secretName, value := range cmd.Environment {
+		values[cfg.BackendName(secretName)] = value
+	}
+	err = backend.StoreSecrets(ctx, values)
 	if err != nil {
 		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to store secrets: %v", err)})
 		return
 	}
 
+	// Drop any cached value that may now be stale
+	res.cache.Flush(cmd.ConfigPath)
+
 	sendResponse(conn, Response{Success: true})
 }
 
 // handleListSecrets handles the list_secrets command
 func handleListSecrets(conn net.Conn, cmd Command) {
 	// Load config
-	cfg, err := config.LoadConfig(cmd.ConfigPath)
+	cfg, err := loadConfig(cmd)
 	if err != nil {
 		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to load config: %v", err)})
 		return
@@ -367,74 +425,230 @@ func handleListSecrets(conn net.Conn, cmd Command) {
 
 	// Build response
 	data := make(map[string]string)
-	for secretName, envName := range cfg.Secrets {
-		data[secretName] = envName
+	for secretName, secret := range cfg.Secrets {
+		data[secretName] = secret.EnvNames()
 	}
 
 	sendResponse(conn, Response{Success: true, Data: data})
 }
 
 // handleInjectEnv handles the inject_env command
-func handleInjectEnv(conn net.Conn, cmd Command, tracker tracking.Tracker, authenticator auth.Authenticator) {
+func handleInjectEnv(ctx context.Context, conn net.Conn, cmd Command, tracker tracking.Tracker, authenticator auth.Authenticator, res *resolver) {
 	// Load config
-	cfg, err := config.LoadConfig(cmd.ConfigPath)
+	cfg, err := loadConfig(cmd)
 	if err != nil {
 		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to load config: %v", err)})
 		return
 	}
 
+	// Check if anything of the config is available in the client's directory
+	depth, ok := checkDepth(conn, cmd, cfg.MaxValidDepth())
+	if !ok {
+		return
+	}
+
+	// Plain values need neither authentication nor tracking
+	if !cfg.HasSecrets() {
+		sendResponse(conn, Response{Success: true, Data: plainEnv(cfg), Warnings: cfg.Deprecations})
+		return
+	}
+
 	// Check if authenticated
 	if !authenticator.IsAuthenticated(cmd.ProcessID) {
 		sendResponse(conn, Response{Success: false, Error: "Process is not authenticated"})
 		return
 	}
 
-	// Get secret names
-	secretNames := make([]string, 0, len(cfg.Secrets))
-	for secretName := range cfg.Secrets {
-		secretNames = append(secretNames, secretName)
-	}
+	// Get the names of the secrets available at this depth
+	secretNames := cfg.SecretNamesAt(depth)
 
 	// Track secret access
 	if err := tracker.TrackSecretAccess(cmd.ProcessID, secretNames); err != nil {
 		log.Printf("Failed to track secret access: %v", err)
 	}
 
-	// Initialize secret backend
-	backend, err := secrets.NewBackend(cfg.BackendType)
-	if err != nil {
-		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to create secret backend: %v", err)})
+	// Get all secrets, from the cache or the backend
+	resolved := res.resolve(ctx, cmd.ConfigPath, cfg, secretNames)
+	if resolved.BackendErr != nil && len(resolved.Values) == 0 {
+		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to get secrets: %v", resolved.BackendErr)})
 		return
 	}
+	for secretName, err := range resolved.Errors {
+		if err := tracker.TrackSecretAccessFailure(cmd.ProcessID, []string{secretName}, err); err != nil {
+			log.Printf("Failed to track secret access failure: %v", err)
+		}
+		log.Printf("Failed to get secret %s: %v", secretName, err)
+	}
 
-	if err := backend.Initialize(cfg.BackendConfig); err != nil {
-		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to initialize secret backend: %v", err)})
+	// Required secrets must all be resolved
+	var missing []string
+	for _, secretName := range secretNames {
+		if _, ok := resolved.Errors[secretName]; ok && cfg.Secrets[secretName].Required {
+			missing = append(missing, secretName)
+		}
+	}
+	if len(missing) > 0 {
+		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to get required secrets: %s", strings.Join(missing, ", "))})
 		return
 	}
-	defer backend.Close()
 
-	// Get and set each secret
+	// Secrets with a shallower valid_depth of their own are left out
+	warnings := append(cfg.Deprecations, resolved.warnings()...)
+	for _, secretName := range cfg.SecretNames() {
+		if validDepth := cfg.ValidDepthFor(secretName); depth > validDepth {
+			warnings = append(warnings, fmt.Sprintf("%s not set: deeper than its valid_depth of %d", secretName, validDepth))
+		}
+	}
+
+	// Map each secret to its environment variables, next to the plain
+	// values, which stop at the config's own valid_depth
 	data := make(map[string]string)
-	for secretName, envName := range cfg.Secrets {
-		secretValue, err := backend.GetSecret(secretName)
-		if err != nil {
-			if err := tracker.TrackSecretAccessFailure(cmd.ProcessID, []string{secretName}, err); err != nil {
-				log.Printf("Failed to track secret access failure: %v", err)
+	if depth <= cfg.ValidDepth {
+		data = plainEnv(cfg)
+	}
+	for secretName, secret := range cfg.Secrets {
+		if secretValue, ok := resolved.Values[secretName]; ok {
+			for _, envName := range secret.Env {
+				data[envName] = secretValue
 			}
-			log.Printf("Failed to get secret %s: %v", secretName, err)
+		}
+	}
+
+	// Render templated variables once their secrets are resolved, within
+	// the config's own valid_depth like the plain values
+	for _, name := range cfg.TemplateNames() {
+		if depth > cfg.ValidDepth {
+			break
+		}
+		value, err := renderTemplate(cfg.Templates[name], resolved)
+		if err != nil {
+			log.Printf("Failed to render template %s: %v", name, err)
+			warnings = append(warnings, fmt.Sprintf("%s not set: %v", name, err))
 			continue
 		}
+		data[name] = value
+	}
+
+	sendResponse(conn, Response{
+		Success:  true,
+		Data:     data,
+		Warnings: warnings,
+		Offline:  resolved.offlineNames(),
+	})
+}
 
-		data[envName] = secretValue
+// handleInjectPlainEnv handles the inject_plain_env command. It returns only
+// the plain environment values of the config, for processes that are not
+// authenticated for its secrets.
+func handleInjectPlainEnv(conn net.Conn, cmd Command) {
+	// Load config
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to load config: %v", err)})
+		return
 	}
 
-	sendResponse(conn, Response{Success: true, Data: data})
+	// Check if the plain values are available in the client's directory
+	if _, ok := checkDepth(conn, cmd, cfg.ValidDepth); !ok {
+		return
+	}
+
+	sendResponse(conn, Response{Success: true, Data: plainEnv(cfg), Warnings: cfg.Deprecations})
+}
+
+// plainEnv returns a copy of the plain environment values of a config
+func plainEnv(cfg *config.ImbuedConfig) map[string]string {
+	data := make(map[string]string, len(cfg.Env))
+	for name, value := range cfg.Env {
+		data[name] = value
+	}
+	return data
+}
+
+// handleFlushCache handles the flush_cache command. An empty config path
+// flushes the cached secrets of every config.
+func handleFlushCache(conn net.Conn, cmd Command, res *resolver) {
+	flushed := res.cache.Flush(cmd.ConfigPath)
+	// Backends are initialized again, reading their files and keychain
+	// credentials anew
+	res.pool.Invalidate(cmd.ConfigPath)
+	sendResponse(conn, Response{
+		Success: true,
+		Data: map[string]string{
+			"flushed": fmt.Sprintf("%d", flushed),
+		},
+	})
+}
+
+// handleExplain handles the explain command. It resolves the requested
+// secrets (or all of them) and reports where each value came from, without
+// returning the values themselves.
+func handleExplain(ctx context.Context, conn net.Conn, cmd Command, tracker tracking.Tracker, authenticator auth.Authenticator, res *resolver) {
+	// Load config
+	cfg, err := loadConfig(cmd)
+	if err != nil {
+		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to load config: %v", err)})
+		return
+	}
+
+	// Get secret names
+	var secretNames []string
+	if cmd.SecretName != "" {
+		if _, ok := cfg.Secrets[cmd.SecretName]; !ok {
+			sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Secret not found: %s", cmd.SecretName)})
+			return
+		}
+		secretNames = []string{cmd.SecretName}
+	} else {
+		secretNames = cfg.SecretNames()
+	}
+
+	// Only the secrets available in the client's directory are resolved
+	depth, err := commandDepth(cmd)
+	if err != nil {
+		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to check depth: %v", err)})
+		return
+	}
+	var available []string
+	for _, secretName := range secretNames {
+		if withinDepth(depth, cfg.ValidDepthFor(secretName)) {
+			available = append(available, secretName)
+		}
+	}
+
+	// Check if authenticated
+	if !authenticator.IsAuthenticated(cmd.ProcessID) {
+		sendResponse(conn, Response{Success: false, Error: "Process is not authenticated"})
+		return
+	}
+
+	// Track secret access
+	if err := tracker.TrackSecretAccess(cmd.ProcessID, available); err != nil {
+		log.Printf("Failed to track secret access: %v", err)
+	}
+
+	resolved := res.resolve(ctx, cmd.ConfigPath, cfg, available)
+
+	// Build response
+	data := make(map[string]string)
+	for _, secretName := range secretNames {
+		data[fmt.Sprintf("chain.%s", secretName)] = cfg.ChainFor(secretName).String()
+		if validDepth := cfg.ValidDepthFor(secretName); !withinDepth(depth, validDepth) {
+			data[fmt.Sprintf("error.%s", secretName)] = depthError(cmd, depth, validDepth)
+		} else if source, ok := resolved.Sources[secretName]; ok {
+			data[fmt.Sprintf("source.%s", secretName)] = source
+		} else if err, ok := resolved.Errors[secretName]; ok {
+			data[fmt.Sprintf("error.%s", secretName)] = err.Error()
+		}
+	}
+
+	sendResponse(conn, Response{Success: true, Data: data, Warnings: append(cfg.Deprecations, resolved.warnings()...)})
 }
 
 // handleCleanEnv handles the clean_env command
 func handleCleanEnv(conn net.Conn, cmd Command) {
 	// Load config
-	cfg, err := config.LoadConfig(cmd.ConfigPath)
+	cfg, err := loadConfig(cmd)
 	if err != nil {
 		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to load config: %v", err)})
 		return
@@ -442,17 +656,25 @@ func handleCleanEnv(conn net.Conn, cmd Command) {
 
 	// Build response
 	data := make(map[string]string)
-	for _, envName := range cfg.Secrets {
-		data[envName] = ""
+	for _, secret := range cfg.Secrets {
+		for _, envName := range secret.Env {
+			data[envName] = ""
+		}
+	}
+	for name := range cfg.Templates {
+		data[name] = ""
+	}
+	for name := range cfg.Env {
+		data[name] = ""
 	}
 
 	sendResponse(conn, Response{Success: true, Data: data})
 }
 
 // handleShowConfig handles the show_config command
-func handleShowConfig(conn net.Conn, cmd Command) {
+func handleShowConfig(conn net.Conn, cmd Command, res *resolver, profiles *profileStore) {
 	// Load config
-	cfg, err := config.LoadConfig(cmd.ConfigPath)
+	cfg, err := loadConfig(cmd)
 	if err != nil {
 		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to load config: %v", err)})
 		return
@@ -465,14 +687,76 @@ func handleShowConfig(conn net.Conn, cmd Command) {
 		"backend_type": cfg.BackendType,
 	}
 
+	// Add profiles
+	data["profile"] = cfg.Profile
+	data["profiles"] = strings.Join(cfg.Profiles, ",")
+	if reason := profiles.Reason(cmd.ProcessID, cmd.ConfigPath); reason != "" && cfg.Profile != "" {
+		data["profile_reason"] = reason
+	}
+
+	// Add the files the config is merged from, outermost parent first
+	for i, layer := range cfg.Layers {
+		data[fmt.Sprintf("layer.%d", i)] = layer
+	}
+
 	// Add backend config
 	for key, value := range cfg.BackendConfig {
 		data[fmt.Sprintf("backend_config.%s", key)] = value
 	}
 
+	// Add circuit breaker status
+	status := secrets.BreakerStatus{State: secrets.BreakerClosed}
+	if backend, ok := cfg.Backends[config.DefaultBackendName]; ok {
+		status = res.pool.Status(cmd.ConfigPath, backend.Source, backend.Type, backend.Config)
+	}
+	data["backend_status.state"] = string(status.State)
+	data["backend_status.failures"] = fmt.Sprintf("%d", status.Failures)
+	if status.State != secrets.BreakerClosed {
+		data["backend_status.open_until"] = status.OpenUntil.Format(time.RFC3339)
+		data["backend_status.last_error"] = status.LastError
+	}
+
+	// Add named backends and their circuit breaker status
+	data["default_backend"] = cfg.DefaultBackends.String()
+	for name, backend := range cfg.Backends {
+		status := res.pool.Status(cmd.ConfigPath, backend.Source, backend.Type, backend.Config)
+		data[fmt.Sprintf("backends.%s.type", name)] = backend.Type
+		data[fmt.Sprintf("backends.%s.state", name)] = string(status.State)
+		data[fmt.Sprintf("backends.%s.failures", name)] = fmt.Sprintf("%d", status.Failures)
+	}
+
 	// Add secrets
-	for secretName, envName := range cfg.Secrets {
-		data[fmt.Sprintf("secret.%s", secretName)] = envName
+	for secretName, secret := range cfg.Secrets {
+		data[fmt.Sprintf("secret.%s", secretName)] = secret.EnvNames()
+		data[fmt.Sprintf("secret_backend.%s", secretName)] = cfg.ChainFor(secretName).String()
+		if secret.Name != secretName {
+			data[fmt.Sprintf("secret_name.%s", secretName)] = secret.Name
+		}
+		if secret.Field != "" {
+			data[fmt.Sprintf("secret_field.%s", secretName)] = secret.Field
+		}
+		if secret.JSONKey != "" {
+			data[fmt.Sprintf("secret_json_key.%s", secretName)] = secret.JSONKey
+		}
+		if secret.Transform != "" {
+			data[fmt.Sprintf("secret_transform.%s", secretName)] = secret.Transform
+		}
+		if secret.Required {
+			data[fmt.Sprintf("secret_required.%s", secretName)] = "true"
+		}
+		if secret.ValidDepth != nil {
+			data[fmt.Sprintf("secret_valid_depth.%s", secretName)] = fmt.Sprintf("%d", *secret.ValidDepth)
+		}
+	}
+
+	// Add templates
+	for name, tmpl := range cfg.Templates {
+		data[fmt.Sprintf("template.%s", name)] = strings.Join(tmpl.Dependencies, ",")
+	}
+
+	// Add plain environment values
+	for name, value := range cfg.Env {
+		data[fmt.Sprintf("env.%s", name)] = value
 	}
 
 	sendResponse(conn, Response{Success: true, Data: data})
@@ -495,6 +779,43 @@ func handleFindConfig(conn net.Conn, cmd Command) {
 	})
 }
 
+// handleUseProfile handles the use_profile command. It selects the profile
+// of the config used by the session, or clears the selection if no profile
+// is given.
+func handleUseProfile(conn net.Conn, cmd Command, profiles *profileStore) {
+	// Make sure the profile exists before selecting it
+	if _, err := loadConfig(cmd); err != nil {
+		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to load config: %v", err)})
+		return
+	}
+
+	previous := profiles.Set(cmd.ProcessID, cmd.ConfigPath, cmd.Profile)
+	sendResponse(conn, Response{
+		Success: true,
+		Data: map[string]string{
+			"profile":  cmd.Profile,
+			"previous": previous,
+		},
+	})
+}
+
+// envNames returns the names of the variables set in the environment
+func envNames() []string {
+	environ := os.Environ()
+	names := make([]string, 0, len(environ))
+	for _, entry := range environ {
+		if name, _, ok := strings.Cut(entry, "="); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// loadConfig loads the config of a command with the command's profile
+func loadConfig(cmd Command) (*config.ImbuedConfig, error) {
+	return config.LoadConfigProfile(cmd.ConfigPath, cmd.Profile, globalConfig.Defaults())
+}
+
 // sendResponse sends a response to the client
 func sendResponse(conn net.Conn, resp Response) {
 	encoder := json.NewEncoder(conn)
@@ -503,6 +824,13 @@ func sendResponse(conn net.Conn, resp Response) {
 	}
 }
 
+// printWarnings prints the warnings of a response to stderr
+func printWarnings(resp *Response) {
+	for _, warning := range resp.Warnings {
+		fmt.Fprintf(os.Stderr, "imbued: warning: %s\n", warning)
+	}
+}
+
 // runClient sends a command to the server and returns the response
 func runClient(socketPath string, cmd Command) (*Response, error) {
 	// Connect to server
@@ -545,7 +873,7 @@ func findAndLoadConfig(configPath string, maxLevels int) (string, *config.Imbued
 		}
 	}
 
-	cfg, err := config.LoadConfig(configFilePath)
+	cfg, err := config.LoadConfig(configFilePath, globalConfig.Defaults())
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to load config: %v", err)
 	}
@@ -553,14 +881,68 @@ func findAndLoadConfig(configPath string, maxLevels int) (string, *config.Imbued
 	return configFilePath, cfg, nil
 }
 
+// resolveConfigPath returns the --config flag if set, otherwise it asks the
+// server to find the config file for the current directory
+func resolveConfigPath() (string, error) {
+	if configPath != "" {
+		return configPath, nil
+	}
+
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %v", err)
+	}
+
+	resp, err := runClient(socketPath, Command{
+		Action:     "find_config",
+		CurrentDir: currentDir,
+		MaxLevels:  maxLevels,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to find config: %v", err)
+	}
+
+	if !resp.Success {
+		return "", fmt.Errorf("failed to find config: %s", resp.Error)
+	}
+
+	return resp.Data["config_path"], nil
+}
+
+// configPathArg returns the absolute path of the config named by an optional
+// path argument, which may also be the directory holding the config. Without
+// an argument the config is searched for like other client commands do.
+func configPathArg(args []string) (string, error) {
+	if len(args) == 0 {
+		return resolveConfigPath()
+	}
+
+	path, err := filepath.Abs(args[0])
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %v", err)
+	}
+
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		configPath, err := config.ConfigInDir(path)
+		if err != nil {
+			return "", err
+		}
+		if configPath == "" {
+			configPath = filepath.Join(path, ".imbued")
+		}
+		path = configPath
+	}
+	return path, nil
+}
+
 // initializeBackend initializes the secret backend
-func initializeBackend(cfg *config.ImbuedConfig) (secrets.Backend, error) {
+func initializeBackend(ctx context.Context, cfg *config.ImbuedConfig) (secrets.Backend, error) {
 	backend, err := secrets.NewBackend(cfg.BackendType)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create secret backend: %v", err)
 	}
 
-	if err := backend.Initialize(cfg.BackendConfig); err != nil {
+	if err := backend.Initialize(ctx, cfg.BackendConfig); err != nil {
 		return nil, fmt.Errorf("failed to initialize secret backend: %v", err)
 	}
 
@@ -570,36 +952,25 @@ func initializeBackend(cfg *config.ImbuedConfig) (secrets.Backend, error) {
 // setupCommonFlags adds common flags to a command
 func setupCommonFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().StringVar(&configPath, "config", "", "Path to the .imbued config file (default: search in current and parent directories)")
-	cmd.PersistentFlags().IntVar(&maxLevels, "max-levels", 3, "Maximum number of directory levels to search up for .imbued file")
-	cmd.PersistentFlags().StringVar(&logFile, "log-file", "", "Path to the log file (default: ~/.imbued/logs/imbued.log)")
-	cmd.PersistentFlags().DurationVar(&authDuration, "auth-duration", 1*time.Hour, "Duration for which authentication is valid")
-	cmd.PersistentFlags().StringVar(&socketPath, "socket", "", "Unix socket path for server (default: ~/.imbued/socket)")
+	cmd.PersistentFlags().IntVar(&maxLevels, "max-levels", 0, "Maximum number of directory levels to search up for a config, 0 for up to the project root (overrides client.max_levels of the global config)")
+	cmd.PersistentFlags().StringVar(&logFile, "log-file", "", "Path to the access log file (default: log.access_file of the global config, or ~/.imbued/logs/imbued.log)")
+	cmd.PersistentFlags().DurationVar(&authDuration, "auth-duration", 1*time.Hour, "Duration for which authentication is valid (overrides server.auth_duration of the global config)")
+	cmd.PersistentFlags().StringVar(&socketPath, "socket", "", "Unix socket path for server (default: server.socket of the global config, or ~/.imbued/imbued.sock)")
 }
 
-// setupDefaultPaths sets up default paths for log file and socket
+// setupDefaultPaths creates the directories of the log file and socket,
+// whose defaults come from the global config
 func setupDefaultPaths() error {
-	// Set default log file path if not specified
-	if logFile == "" {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return fmt.Errorf("failed to get user home directory: %v", err)
-		}
-		logFile = filepath.Join(homeDir, ".imbued", "logs", "imbued.log")
-	}
-
 	// Ensure log directory exists
 	logDir := filepath.Dir(logFile)
 	if err := os.MkdirAll(logDir, 0755); err != nil {
 		return fmt.Errorf("failed to create log directory: %v", err)
 	}
 
-	// Set default socket path if not specified
-	if socketPath == "" {
-		var err error
-		socketPath, err = getDefaultSocketPath()
-		if err != nil {
-			return fmt.Errorf("failed to get default socket path: %v", err)
-		}
+	// Ensure socket directory exists
+	socketDir := filepath.Dir(socketPath)
+	if err := os.MkdirAll(socketDir, 0755); err != nil {
+		return fmt.Errorf("failed to create socket directory: %v", err)
 	}
 
 	return nil
@@ -611,6 +982,9 @@ func main() {
 		Use:   "imbued",
 		Short: "Imbued is a tool for managing secrets",
 		Long:  `Imbued is a tool for managing secrets and injecting them into environment variables.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return loadGlobalConfig(cmd)
+		},
 	}
 
 	// Setup common flags
@@ -643,8 +1017,44 @@ func main() {
 			// Initialize authenticator
 			authenticator := auth.NewSimpleAuthenticator(authDuration)
 
+			// Initialize backend pool
+			pool := secrets.NewPool(backendIdleTimeout)
+			defer pool.Close()
+
+			// Initialize secret cache
+			secretCache := cache.New()
+			defer secretCache.Close()
+
+			// Initialize offline snapshot store
+			snapshotDir, err := getSnapshotDir()
+			if err != nil {
+				return err
+			}
+			snapshots := snapshot.NewStore(snapshotDir, snapshot.KeychainKeyProvider)
+
+			res := &resolver{
+				pool:      pool,
+				cache:     secretCache,
+				snapshots: snapshots,
+			}
+
+			// Initialize trust policy
+			trustStorePath, err := getTrustStorePath()
+			if err != nil {
+				return err
+			}
+			trustedKeysPath, err := getTrustedKeysPath()
+			if err != nil {
+				return err
+			}
+			policy := &trustPolicy{
+				store:           trust.NewStore(trustStorePath),
+				trustedKeysPath: trustedKeysPath,
+				trustSigned:     trustSigned,
+			}
+
 			log.Printf("Running in server mode")
-			if err := runServer(socketPath, tracker, authenticator); err != nil {
+			if err := runServer(socketPath, tracker, authenticator, res, newProfileStore(authDuration), policy); err != nil {
 				return fmt.Errorf("server error: %v", err)
 			}
 
@@ -652,6 +1062,9 @@ func main() {
 		},
 	}
 
+	daemonCmd.Flags().DurationVar(&backendIdleTimeout, "backend-idle-timeout", 10*time.Minute, "Duration after which an unused secret backend is closed (overrides server.backend_idle_timeout of the global config)")
+	daemonCmd.Flags().BoolVar(&trustSigned, "trust-signed-configs", true, "Trust configs signed by a key in ~/.imbued/trusted_keys without imbued allow (overrides server.trust_signed_configs of the global config)")
+
 	// Add daemon command to server command
 	serverCmd.AddCommand(daemonCmd)
 
@@ -668,8 +1081,9 @@ func main() {
 
 			// Send check_auth command to server
 			clientCmd := Command{
-				Action:    "check_auth",
-				ProcessID: processID,
+				Action:     "check_auth",
+				ConfigPath: configPath,
+				ProcessID:  processID,
 			}
 
 			resp, err := runClient(socketPath, clientCmd)
@@ -706,7 +1120,7 @@ func main() {
 
 			lgr := getLogger()
 			processID := auth.GetParentProcessID()
-			lgr.Info("Authenticating process ID: %s\n", processID)
+			lgr.Info("Authenticating process", "process_id", processID)
 			currentDir, err := os.Getwd()
 			if err != nil {
 				return fmt.Errorf("failed to get current directory: %v", err)
@@ -803,6 +1217,7 @@ func main() {
 				ConfigPath: configFilePath,
 				SecretName: secretName,
 				ProcessID:  processID,
+				CurrentDir: currentDir,
 			}
 
 			resp, err := runClient(socketPath, clientCmd)
@@ -814,6 +1229,7 @@ func main() {
 				return fmt.Errorf("failed to get secret: %s", resp.Error)
 			}
 
+			printWarnings(resp)
 			fmt.Printf("%s=%s\n", resp.Data["env_name"], resp.Data["value"])
 			return nil
 		},
@@ -861,6 +1277,7 @@ func main() {
 			clientCmd := Command{
 				Action:     "list_secrets",
 				ConfigPath: configFilePath,
+				ProcessID:  auth.GetParentProcessID(),
 			}
 
 			resp, err := runClient(socketPath, clientCmd)
@@ -882,6 +1299,7 @@ func main() {
 	}
 
 	// Create inject-env command
+	var plainOnly bool
 	injectEnvCmd := &cobra.Command{
 		Use:   "inject-env",
 		Short: "Inject secrets into environment variables",
@@ -920,11 +1338,18 @@ func main() {
 				configFilePath = resp.Data["config_path"]
 			}
 
-			// Send inject_env command to server
+			// Send inject_env command to server, with the names of the
+			// shell's variables for the config's profile rules
 			clientCmd := Command{
 				Action:     "inject_env",
 				ConfigPath: configFilePath,
 				ProcessID:  processID,
+				CurrentDir: currentDir,
+				EnvNames:   envNames(),
+			}
+			if plainOnly {
+				// Only the plain values, which don't require authentication
+				clientCmd.Action = "inject_plain_env"
 			}
 
 			resp, err := runClient(socketPath, clientCmd)
@@ -932,10 +1357,19 @@ func main() {
 				return fmt.Errorf("failed to inject env: %v", err)
 			}
 
+			// Shells clean up the config's variables on this exit status
+			if resp.Code == codeOutsideValidDepth {
+				fmt.Fprintln(os.Stderr, resp.Error)
+				os.Exit(exitOutsideValidDepth)
+			}
+
 			if !resp.Success {
 				return fmt.Errorf("failed to inject env: %s", resp.Error)
 			}
 
+			// Warnings go to stderr so they don't end up in the evaluated output
+			printWarnings(resp)
+
 			// Print environment variables
 			for envName, value := range resp.Data {
 				fmt.Printf("export %s=%s\n", envName, value)
@@ -945,6 +1379,70 @@ func main() {
 		},
 	}
 
+	injectEnvCmd.Flags().BoolVar(&plainOnly, "plain-only", false, "Only inject the plain values of the [env] table")
+
+	// Create explain command
+	explainCmd := &cobra.Command{
+		Use:   "explain [secret-name]",
+		Short: "Show which backend each secret is resolved from",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setupDefaultPaths(); err != nil {
+				return err
+			}
+
+			configFilePath, err := resolveConfigPath()
+			if err != nil {
+				return err
+			}
+
+			currentDir, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get current directory: %v", err)
+			}
+
+			clientCmd := Command{
+				Action:     "explain",
+				ConfigPath: configFilePath,
+				ProcessID:  auth.GetParentProcessID(),
+				CurrentDir: currentDir,
+			}
+			if len(args) == 1 {
+				clientCmd.SecretName = args[0]
+			}
+
+			resp, err := runClient(socketPath, clientCmd)
+			if err != nil {
+				return fmt.Errorf("failed to explain secrets: %v", err)
+			}
+
+			if !resp.Success {
+				return fmt.Errorf("failed to explain secrets: %s", resp.Error)
+			}
+
+			printWarnings(resp)
+
+			// Print secrets in a stable order
+			var secretNames []string
+			for key := range resp.Data {
+				if strings.HasPrefix(key, "chain.") {
+					secretNames = append(secretNames, strings.TrimPrefix(key, "chain."))
+				}
+			}
+			sort.Strings(secretNames)
+
+			for _, secretName := range secretNames {
+				if source, ok := resp.Data["source."+secretName]; ok {
+					fmt.Printf("%s: from %s (chain: %s)\n", secretName, source, resp.Data["chain."+secretName])
+				} else {
+					fmt.Printf("%s: not resolved: %s (chain: %s)\n", secretName, resp.Data["error."+secretName], resp.Data["chain."+secretName])
+				}
+			}
+
+			return nil
+		},
+	}
+
 	// Create clean-env command
 	cleanEnvCmd := &cobra.Command{
 		Use:   "clean-env",
@@ -987,6 +1485,7 @@ func main() {
 			clientCmd := Command{
 				Action:     "clean_env",
 				ConfigPath: configFilePath,
+				ProcessID:  auth.GetParentProcessID(),
 			}
 
 			resp, err := runClient(socketPath, clientCmd)
@@ -1007,6 +1506,29 @@ func main() {
 		},
 	}
 
+	// Create find-config command
+	findConfigCmd := &cobra.Command{
+		Use:   "find-config",
+		Short: "Print the path of the config used in the current directory",
+		Long: `Print the path of the config used in the current directory.
+
+Unlike show-config, this works for configs that aren't allowed yet, so that
+the shell integration can tell them apart from directories without a config.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setupDefaultPaths(); err != nil {
+				return err
+			}
+
+			configFilePath, err := resolveConfigPath()
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(configFilePath)
+			return nil
+		},
+	}
+
 	// Create show-config command
 	showConfigCmd := &cobra.Command{
 		Use:   "show-config",
@@ -1049,6 +1571,7 @@ func main() {
 			clientCmd := Command{
 				Action:     "show_config",
 				ConfigPath: configFilePath,
+				ProcessID:  auth.GetParentProcessID(),
 			}
 
 			resp, err := runClient(socketPath, clientCmd)
@@ -1063,7 +1586,35 @@ func main() {
 			// Print config
 			fmt.Printf("Config file: %s\n", resp.Data["config_file"])
 			fmt.Printf("Valid depth: %s\n", resp.Data["valid_depth"])
+			if profiles := resp.Data["profiles"]; profiles != "" {
+				profile := resp.Data["profile"]
+				if profile == "" {
+					profile = "none"
+				}
+				fmt.Printf("Profile: %s (available: %s)\n", profile, profiles)
+				if reason, ok := resp.Data["profile_reason"]; ok {
+					fmt.Printf("  Selected because %s\n", reason)
+				}
+			}
+
+			// Print the layers the config is merged from, in order
+			if _, ok := resp.Data["layer.1"]; ok {
+				fmt.Println("Layers (later files override earlier ones):")
+				for i := 0; ; i++ {
+					layer, ok := resp.Data[fmt.Sprintf("layer.%d", i)]
+					if !ok {
+						break
+					}
+					fmt.Printf("  %d. %s\n", i+1, layer)
+				}
+			}
+
 			fmt.Printf("Backend type: %s\n", resp.Data["backend_type"])
+			fmt.Printf("Backend status: %s (%s consecutive failures)\n", resp.Data["backend_status.state"], resp.Data["backend_status.failures"])
+			if openUntil, ok := resp.Data["backend_status.open_until"]; ok {
+				fmt.Printf("  Failing fast until: %s\n", openUntil)
+				fmt.Printf("  Last error: %s\n", resp.Data["backend_status.last_error"])
+			}
 
 			// Print backend config
 			fmt.Println("Backend config:")
@@ -1074,12 +1625,44 @@ func main() {
 				}
 			}
 
+			// Print named backends
+			fmt.Printf("Backends (default: %s):\n", resp.Data["default_backend"])
+			for key, backendType := range resp.Data {
+				if strings.HasPrefix(key, "backends.") && strings.HasSuffix(key, ".type") {
+					name := strings.TrimSuffix(strings.TrimPrefix(key, "backends."), ".type")
+					fmt.Printf("  %s (%s): %s (%s consecutive failures)\n", name, backendType,
+						resp.Data["backends."+name+".state"], resp.Data["backends."+name+".failures"])
+				}
+			}
+
 			// Print secrets
 			fmt.Println("Secrets:")
 			for key := range resp.Data {
 				if strings.HasPrefix(key, "secret.") {
 					secretName := strings.TrimPrefix(key, "secret.")
-					fmt.Printf("  %s\n", secretName)
+					details := []string{"env: " + resp.Data[key], "backend: " + resp.Data["secret_backend."+secretName]}
+					for _, option := range []string{"name", "field", "json_key", "transform", "required", "valid_depth"} {
+						if value, ok := resp.Data["secret_"+option+"."+secretName]; ok {
+							details = append(details, option+": "+value)
+						}
+					}
+					fmt.Printf("  %s (%s)\n", secretName, strings.Join(details, ", "))
+				}
+			}
+
+			// Print templates
+			fmt.Println("Templates:")
+			for key, dependencies := range resp.Data {
+				if strings.HasPrefix(key, "template.") {
+					fmt.Printf("  %s (from: %s)\n", strings.TrimPrefix(key, "template."), dependencies)
+				}
+			}
+
+			// Print plain environment values
+			fmt.Println("Env:")
+			for key, value := range resp.Data {
+				if strings.HasPrefix(key, "env.") {
+					fmt.Printf("  %s=%s\n", strings.TrimPrefix(key, "env."), value)
 				}
 			}
 
@@ -1144,7 +1727,7 @@ func main() {
 				return fmt.Errorf("failed to get current directory: %v", err)
 			} else if configPath, err = config.FindConfig(wd, 1); err != nil {
 				return fmt.Errorf("failed to find config file: %v", err)
-			} else if fig, err = config.LoadConfig(configPath); err != nil {
+			} else if fig, err = config.LoadConfig(configPath, globalConfig.Defaults()); err != nil {
 				return fmt.Errorf("failed to load config file: %v", err)
 			}
 
@@ -1182,11 +1765,14 @@ func main() {
 			if err != nil {
 				return fmt.Errorf("failed to get current directory: %v", err)
 			}
-			clientConfigPath := filepath.Join(
-				wd,
-				".imbued",
-			)
-			cfg, err := config.LoadConfig(clientConfigPath)
+			clientConfigPath, err := config.ConfigInDir(wd)
+			if err != nil {
+				return err
+			}
+			if clientConfigPath == "" {
+				return fmt.Errorf("no .imbued file found in %s", wd)
+			}
+			cfg, err := config.LoadConfig(clientConfigPath, globalConfig.Defaults())
 			if err != nil {
 				return fmt.Errorf("failed to load config: %v", err)
 			}
@@ -1243,6 +1829,177 @@ func main() {
 
 	smeltCmd.Flags().String("prefix", "", "Optional prefix to prepend to each key before storing in the keychain")
 
+	// Create use command
+	var clearProfile bool
+	useCmd := &cobra.Command{
+		Use:   "use [profile]",
+		Short: "Select the profile of the current config for this shell",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setupDefaultPaths(); err != nil {
+				return err
+			}
+
+			if len(args) == 0 && !clearProfile {
+				return fmt.Errorf("a profile name or --clear is required")
+			}
+
+			configFilePath, err := resolveConfigPath()
+			if err != nil {
+				return err
+			}
+
+			clientCmd := Command{
+				Action:     "use_profile",
+				ConfigPath: configFilePath,
+				ProcessID:  auth.GetParentProcessID(),
+			}
+			if !clearProfile {
+				clientCmd.Profile = args[0]
+			}
+
+			resp, err := runClient(socketPath, clientCmd)
+			if err != nil {
+				return fmt.Errorf("failed to use profile: %v", err)
+			}
+
+			if !resp.Success {
+				return fmt.Errorf("failed to use profile: %s", resp.Error)
+			}
+
+			if profile := resp.Data["profile"]; profile != "" {
+				fmt.Printf("Using profile %s\n", profile)
+			} else {
+				fmt.Println("Using no profile")
+			}
+			return nil
+		},
+	}
+	useCmd.Flags().BoolVar(&clearProfile, "clear", false, "Stop using a profile")
+
+	// Create check-trust command
+	checkTrustCmd := &cobra.Command{
+		Use:   "check-trust",
+		Short: "Check if the current config is allowed",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setupDefaultPaths(); err != nil {
+				return err
+			}
+
+			configFilePath, err := resolveConfigPath()
+			if err != nil {
+				return err
+			}
+
+			resp, err := runClient(socketPath, Command{
+				Action:     "check_trust",
+				ConfigPath: configFilePath,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to check trust: %v", err)
+			}
+
+			// The notice is shown as is by the shell integration
+			if !resp.Success {
+				fmt.Fprintln(os.Stderr, resp.Error)
+				os.Exit(1)
+			}
+
+			fmt.Printf("%s is allowed\n", configFilePath)
+			return nil
+		},
+	}
+
+	// Create check-depth command
+	checkDepthCmd := &cobra.Command{
+		Use:   "check-depth",
+		Short: "Show which values of the config are available in the current directory",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setupDefaultPaths(); err != nil {
+				return err
+			}
+
+			configFilePath, err := resolveConfigPath()
+			if err != nil {
+				return err
+			}
+
+			currentDir, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("failed to get current directory: %v", err)
+			}
+
+			resp, err := runClient(socketPath, Command{
+				Action:     "check_depth",
+				ConfigPath: configFilePath,
+				ProcessID:  auth.GetParentProcessID(),
+				CurrentDir: currentDir,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to check depth: %v", err)
+			}
+
+			// Shells clean up the config's variables on this exit status
+			if resp.Code == codeOutsideValidDepth {
+				fmt.Fprintln(os.Stderr, resp.Error)
+				os.Exit(exitOutsideValidDepth)
+			}
+
+			if !resp.Success {
+				return fmt.Errorf("failed to check depth: %s", resp.Error)
+			}
+
+			// The output is compared by the shell integration between directories
+			fmt.Printf("depth: %s, secrets: %s, plain values: %s\n", resp.Data["depth"], resp.Data["secrets"], resp.Data["values"])
+			return nil
+		},
+	}
+
+	// Create cache command
+	cacheCmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Commands for the server's secret cache",
+	}
+
+	// Create cache flush command
+	var flushAll bool
+	cacheFlushCmd := &cobra.Command{
+		Use:   "flush",
+		Short: "Flush cached secrets for the current config",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setupDefaultPaths(); err != nil {
+				return err
+			}
+
+			// An empty config path flushes every cached secret
+			var configFilePath string
+			if !flushAll {
+				var err error
+				configFilePath, err = resolveConfigPath()
+				if err != nil {
+					return err
+				}
+			}
+
+			resp, err := runClient(socketPath, Command{
+				Action:     "flush_cache",
+				ConfigPath: configFilePath,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to flush cache: %v", err)
+			}
+
+			if !resp.Success {
+				return fmt.Errorf("failed to flush cache: %s", resp.Error)
+			}
+
+			fmt.Printf("Flushed %s cached secrets\n", resp.Data["flushed"])
+			return nil
+		},
+	}
+	cacheFlushCmd.Flags().BoolVar(&flushAll, "all", false, "Flush cached secrets for every config")
+	cacheCmd.AddCommand(cacheFlushCmd)
+
 	// Create client command
 	clientCmd := &cobra.Command{
 		Use:   "client",
@@ -1257,15 +2014,98 @@ func main() {
 	clientCmd.AddCommand(listSecretsCmd)
 	clientCmd.AddCommand(injectEnvCmd)
 	clientCmd.AddCommand(cleanEnvCmd)
+	clientCmd.AddCommand(explainCmd)
+	clientCmd.AddCommand(findConfigCmd)
 	clientCmd.AddCommand(showConfigCmd)
 	clientCmd.AddCommand(smeltCmd)
 	clientCmd.AddCommand(setSecretCommand)
+	clientCmd.AddCommand(cacheCmd)
+	clientCmd.AddCommand(useCmd)
+	clientCmd.AddCommand(checkTrustCmd)
+	clientCmd.AddCommand(checkDepthCmd)
+
+	// Create allow command
+	allowCmd := &cobra.Command{
+		Use:   "allow [path]",
+		Short: "Trust a .imbued config in its current form",
+		Long:  `Trust a .imbued config, and the files it inherits from, in their current form. Secrets and values of a config are only injected once it is allowed, and again after every change to it. Allowing a config also trusts the configs of its project that are signed by a trusted key.`,
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setupDefaultPaths(); err != nil {
+				return err
+			}
+
+			configFilePath, err := configPathArg(args)
+			if err != nil {
+				return err
+			}
+
+			resp, err := runClient(socketPath, Command{
+				Action:     "allow_config",
+				ConfigPath: configFilePath,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to allow config: %v", err)
+			}
+
+			if !resp.Success {
+				return fmt.Errorf("failed to allow config: %s", resp.Error)
+			}
+
+			fmt.Printf("Allowed %s\n", configFilePath)
+			for i := 0; ; i++ {
+				source, ok := resp.Data[fmt.Sprintf("source.%d", i)]
+				if !ok {
+					break
+				}
+				if source != configFilePath {
+					fmt.Printf("  including %s\n", source)
+				}
+			}
+			if project, ok := resp.Data["project"]; ok {
+				fmt.Printf("Configs of %s signed by a trusted key are trusted from now on\n", project)
+			}
+			return nil
+		},
+	}
+
+	// Create deny command
+	denyCmd := &cobra.Command{
+		Use:   "deny [path]",
+		Short: "Stop trusting a .imbued config",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setupDefaultPaths(); err != nil {
+				return err
+			}
+
+			configFilePath, err := configPathArg(args)
+			if err != nil {
+				return err
+			}
+
+			resp, err := runClient(socketPath, Command{
+				Action:     "deny_config",
+				ConfigPath: configFilePath,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to deny config: %v", err)
+			}
+
+			if !resp.Success {
+				return fmt.Errorf("failed to deny config: %s", resp.Error)
+			}
+
+			fmt.Printf("Denied %s\n", configFilePath)
+			return nil
+		},
+	}
 
 	// Create credentials command
 	credentialsCmd := &cobra.Command{
 		Use:   "credentials",
 		Short: "Commands for managing backend credentials",
-		Long:  `Commands for managing backend credentials, such as setting and clearing 1Password credentials.`,
+		Long:  `Commands for managing backend credentials, such as the values configs refer to as keychain:<name>, and 1Password credentials.`,
 	}
 
 	// Create set-onepass-credentials command
@@ -1341,7 +2181,40 @@ func main() {
 		},
 	}
 
+	// Create set command, storing the value of a keychain: reference
+	setCredentialCmd := &cobra.Command{
+		Use:   "set <name> [path]",
+		Short: "Store the value a config refers to as keychain:<name>",
+		Long: `Store the value of a backend option a config refers to as "keychain:<name>",
+such as the credentials imbued config migrate moves out of the file. Values
+are stored for the config at path (by default the one of the current
+directory), so set them again after moving the project.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configFilePath, err := localConfigPathArg(args[1:])
+			if err != nil {
+				return err
+			}
+
+			value, err := secrets.PromptForSecureInput(fmt.Sprintf("Value of %s: ", args[0]))
+			if err != nil {
+				return fmt.Errorf("failed to read value: %v", err)
+			}
+			if value == "" {
+				return fmt.Errorf("value can't be empty")
+			}
+
+			reference, err := secrets.StoreReference(configFilePath, args[0], value)
+			if err != nil {
+				return fmt.Errorf("failed to store %s: %v", args[0], err)
+			}
+			fmt.Printf("Stored the value of %q for %s\n", reference, configFilePath)
+			return nil
+		},
+	}
+
 	// Add credential commands
+	credentialsCmd.AddCommand(setCredentialCmd)
 	credentialsCmd.AddCommand(setOnePassCredentialsCmd)
 	credentialsCmd.AddCommand(checkOnePassCredentialsCmd)
 	credentialsCmd.AddCommand(clearOnePassCredentialsCmd)
@@ -1350,6 +2223,11 @@ func main() {
 	rootCmd.AddCommand(serverCmd)
 	rootCmd.AddCommand(clientCmd)
 	rootCmd.AddCommand(credentialsCmd)
+	rootCmd.AddCommand(allowCmd)
+	rootCmd.AddCommand(denyCmd)
+	rootCmd.AddCommand(newConfigCmd())
+	rootCmd.AddCommand(newImportCmd())
+	rootCmd.AddCommand(newInitCmd())
 
 	// Execute root command
 	if err := rootCmd.Execute(); err != nil {
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/novacove/imbued/pkg/auth"
+	"github.com/novacove/imbued/pkg/config"
+	"github.com/novacove/imbued/pkg/tracking"
+	"github.com/novacove/imbued/pkg/trust"
+)
+
+// TestMain runs the imbued command instead of the tests when the test binary
+// is started by runImbued
+func TestMain(m *testing.M) {
+	if os.Getenv("IMBUED_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// testServer is a server answering on a socket of its own
+type testServer struct {
+	socketPath string
+	home       string // Home directory of the server and its clients
+	trustStore *trust.Store
+}
+
+// startTestServer starts a server serving connections until the test ends
+func startTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	// Socket paths are limited to about a hundred bytes
+	socketDir, err := os.MkdirTemp("", "imbued")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(socketDir) })
+
+	server := &testServer{
+		socketPath: filepath.Join(socketDir, "imbued.sock"),
+		home:       t.TempDir(),
+	}
+	server.trustStore = trust.NewStore(filepath.Join(server.home, "trust.json"))
+
+	// The root command loads the global config, which the tests don't run
+	if globalConfig == nil {
+		if globalConfig, err = config.DefaultGlobalConfig(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tracker, err := tracking.NewFileTracker(filepath.Join(server.home, "access.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator := auth.NewSimpleAuthenticator(time.Minute)
+	res := newTestResolver(t)
+	profiles := newProfileStore(time.Minute)
+	policy := &trustPolicy{store: server.trustStore, trustedKeysPath: filepath.Join(server.home, "trusted_keys"), trustSigned: true}
+
+	listener, err := net.Listen("unix", server.socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handleConnection(conn, tracker, authenticator, res, profiles, policy)
+		}
+	}()
+
+	return server
+}
+
+// allow trusts the config at configPath in its current form
+func (s *testServer) allow(t *testing.T, configPath string) {
+	t.Helper()
+	sources, err := config.Sources(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := trust.HashFiles(sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.trustStore.Allow(configPath, hash); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// runImbued runs imbued with the given arguments in dir, against the server,
+// and returns its combined output and exit status
+func (s *testServer) runImbued(t *testing.T, dir string, args ...string) (string, int) {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], append(args, "--socket", s.socketPath)...)
+	cmd.Dir = dir
+	cmd.Env = s.environ()
+	return run(t, cmd)
+}
+
+// environ returns the environment of commands run against the server, in
+// which the test binary runs imbued
+func (s *testServer) environ() []string {
+	return append(os.Environ(),
+		"IMBUED_TEST_MAIN=1",
+		"HOME="+s.home,
+		"XDG_CONFIG_HOME="+filepath.Join(s.home, ".config"),
+		"XDG_CONFIG_DIRS="+filepath.Join(s.home, "xdg"),
+	)
+}
+
+// run runs cmd and returns its combined output and exit status
+func run(t *testing.T, cmd *exec.Cmd) (string, int) {
+	t.Helper()
+
+	output, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(output), exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatalf("failed to run %s: %v", cmd.Path, err)
+	}
+	return string(output), 0
+}
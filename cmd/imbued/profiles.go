@@ -0,0 +1,216 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/novacove/imbued/pkg/config"
+	"github.com/novacove/imbued/pkg/tracking"
+)
+
+// profileKey identifies a shell session's view of a config
+type profileKey struct {
+	processID  string
+	configPath string
+}
+
+// profileSelection is the profile a session uses for a config
+type profileSelection struct {
+	profile   string
+	automatic bool      // Selected by a profile rule rather than `imbued client use`
+	reason    string    // Why a profile rule selected the profile
+	lastUsed  time.Time // Last time the session used the selection
+}
+
+// profileStore remembers the profile each shell session selected for each
+// config, either with `imbued client use` or through the config's profile
+// rules. Sessions are identified by the shell's process ID, so selections
+// expire once unused for the session timeout, before the ID of an exited
+// shell can be handed to a new one.
+type profileStore struct {
+	mu         sync.Mutex
+	selections map[profileKey]profileSelection
+	timeout    time.Duration
+}
+
+// newProfileStore creates an empty profile store whose selections expire
+// after being unused for timeout
+func newProfileStore(timeout time.Duration) *profileStore {
+	return &profileStore{selections: make(map[profileKey]profileSelection), timeout: timeout}
+}
+
+// Get returns the profile the session uses for the config, or an empty
+// string if it uses the config as is
+func (s *profileStore) Get(processID, configPath string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := profileKey{processID, configPath}
+	selection, ok := s.lookupLocked(key)
+	if ok {
+		selection.lastUsed = time.Now()
+		s.selections[key] = selection
+	}
+	return selection.profile
+}
+
+// Reason returns why the session's profile for the config was selected, or
+// an empty string if it was selected explicitly or there is none
+func (s *profileStore) Reason(processID, configPath string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	selection, _ := s.lookupLocked(profileKey{processID, configPath})
+	return selection.reason
+}
+
+// lookupLocked returns the selection of a session, dropping it if it has
+// expired. The caller must hold s.mu.
+func (s *profileStore) lookupLocked(key profileKey) (profileSelection, bool) {
+	selection, ok := s.selections[key]
+	if ok && s.timeout > 0 && time.Since(selection.lastUsed) > s.timeout {
+		delete(s.selections, key)
+		return profileSelection{}, false
+	}
+	return selection, ok
+}
+
+// pruneLocked drops the expired selections of every session. The caller
+// must hold s.mu.
+func (s *profileStore) pruneLocked() {
+	for key := range s.selections {
+		s.lookupLocked(key)
+	}
+}
+
+// Set selects a profile for the session and config and returns the
+// previously selected one. An empty profile clears the selection and lets
+// profile rules apply again.
+func (s *profileStore) Set(processID, configPath, profile string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pruneLocked()
+
+	key := profileKey{processID, configPath}
+	previous := s.selections[key].profile
+	if profile == "" {
+		delete(s.selections, key)
+	} else {
+		s.selections[key] = profileSelection{profile: profile, lastUsed: time.Now()}
+	}
+	return previous
+}
+
+// SetAutomatic records the profile selected by a profile rule, unless the
+// session selected a profile explicitly. An empty profile clears a previous
+// automatic selection. It reports whether the selection was recorded.
+func (s *profileStore) SetAutomatic(processID, configPath, profile, reason string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pruneLocked()
+
+	key := profileKey{processID, configPath}
+	if selection, ok := s.selections[key]; ok && !selection.automatic {
+		return false
+	}
+
+	if profile == "" {
+		delete(s.selections, key)
+	} else {
+		s.selections[key] = profileSelection{profile: profile, automatic: true, reason: reason, lastUsed: time.Now()}
+	}
+	return true
+}
+
+// applyProfileRules evaluates the profile rules of the command's config and
+// records the selected profile for the session. Rules never override a
+// profile the session or the command selected explicitly.
+func applyProfileRules(cmd Command, profiles *profileStore, tracker tracking.Tracker) {
+	if cmd.Profile != "" || cmd.ConfigPath == "" {
+		return
+	}
+
+	cfg, err := config.LoadConfig(cmd.ConfigPath, globalConfig.Defaults())
+	if err != nil || len(cfg.ProfileRules) == 0 {
+		// Load errors are reported by the command's handler
+		return
+	}
+
+	profile, reason := cfg.SelectProfile(ruleContext(cmd))
+	if !profiles.SetAutomatic(cmd.ProcessID, cmd.ConfigPath, profile, reason) || profile == "" {
+		return
+	}
+
+	log.Printf("Selected profile %s for %s: %s", profile, cmd.ConfigPath, reason)
+	if err := tracker.TrackProfileSelection(cmd.ProcessID, cmd.ConfigPath, profile, reason); err != nil {
+		log.Printf("Failed to track profile selection: %v", err)
+	}
+}
+
+// ruleContext gathers the facts profile rules are matched against. The
+// server runs on the same machine and as the same user as the shell, but the
+// shell's environment is only known from the names the client sends.
+func ruleContext(cmd Command) config.RuleContext {
+	ctx := config.RuleContext{
+		Branch: gitBranch(filepath.Dir(cmd.ConfigPath)),
+		Env:    make(map[string]bool, len(cmd.EnvNames)),
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		ctx.Hostname = hostname
+	}
+	if current, err := user.Current(); err == nil {
+		ctx.User = current.Username
+	}
+	for _, name := range cmd.EnvNames {
+		ctx.Env[name] = true
+	}
+
+	return ctx
+}
+
+// gitBranch returns the branch checked out in the git repository containing
+// dir, or an empty string if there is none or HEAD is detached
+func gitBranch(dir string) string {
+	for {
+		gitPath := filepath.Join(dir, ".git")
+		if info, err := os.Stat(gitPath); err == nil {
+			gitDir := gitPath
+			if !info.IsDir() {
+				// Worktrees and submodules point to their git directory
+				data, err := os.ReadFile(gitPath)
+				if err != nil {
+					return ""
+				}
+				gitDir = strings.TrimSpace(strings.TrimPrefix(string(data), "gitdir:"))
+				if !filepath.IsAbs(gitDir) {
+					gitDir = filepath.Join(dir, gitDir)
+				}
+			}
+
+			head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+			if err != nil {
+				return ""
+			}
+			branch, ok := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: refs/heads/")
+			if !ok {
+				// Detached HEAD
+				return ""
+			}
+			return branch
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProfileStoreExpiry(t *testing.T) {
+	store := newProfileStore(time.Hour)
+	store.Set("100", "/src/app/.imbued", "staging")
+	store.SetAutomatic("200", "/src/app/.imbued", "production", "branch main")
+
+	// Make the first session's selection look unused for longer than the timeout
+	store.mu.Lock()
+	key := profileKey{"100", "/src/app/.imbued"}
+	selection := store.selections[key]
+	selection.lastUsed = time.Now().Add(-2 * time.Hour)
+	store.selections[key] = selection
+	store.mu.Unlock()
+
+	if got := store.Get("100", "/src/app/.imbued"); got != "" {
+		t.Errorf("Get() of an expired selection = %q, want none", got)
+	}
+	if got := store.Get("200", "/src/app/.imbued"); got != "production" {
+		t.Errorf("Get() = %q, want production", got)
+	}
+	if got := store.Reason("200", "/src/app/.imbued"); got != "branch main" {
+		t.Errorf("Reason() = %q, want branch main", got)
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/novacove/imbued/pkg/cache"
+	"github.com/novacove/imbued/pkg/config"
+	"github.com/novacove/imbued/pkg/secrets"
+	"github.com/novacove/imbued/pkg/snapshot"
+)
+
+const (
+	// sourceCache is the source of values served from the in-memory cache
+	sourceCache = "cache"
+	// sourceSnapshot is the source of values served from the offline snapshot
+	sourceSnapshot = "offline snapshot"
+)
+
+// resolver resolves secret values for the server's handlers, combining the
+// backend pool, the in-memory cache and the offline snapshots
+type resolver struct {
+	pool      *secrets.Pool
+	cache     *cache.Cache
+	snapshots *snapshot.Store
+}
+
+// resolution is the result of resolving a set of secrets
+type resolution struct {
+	// Values holds the resolved value of each secret
+	Values map[string]string
+	// Errors holds the error for each secret that could not be resolved
+	Errors map[string]error
+	// Offline holds the fetch time of each secret served from the offline snapshot
+	Offline map[string]time.Time
+	// Sources holds where each resolved value came from: a backend name, the
+	// cache or the offline snapshot
+	Sources map[string]string
+	// BackendErr is set when a backend itself could not be obtained
+	BackendErr error
+}
+
+// configVersion returns a version stamp for a config, used to discard cached
+// values resolved for an older revision of any of the files it is merged from
+func configVersion(cfg *config.ImbuedConfig) string {
+	stamps := make([]string, 0, len(cfg.Layers))
+	for _, layer := range cfg.Layers {
+		info, err := os.Stat(layer)
+		if err != nil {
+			return ""
+		}
+		stamps = append(stamps, info.ModTime().String())
+	}
+	return strings.Join(stamps, "|")
+}
+
+// cacheName returns the name a secret is cached under. Values are qualified
+// by the config's profile so that profiles never share cached values, while
+// still being flushed together with the config.
+func cacheName(cfg *config.ImbuedConfig, secretName string) string {
+	if cfg.Profile == "" {
+		return secretName
+	}
+	return cfg.Profile + "/" + secretName
+}
+
+// snapshotKey returns the key of the offline snapshot of a config, with one
+// snapshot per profile
+func snapshotKey(configPath string, cfg *config.ImbuedConfig) string {
+	if cfg.Profile == "" {
+		return configPath
+	}
+	return configPath + "#" + cfg.Profile
+}
+
+// resolve resolves the given secrets for a config. Values are served from the
+// cache where possible and fetched from the backend pool otherwise. Each
+// secret is looked up in its chain of backends in order until one has it,
+// querying every backend involved concurrently. When the backends fail and
+// the config opts in, the last snapshotted values are used.
+func (r *resolver) resolve(ctx context.Context, configPath string, cfg *config.ImbuedConfig, secretNames []string) *resolution {
+	res := &resolution{
+		Values:  make(map[string]string, len(secretNames)),
+		Errors:  make(map[string]error),
+		Offline: make(map[string]time.Time),
+		Sources: make(map[string]string),
+	}
+	version := configVersion(cfg)
+
+	misses := make([]string, 0, len(secretNames))
+	for _, secretName := range secretNames {
+		if value, ok := r.cache.Get(configPath, version, cacheName(cfg, secretName)); ok {
+			res.Values[secretName] = value
+			res.Sources[secretName] = sourceCache
+			continue
+		}
+		misses = append(misses, secretName)
+	}
+
+	if len(misses) == 0 {
+		return res
+	}
+
+	// Look up the chain of backends of each remaining secret
+	chains := make(map[string][]*config.Backend, len(misses))
+	for _, secretName := range misses {
+		backends, err := cfg.BackendsFor(secretName)
+		if err != nil {
+			res.Errors[secretName] = err
+			continue
+		}
+		chains[secretName] = backends
+	}
+
+	// Walk the chains in rounds: each round asks every secret's next backend,
+	// fanning out to all backends involved concurrently
+	fetched := make(map[string]string)
+	position := make(map[string]int, len(chains))
+	for len(chains) > 0 {
+		groups := make(map[*config.Backend][]string)
+		for secretName, backends := range chains {
+			backend := backends[position[secretName]]
+			groups[backend] = append(groups[backend], secretName)
+		}
+
+		var (
+			mu sync.Mutex
+			wg sync.WaitGroup
+		)
+		for backend, names := range groups {
+			wg.Add(1)
+			go func(backend *config.Backend, names []string) {
+				defer wg.Done()
+
+				values, errs, err := r.fetch(ctx, configPath, cfg, backend, names)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil && res.BackendErr == nil {
+					res.BackendErr = err
+				}
+				for secretName, value := range values {
+					fetched[secretName] = value
+					res.Sources[secretName] = backend.Name
+					delete(res.Errors, secretName)
+					delete(chains, secretName)
+				}
+				for secretName, err := range errs {
+					// Keep the most useful error: a failing backend beats a missing secret
+					if prev, ok := res.Errors[secretName]; !ok || errors.Is(prev, secrets.ErrSecretNotFound) {
+						res.Errors[secretName] = err
+					}
+					position[secretName]++
+					if position[secretName] == len(chains[secretName]) {
+						delete(chains, secretName)
+					}
+				}
+			}(backend, names)
+		}
+		wg.Wait()
+	}
+
+	for secretName, value := range fetched {
+		res.Values[secretName] = value
+		if err := r.cache.Set(configPath, version, cacheName(cfg, secretName), value, cfg.CacheTTLFor(secretName)); err != nil {
+			log.Printf("Failed to cache secret %s: %v", secretName, err)
+		}
+	}
+
+	if cfg.OfflineSnapshot && len(fetched) > 0 {
+		if err := r.snapshots.Save(snapshotKey(configPath, cfg), fetched); err != nil {
+			log.Printf("Failed to save offline snapshot: %v", err)
+		}
+	}
+
+	if cfg.OfflineSnapshot {
+		r.applySnapshot(configPath, cfg, res)
+	}
+
+	return res
+}
+
+// fetch fetches secrets from a single backend of the config. If the backend
+// can't be obtained, every secret fails with that error and it is also
+// returned on its own. The json_key and transform of each secret's entry are
+// applied to the fetched values.
+func (r *resolver) fetch(ctx context.Context, configPath string, cfg *config.ImbuedConfig, backendDef *config.Backend, secretNames []string) (map[string]string, map[string]error, error) {
+	// Get an initialized secret backend from the pool
+	backend, release, err := r.pool.Acquire(ctx, configPath, backendDef.Source, backendDef.Type, backendDef.Config, backendDef.Policy)
+	if err != nil {
+		err = fmt.Errorf("failed to get secret backend %s: %w", backendDef.Name, err)
+		errs := make(map[string]error, len(secretNames))
+		for _, secretName := range secretNames {
+			errs[secretName] = err
+		}
+		return nil, errs, err
+	}
+	defer release()
+
+	// Secrets that read a specific field of an item are fetched one by one,
+	// the others are batched when the backend supports it. Secrets are
+	// fetched by their name in the backend, which several may share.
+	var batched, fields []string
+	byName := make(map[string][]string)
+	for _, secretName := range secretNames {
+		if cfg.Secrets[secretName].Field != "" {
+			fields = append(fields, secretName)
+			continue
+		}
+		name := cfg.BackendName(secretName)
+		if _, ok := byName[name]; !ok {
+			batched = append(batched, name)
+		}
+		byName[name] = append(byName[name], secretName)
+	}
+
+	fetched, fetchErrs := secrets.GetSecrets(ctx, backend, batched, secrets.DefaultBatchParallelism)
+	values := make(map[string]string, len(secretNames))
+	errs := make(map[string]error)
+	for name, sharing := range byName {
+		for _, secretName := range sharing {
+			if value, ok := fetched[name]; ok {
+				values[secretName] = value
+			} else if err, ok := fetchErrs[name]; ok {
+				errs[secretName] = err
+			}
+		}
+	}
+	for _, secretName := range fields {
+		value, err := secrets.GetSecretField(ctx, backend, cfg.BackendName(secretName), cfg.Secrets[secretName].Field)
+		if err != nil {
+			errs[secretName] = err
+			continue
+		}
+		values[secretName] = value
+	}
+
+	for secretName, value := range values {
+		processed, err := cfg.Secrets[secretName].Process(value)
+		if err != nil {
+			delete(values, secretName)
+			errs[secretName] = fmt.Errorf("failed to process secret %s: %w", secretName, err)
+			continue
+		}
+		values[secretName] = processed
+	}
+
+	return values, errs, nil
+}
+
+// applySnapshot replaces backend failures with snapshotted values. Secrets
+// that the backend reported as missing are not replaced.
+func (r *resolver) applySnapshot(configPath string, cfg *config.ImbuedConfig, res *resolution) {
+	failed := make([]string, 0, len(res.Errors))
+	for secretName, err := range res.Errors {
+		if !errors.Is(err, secrets.ErrSecretNotFound) {
+			failed = append(failed, secretName)
+		}
+	}
+
+	if len(failed) == 0 {
+		return
+	}
+
+	snapshotted, err := r.snapshots.Load(snapshotKey(configPath, cfg), failed, cfg.OfflineMaxStaleness)
+	if err != nil {
+		log.Printf("Failed to load offline snapshot: %v", err)
+		return
+	}
+
+	for secretName, value := range snapshotted {
+		res.Values[secretName] = value.Value
+		res.Offline[secretName] = value.FetchedAt
+		res.Sources[secretName] = sourceSnapshot
+		delete(res.Errors, secretName)
+	}
+}
+
+// renderTemplate renders a templated variable from the resolved secrets. It
+// fails if any secret the template references was not resolved.
+func renderTemplate(tmpl *config.Template, res *resolution) (string, error) {
+	for _, dep := range tmpl.Dependencies {
+		if err, ok := res.Errors[dep]; ok {
+			return "", fmt.Errorf("secret %s was not resolved: %w", dep, err)
+		}
+	}
+	return tmpl.Render(res.Values)
+}
+
+// warnings returns a human readable warning for each secret served from the offline snapshot
+func (res *resolution) warnings() []string {
+	names := res.offlineNames()
+	warnings := make([]string, 0, len(names))
+	for _, secretName := range names {
+		age := time.Since(res.Offline[secretName]).Round(time.Second)
+		warnings = append(warnings, fmt.Sprintf("%s served from offline snapshot (backend unavailable, value is %s old)", secretName, age))
+	}
+	return warnings
+}
+
+// offlineNames returns the sorted names of the secrets served from the offline snapshot
+func (res *resolution) offlineNames() []string {
+	names := make([]string, 0, len(res.Offline))
+	for secretName := range res.Offline {
+		names = append(names, secretName)
+	}
+	sort.Strings(names)
+	return names
+}
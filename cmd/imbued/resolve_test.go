@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/novacove/imbued/pkg/cache"
+	"github.com/novacove/imbued/pkg/config"
+	"github.com/novacove/imbued/pkg/secrets"
+	"github.com/novacove/imbued/pkg/snapshot"
+)
+
+// newTestResolver returns a resolver with its own pool, cache and snapshots
+func newTestResolver(t *testing.T) *resolver {
+	t.Helper()
+	pool := secrets.NewPool(time.Minute)
+	secretCache := cache.New()
+	t.Cleanup(func() {
+		pool.Close()
+		secretCache.Close()
+	})
+
+	key := bytes.Repeat([]byte{1}, 32)
+	return &resolver{
+		pool:  pool,
+		cache: secretCache,
+		snapshots: snapshot.NewStore(t.TempDir(), func() ([]byte, error) {
+			return key, nil
+		}),
+	}
+}
+
+func TestResolveChainOrder(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"local.env":  "SHARED=local\nLOCAL=local\nREVERSED=local\n",
+		"shared.env": "SHARED=shared\nREMOTE=shared\nREVERSED=shared\nFALLBACK=shared\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configPath := filepath.Join(dir, ".imbued")
+	data := fmt.Sprintf(`default_backend = ["local", "shared"]
+
+[backends.local]
+type = "env_file"
+config = { file_path = %[1]q }
+
+[backends.shared]
+type = "env_file"
+config = { file_path = %[2]q }
+
+[backends.broken]
+type = "env_file"
+config = { file_path = %[3]q }
+policy = { retries = 0 }
+
+[secrets]
+SHARED = "SHARED"
+LOCAL = "LOCAL"
+REMOTE = "REMOTE"
+MISSING = "MISSING"
+REVERSED = "REVERSED"
+FALLBACK = "FALLBACK"
+
+[secret_backends]
+REVERSED = ["shared", "local"]
+FALLBACK = ["broken", "shared"]
+`, filepath.Join(dir, "local.env"), filepath.Join(dir, "shared.env"), filepath.Join(dir, "missing.env"))
+	if err := os.WriteFile(configPath, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.LoadConfig(configPath, config.BuiltinDefaults())
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		secret string
+		value  string
+		source string
+		err    error
+	}{
+		{secret: "SHARED", value: "local", source: "local"},
+		{secret: "LOCAL", value: "local", source: "local"},
+		{secret: "REMOTE", value: "shared", source: "shared"},
+		{secret: "REVERSED", value: "shared", source: "shared"},
+		{secret: "MISSING", err: secrets.ErrSecretNotFound},
+		{secret: "FALLBACK", value: "shared", source: "shared"},
+	}
+
+	res := newTestResolver(t).resolve(context.Background(), configPath, cfg, []string{"SHARED", "LOCAL", "REMOTE", "REVERSED", "MISSING", "FALLBACK"})
+	for _, tt := range tests {
+		t.Run(tt.secret, func(t *testing.T) {
+			if tt.err != nil {
+				if err := res.Errors[tt.secret]; !errors.Is(err, tt.err) {
+					t.Errorf("error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if res.Values[tt.secret] != tt.value || res.Sources[tt.secret] != tt.source {
+				t.Errorf("resolved %q from %q, want %q from %q (error %v)", res.Values[tt.secret], res.Sources[tt.secret], tt.value, tt.source, res.Errors[tt.secret])
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/novacove/imbued/pkg/config"
+	"github.com/novacove/imbued/pkg/secrets"
+	"github.com/spf13/cobra"
+)
+
+// globalConfig holds the user's settings, loaded before any command runs
+var globalConfig *config.GlobalConfig
+
+// loadGlobalConfig loads the user's global config and uses it for the flags
+// that weren't given on the command line
+func loadGlobalConfig(cmd *cobra.Command) error {
+	var err error
+	globalConfig, err = config.LoadGlobalConfig()
+	if err != nil {
+		return err
+	}
+
+	for _, setting := range globalSettings() {
+		if !flagChanged(cmd, setting.flag) && setting.apply != nil {
+			setting.apply()
+		}
+	}
+
+	return nil
+}
+
+// flagChanged reports whether a flag of the command was given on the command line
+func flagChanged(cmd *cobra.Command, name string) bool {
+	if name == "" {
+		return false
+	}
+	flag := cmd.Flags().Lookup(name)
+	return flag != nil && flag.Changed
+}
+
+// globalSetting is a setting of the global config, and the flag overriding it
+type globalSetting struct {
+	key   string             // Dotted key in the global config
+	flag  string             // Flag overriding the setting, if any
+	value func() interface{} // Effective value of the setting
+	apply func()             // Sets the flag's variable from the global config
+}
+
+// globalSettings returns the settings of the global config, in the order
+// they are shown
+func globalSettings() []globalSetting {
+	return []globalSetting{
+		{"server.socket", "socket", func() interface{} { return socketPath }, func() { socketPath = globalConfig.Socket }},
+		{"server.auth_duration", "auth-duration", func() interface{} { return authDuration }, func() { authDuration = globalConfig.AuthDuration }},
+		{"server.backend_idle_timeout", "backend-idle-timeout", func() interface{} { return backendIdleTimeout }, func() { backendIdleTimeout = globalConfig.BackendIdleTimeout }},
+		{"server.trust_signed_configs", "trust-signed-configs", func() interface{} { return trustSigned }, func() { trustSigned = globalConfig.TrustSignedConfigs }},
+		{"client.max_levels", "max-levels", func() interface{} { return maxLevels }, func() { maxLevels = globalConfig.MaxLevels }},
+		{"log.level", "", func() interface{} { return strings.ToLower(globalConfig.LogLevel.String()) }, nil},
+		{"log.file", "", func() interface{} { return globalConfig.LogFile }, nil},
+		{"log.access_file", "log-file", func() interface{} { return logFile }, func() { logFile = globalConfig.AccessLogFile }},
+	}
+}
+
+// printEffectiveConfig prints the settings in effect for the command, as a
+// global config file noting where each value comes from
+func printEffectiveConfig(cmd *cobra.Command) {
+	source := func(key, flag string) string {
+		switch {
+		case flagChanged(cmd, flag):
+			return "--" + flag
+		case globalConfig.IsSet(key):
+			return globalConfig.Path
+		default:
+			return "default"
+		}
+	}
+
+	table := ""
+	for _, setting := range globalSettings() {
+		name, key, _ := strings.Cut(setting.key, ".")
+		if name != table {
+			if table != "" {
+				fmt.Println()
+			}
+			fmt.Printf("[%s]\n", name)
+			table = name
+		}
+		fmt.Printf("%s = %s # %s\n", key, formatSetting(setting.value()), source(setting.key, setting.flag))
+	}
+
+	fmt.Println()
+	fmt.Println("[defaults]")
+	if backend := globalConfig.DefaultBackend; backend != nil {
+		fmt.Printf("backend_type = %q # %s\n", backend.Type, globalConfig.Path)
+		if len(backend.Config) > 0 {
+			names := make([]string, 0, len(backend.Config))
+			for name := range backend.Config {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			options := make([]string, 0, len(names))
+			for _, name := range names {
+				value := backend.Config[name]
+				if secrets.IsCredential(backend.Type, name) && !secrets.IsReference(value) {
+					value = "<redacted>"
+				}
+				options = append(options, fmt.Sprintf("%s = %q", name, value))
+			}
+			fmt.Printf("backend_config = { %s } # %s\n", strings.Join(options, ", "), globalConfig.Path)
+		}
+	} else {
+		fmt.Println("# backend_type is not set, configs must declare their own backend")
+	}
+
+	policy := globalConfig.DefaultPolicy
+	fmt.Println()
+	fmt.Println("[defaults.backend_policy]")
+	policySettings := []struct {
+		key   string
+		value interface{}
+	}{
+		{"timeout", policy.Timeout},
+		{"retries", policy.Retries},
+		{"backoff", policy.Backoff},
+		{"breaker_threshold", policy.BreakerThreshold},
+		{"breaker_cooldown", policy.BreakerCooldown},
+	}
+	for _, setting := range policySettings {
+		fmt.Printf("%s = %s # %s\n", setting.key, formatSetting(setting.value), source("defaults.backend_policy."+setting.key, ""))
+	}
+}
+
+// formatSetting formats a setting as a TOML value
+func formatSetting(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case time.Duration:
+		return fmt.Sprintf("%q", v.String())
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEffectiveConfig(t *testing.T) {
+	server := startTestServer(t)
+
+	globalPath := filepath.Join(server.home, ".config", "imbued", "config.toml")
+	if err := os.MkdirAll(filepath.Dir(globalPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data := `[server]
+auth_duration = "15m"
+
+[client]
+max_levels = 5
+`
+	if err := os.WriteFile(globalPath, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "global config over the defaults",
+			want: []string{
+				`auth_duration = "15m0s" # ` + globalPath,
+				"max_levels = 5 # " + globalPath,
+				`backend_idle_timeout = "10m0s" # default`,
+			},
+		},
+		{
+			name: "flags over the global config",
+			args: []string{"--max-levels", "2", "--auth-duration", "1m"},
+			want: []string{
+				`auth_duration = "1m0s" # --auth-duration`,
+				"max_levels = 2 # --max-levels",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"config", "show", "--effective"}, tt.args...)
+			output, status := server.runImbued(t, server.home, args...)
+			if status != 0 {
+				t.Fatalf("config show exited with %d: %s", status, output)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(output, want) {
+					t.Errorf("config show output lacks %q:\n%s", want, output)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/novacove/imbued/pkg/config"
+	"github.com/novacove/imbued/pkg/secrets"
+	"github.com/novacove/imbued/pkg/trust"
+)
+
+// codeConfigUntrusted is the response code of commands refused because the
+// config has not been allowed, or has changed since it was allowed
+const codeConfigUntrusted = "config_untrusted"
+
+// untrustedActions are the only actions served for configs that haven't
+// been allowed: they manage the trust store, find configs, or read no more
+// than the names of a config's variables. Every other action loads the
+// config and may initialize its backends, so it is refused until the config
+// is allowed. clean_env stays available so that shells can drop the values
+// of a config that changed after it was injected.
+var untrustedActions = map[string]bool{
+	"allow_config": true,
+	"deny_config":  true,
+	"check_auth":   true,
+	"find_config":  true,
+	"flush_cache":  true,
+	"clean_env":    true,
+}
+
+// trustPolicy decides which configs the server may read secrets and values for
+type trustPolicy struct {
+	store           *trust.Store
+	trustedKeysPath string // File listing the team signing keys
+	trustSigned     bool   // Whether configs signed by a trusted key need no imbued allow
+}
+
+// getTrustStorePath returns the path of the file recording allowed configs
+func getTrustStorePath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %v", err)
+	}
+
+	return filepath.Join(homeDir, ".imbued", "trust.json"), nil
+}
+
+// getTrustedKeysPath returns the path of the file listing trusted team signing keys
+func getTrustedKeysPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %v", err)
+	}
+
+	return filepath.Join(homeDir, ".imbued", "trusted_keys"), nil
+}
+
+// getSigningKeyPath returns the default path of the user's own signing key
+func getSigningKeyPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %v", err)
+	}
+
+	return filepath.Join(homeDir, ".imbued", "signing_key"), nil
+}
+
+// checkTrust returns an error explaining why a config can't be used if it
+// has neither been allowed in its current form nor, when the policy permits
+// it, signed by a trusted key. A denied config is refused even if signed.
+func (p *trustPolicy) checkTrust(configPath string) error {
+	sources, err := config.Sources(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %v", err)
+	}
+
+	hash, err := trust.HashFiles(sources)
+	if err != nil {
+		return fmt.Errorf("failed to hash config: %v", err)
+	}
+
+	status, err := p.store.Status(configPath, hash)
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case trust.StatusAllowed:
+		return nil
+	case trust.StatusDenied:
+		return fmt.Errorf("%s is denied, run `imbued allow` to trust it", configPath)
+	}
+
+	// Configs signed by the team are trusted without a manual allow
+	var signatureErr error
+	if p.trustSigned {
+		signatureErr = p.checkSignatures(sources)
+		if signatureErr == nil {
+			return nil
+		}
+	}
+
+	var reason string
+	if status == trust.StatusModified {
+		reason = fmt.Sprintf("%s has changed since it was allowed, review it and run `imbued allow` to trust it again", configPath)
+	} else {
+		reason = fmt.Sprintf("%s is not allowed yet, review it and run `imbued allow` to trust it", configPath)
+	}
+	if signatureErr != nil && !errors.Is(signatureErr, trust.ErrNotSigned) {
+		reason += fmt.Sprintf(" (signature check failed: %v)", signatureErr)
+	}
+	return errors.New(reason)
+}
+
+// checkSignatures verifies that every file of a config is signed by a
+// trusted key, in a project the user allowed a config of. Signatures only
+// cover the path of a file in its project, so a signed file copied to
+// another project would verify there too.
+func (p *trustPolicy) checkSignatures(sources []string) error {
+	keys, err := trust.LoadTrustedKeys(p.trustedKeysPath)
+	if err != nil {
+		return err
+	}
+
+	for _, source := range sources {
+		if _, err := verifySignature(source, keys); err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+
+		root, err := config.ProjectRoot(source)
+		if err != nil {
+			return err
+		}
+		allowed, err := p.store.ProjectAllowed(root)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return fmt.Errorf("signatures in %s aren't trusted until you allow one of its configs", root)
+		}
+	}
+	return nil
+}
+
+// verifySignature checks the signature of a config file, which covers its
+// path in its project
+func verifySignature(configPath string, keys []trust.TrustedKey) (trust.TrustedKey, error) {
+	projectPath, err := config.ProjectPath(configPath)
+	if err != nil {
+		// Files outside of projects can't be signed
+		if _, statErr := os.Stat(configPath + trust.SignatureSuffix); errors.Is(statErr, os.ErrNotExist) {
+			return trust.TrustedKey{}, trust.ErrNotSigned
+		}
+		return trust.TrustedKey{}, err
+	}
+	return trust.Verify(configPath, projectPath, keys)
+}
+
+// handleAllowConfig handles the allow_config command. Backends initialized
+// for an earlier form of the config are dropped.
+func handleAllowConfig(conn net.Conn, cmd Command, trustStore *trust.Store, pool *secrets.Pool) {
+	sources, err := config.Sources(cmd.ConfigPath)
+	if err != nil {
+		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to load config: %v", err)})
+		return
+	}
+
+	hash, err := trust.HashFiles(sources)
+	if err != nil {
+		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to hash config: %v", err)})
+		return
+	}
+
+	if err := trustStore.Allow(cmd.ConfigPath, hash); err != nil {
+		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to allow config: %v", err)})
+		return
+	}
+
+	data := make(map[string]string, len(sources)+1)
+	for i, source := range sources {
+		data[fmt.Sprintf("source.%d", i)] = source
+	}
+
+	// Signed configs of the project are trusted from now on. Configs outside
+	// of projects can't be signed.
+	if root, err := config.ProjectRoot(cmd.ConfigPath); err == nil {
+		if err := trustStore.AllowProject(root); err != nil {
+			sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to allow project: %v", err)})
+			return
+		}
+		data["project"] = root
+	}
+
+	pool.Invalidate(cmd.ConfigPath)
+	sendResponse(conn, Response{Success: true, Data: data})
+}
+
+// handleDenyConfig handles the deny_config command, closing the backends of
+// the config
+func handleDenyConfig(conn net.Conn, cmd Command, trustStore *trust.Store, pool *secrets.Pool) {
+	if err := trustStore.Deny(cmd.ConfigPath); err != nil {
+		sendResponse(conn, Response{Success: false, Error: fmt.Sprintf("Failed to deny config: %v", err)})
+		return
+	}
+	pool.Invalidate(cmd.ConfigPath)
+
+	sendResponse(conn, Response{Success: true})
+}
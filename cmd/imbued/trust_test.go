@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/novacove/imbued/pkg/config"
+	"github.com/novacove/imbued/pkg/trust"
+)
+
+func TestUntrustedConfig(t *testing.T) {
+	server := startTestServer(t)
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, ".imbued")
+	data := `version = 2
+[env]
+APP_ENV = "development"
+`
+	if err := os.WriteFile(configPath, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the actions that don't load the config are served before it is allowed
+	tests := []struct {
+		args    []string
+		refused bool
+	}{
+		{args: []string{"client", "check-trust"}, refused: true},
+		{args: []string{"client", "check-depth"}, refused: true},
+		{args: []string{"client", "inject-env", "--plain-only"}, refused: true},
+		{args: []string{"client", "clean-env"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			output, status := server.runImbued(t, dir, append(tt.args, "--config", configPath)...)
+			if refused := strings.Contains(output, "is not allowed yet"); refused != tt.refused || (status == 0) == tt.refused {
+				t.Errorf("exited with %d: %q, want refused = %v", status, output, tt.refused)
+			}
+		})
+	}
+
+	server.allow(t, configPath)
+	if output, status := server.runImbued(t, dir, "client", "inject-env", "--plain-only", "--config", configPath); status != 0 || !strings.Contains(output, "APP_ENV") {
+		t.Errorf("inject-env of an allowed config exited with %d: %q", status, output)
+	}
+}
+
+func TestSignedConfig(t *testing.T) {
+	server := startTestServer(t)
+
+	publicKey, err := trust.GenerateSigningKey(filepath.Join(server.home, "signing_key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := trust.LoadSigningKey(filepath.Join(server.home, "signing_key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(server.home, "trusted_keys"), []byte(publicKey+" team\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// writeSigned writes a config signed by the team at path in the project
+	writeSigned := func(root, path, data string) string {
+		t.Helper()
+		configPath := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(configPath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(configPath, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := trust.Sign(configPath, path, privateKey); err != nil {
+			t.Fatal(err)
+		}
+		return configPath
+	}
+	newProject := func() string {
+		t.Helper()
+		root := t.TempDir()
+		if err := os.WriteFile(filepath.Join(root, config.RootMarker), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return root
+	}
+	checkTrust := func(configPath string) string {
+		t.Helper()
+		output, _ := server.runImbued(t, filepath.Dir(configPath), "client", "check-trust", "--config", configPath)
+		return output
+	}
+
+	project := newProject()
+	configPath := writeSigned(project, ".imbued", "version = 2\n[env]\nAPP_ENV = \"development\"\n")
+
+	// Signatures are only honored once a config of the project is allowed
+	if output := checkTrust(configPath); !strings.Contains(output, "aren't trusted until you allow one of its configs") {
+		t.Errorf("check-trust of a signed config in a new project printed %q", output)
+	}
+	if output, status := server.runImbued(t, project, "allow", configPath); status != 0 {
+		t.Fatalf("allow exited with %d: %q", status, output)
+	}
+
+	// Later changes signed by the team need no allow
+	serviceConfig := writeSigned(project, "services/api/.imbued", "version = 2\n[env]\nAPP_ENV = \"staging\"\n")
+	if output := checkTrust(serviceConfig); !strings.Contains(output, "is allowed") {
+		t.Errorf("check-trust of a signed config in an allowed project printed %q", output)
+	}
+
+	// A config copied to another project along with its signature isn't
+	// trusted there, although its path in the project is the same
+	other := newProject()
+	copiedConfig := filepath.Join(other, "services", "api", ".imbued")
+	if err := os.MkdirAll(filepath.Dir(copiedConfig), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, suffix := range []string{"", trust.SignatureSuffix} {
+		data, err := os.ReadFile(serviceConfig + suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(copiedConfig+suffix, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if output := checkTrust(copiedConfig); !strings.Contains(output, "is not allowed yet") {
+		t.Errorf("check-trust of a signed config copied to another project printed %q", output)
+	}
+}
@@ -6,11 +6,12 @@ require (
 	github.com/BurntSushi/toml v1.5.0
 	github.com/keybase/go-keychain v0.0.1
 	github.com/spf13/cobra v1.9.1
+	golang.org/x/sys v0.32.0
 	golang.org/x/term v0.31.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.6 // indirect
-	golang.org/x/sys v0.32.0 // indirect
 )
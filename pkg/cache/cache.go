@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often expired entries are evicted
+const sweepInterval = 30 * time.Second
+
+// Cache holds resolved secret values in memory for a limited time. Values
+// are grouped by scope (the config file they were resolved for) and carry a
+// version stamp; a lookup with a different version evicts the stale value.
+// Values are stored in mlock'd buffers that are zeroed on eviction.
+// A Cache is safe for concurrent use.
+type Cache struct {
+	mu      sync.Mutex
+	entries map[entryKey]*entry
+	done    chan struct{}
+}
+
+// entryKey identifies a cached secret
+type entryKey struct {
+	scope string
+	name  string
+}
+
+// entry is a single cached secret value
+type entry struct {
+	value   *lockedBuffer
+	version string
+	expires time.Time
+}
+
+// New creates a new Cache and starts evicting expired entries in the background
+func New() *Cache {
+	c := &Cache{
+		entries: make(map[entryKey]*entry),
+		done:    make(chan struct{}),
+	}
+
+	go c.janitor()
+
+	return c
+}
+
+// Get returns the cached value of a secret, if present, unexpired and of the given version
+func (c *Cache) Get(scope, version, name string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := entryKey{scope: scope, name: name}
+	e, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+
+	if e.version != version || time.Now().After(e.expires) {
+		c.evictLocked(key, e)
+		return "", false
+	}
+
+	return e.value.String(), true
+}
+
+// Set caches the value of a secret for the given duration. A non-positive
+// ttl disables caching for the secret and evicts any existing value.
+func (c *Cache) Set(scope, version, name, value string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := entryKey{scope: scope, name: name}
+	if e, ok := c.entries[key]; ok {
+		c.evictLocked(key, e)
+	}
+
+	if ttl <= 0 {
+		return nil
+	}
+
+	buf, err := newLockedBuffer(value)
+	if err != nil {
+		return err
+	}
+
+	c.entries[key] = &entry{
+		value:   buf,
+		version: version,
+		expires: time.Now().Add(ttl),
+	}
+
+	return nil
+}
+
+// Flush evicts every cached value for the given scope, or every value if
+// scope is empty. It returns the number of values evicted.
+func (c *Cache) Flush(scope string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	flushed := 0
+	for key, e := range c.entries {
+		if scope == "" || key.scope == scope {
+			c.evictLocked(key, e)
+			flushed++
+		}
+	}
+
+	return flushed
+}
+
+// Close evicts every cached value and stops the background janitor
+func (c *Cache) Close() error {
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+
+	c.Flush("")
+	return nil
+}
+
+// evictLocked removes an entry and destroys its value. The caller must hold c.mu.
+func (c *Cache) evictLocked(key entryKey, e *entry) {
+	delete(c.entries, key)
+	e.value.Destroy()
+}
+
+// janitor periodically evicts expired entries
+func (c *Cache) janitor() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case now := <-ticker.C:
+			c.mu.Lock()
+			for key, e := range c.entries {
+				if now.After(e.expires) {
+					c.evictLocked(key, e)
+				}
+			}
+			c.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheGet(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		wait    time.Duration
+		scope   string
+		version string
+		want    bool
+	}{
+		{name: "hit", ttl: time.Minute, scope: "/app/.imbued", version: "v1", want: true},
+		{name: "other version", ttl: time.Minute, scope: "/app/.imbued", version: "v2"},
+		{name: "other scope", ttl: time.Minute, scope: "/other/.imbued", version: "v1"},
+		{name: "expired", ttl: time.Millisecond, wait: 10 * time.Millisecond, scope: "/app/.imbued", version: "v1"},
+		{name: "caching disabled", ttl: 0, scope: "/app/.imbued", version: "v1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New()
+			defer c.Close()
+
+			if err := c.Set("/app/.imbued", "v1", "DB_PASSWORD", "s3cr3t", tt.ttl); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+			time.Sleep(tt.wait)
+
+			value, ok := c.Get(tt.scope, tt.version, "DB_PASSWORD")
+			if ok != tt.want || (ok && value != "s3cr3t") {
+				t.Errorf("Get() = %q, %v, want a hit: %v", value, ok, tt.want)
+			}
+
+			// A miss for the secret's own scope evicts it
+			if !tt.want && tt.scope == "/app/.imbued" && len(c.entries) != 0 {
+				t.Errorf("Get() kept %d stale entries", len(c.entries))
+			}
+		})
+	}
+}
+
+func TestCacheWipe(t *testing.T) {
+	tests := []struct {
+		name  string
+		evict func(c *Cache)
+	}{
+		{"replaced", func(c *Cache) { c.Set("/app/.imbued", "v1", "DB_PASSWORD", "new", time.Minute) }},
+		{"disabled", func(c *Cache) { c.Set("/app/.imbued", "v1", "DB_PASSWORD", "", 0) }},
+		{"stale version", func(c *Cache) { c.Get("/app/.imbued", "v2", "DB_PASSWORD") }},
+		{"flushed scope", func(c *Cache) { c.Flush("/app/.imbued") }},
+		{"flushed", func(c *Cache) { c.Flush("") }},
+		{"closed", func(c *Cache) { c.Close() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New()
+			defer c.Close()
+
+			if err := c.Set("/app/.imbued", "v1", "DB_PASSWORD", "s3cr3t", time.Minute); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+			buf := c.entries[entryKey{scope: "/app/.imbued", name: "DB_PASSWORD"}].value
+
+			tt.evict(c)
+
+			if buf.mem != nil || buf.size != 0 {
+				t.Errorf("evicted value still holds %d bytes", buf.size)
+			}
+		})
+	}
+}
+
+func TestCacheFlush(t *testing.T) {
+	tests := []struct {
+		scope string
+		want  int
+		left  int
+	}{
+		{scope: "/app/.imbued", want: 2, left: 1},
+		{scope: "/unknown/.imbued", want: 0, left: 3},
+		{scope: "", want: 3, left: 0},
+	}
+
+	for _, tt := range tests {
+		c := New()
+		for _, key := range []entryKey{{"/app/.imbued", "A"}, {"/app/.imbued", "B"}, {"/lib/.imbued", "A"}} {
+			if err := c.Set(key.scope, "v1", key.name, "value", time.Minute); err != nil {
+				t.Fatalf("Set() error = %v", err)
+			}
+		}
+
+		if got := c.Flush(tt.scope); got != tt.want || len(c.entries) != tt.left {
+			t.Errorf("Flush(%q) = %d leaving %d, want %d leaving %d", tt.scope, got, len(c.entries), tt.want, tt.left)
+		}
+		c.Close()
+	}
+}
+
+func TestLockedBuffer(t *testing.T) {
+	for _, value := range []string{"", "s3cr3t", string(make([]byte, 5000))} {
+		buf, err := newLockedBuffer(value)
+		if err != nil {
+			t.Fatalf("newLockedBuffer() error = %v", err)
+		}
+		if got := buf.String(); got != value {
+			t.Errorf("String() = %d bytes, want %d", len(got), len(value))
+		}
+		if len(buf.mem) <= len(value) {
+			t.Errorf("buffer of %d bytes can't hold %d", len(buf.mem), len(value))
+		}
+
+		buf.Destroy()
+		buf.Destroy()
+		if buf.mem != nil || buf.String() != "" {
+			t.Error("Destroy() kept the buffer's memory")
+		}
+	}
+}
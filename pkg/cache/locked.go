@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockedBuffer is a byte buffer allocated outside the Go heap and locked into
+// memory with mlock, so that its contents are never written to swap. The
+// contents are zeroed before the memory is released.
+type lockedBuffer struct {
+	mem  []byte
+	size int
+}
+
+// newLockedBuffer allocates a locked buffer holding a copy of value
+func newLockedBuffer(value string) (*lockedBuffer, error) {
+	// mmap needs a non-zero length, and rounding to a page keeps mlock simple
+	pageSize := os.Getpagesize()
+	length := ((len(value) / pageSize) + 1) * pageSize
+
+	mem, err := unix.Mmap(-1, 0, length, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate locked memory: %w", err)
+	}
+
+	if err := unix.Mlock(mem); err != nil {
+		unix.Munmap(mem)
+		return nil, fmt.Errorf("failed to lock memory: %w", err)
+	}
+
+	copy(mem, value)
+	return &lockedBuffer{mem: mem, size: len(value)}, nil
+}
+
+// String returns a copy of the buffer contents
+func (b *lockedBuffer) String() string {
+	return string(b.mem[:b.size])
+}
+
+// Destroy zeroes the buffer and releases its memory
+func (b *lockedBuffer) Destroy() {
+	if b.mem == nil {
+		return
+	}
+
+	clear(b.mem)
+	unix.Munlock(b.mem)
+	unix.Munmap(b.mem)
+	b.mem = nil
+	b.size = 0
+}
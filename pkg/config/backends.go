@@ -0,0 +1,239 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/novacove/imbued/pkg/secrets"
+)
+
+// DefaultBackendName is the name given to the backend declared with the
+// top-level backend_type, backend_config and backend_policy keys
+const DefaultBackendName = "default"
+
+// Backend is a named secret backend declared in a config
+type Backend struct {
+	Name   string            // Name of the backend, as referenced by secrets
+	Type   string            // Type of secret backend
+	Config map[string]string // Backend-specific configuration
+	Policy secrets.Policy    // Timeouts, retries and circuit breaker settings
+	Source string            // File Config was read from
+}
+
+// backendFile is a [backends.<name>] table of a .imbued file
+type backendFile struct {
+	Type   string            `toml:"type"`
+	Config map[string]string `toml:"config"`
+	Policy policyFile        `toml:"policy"`
+
+	source string // File the table was read from
+}
+
+// BackendChain is an ordered list of backend names. The first backend in
+// the chain that has a secret wins. In a .imbued file it may be written as a
+// single name or as an array of names.
+type BackendChain []string
+
+// UnmarshalTOML decodes a chain from either a string or an array of strings
+func (c *BackendChain) UnmarshalTOML(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		*c = BackendChain{v}
+	case []interface{}:
+		chain := make(BackendChain, 0, len(v))
+		for _, item := range v {
+			name, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("backend names must be strings, got %T", item)
+			}
+			chain = append(chain, name)
+		}
+		*c = chain
+	default:
+		return fmt.Errorf("expected a backend name or a list of backend names, got %T", value)
+	}
+
+	if len(*c) == 0 {
+		return fmt.Errorf("backend list must not be empty")
+	}
+
+	return nil
+}
+
+// String returns the chain in lookup order, e.g. "local -> keychain -> vault"
+func (c BackendChain) String() string {
+	return strings.Join(c, " -> ")
+}
+
+// loadBackends builds the named backends of the config, including the
+// top-level backend read from defaultSource, expands their options, and
+// checks the backends named by secret_backends
+func (c *ImbuedConfig) loadBackends(backends map[string]backendFile, defaultSource string, defaultBackends BackendChain, secretBackends map[string]BackendChain, defaults Defaults) error {
+	c.Backends = make(map[string]*Backend, len(backends)+1)
+
+	if c.BackendType != "" {
+		if _, ok := backends[DefaultBackendName]; ok {
+			return fmt.Errorf("backend %q is declared both by backend_type and [backends.%s]", DefaultBackendName, DefaultBackendName)
+		}
+		c.Backends[DefaultBackendName] = &Backend{
+			Name:   DefaultBackendName,
+			Type:   c.BackendType,
+			Config: c.BackendConfig,
+			Policy: c.BackendPolicy,
+			Source: defaultSource,
+		}
+		if err := c.Backends[DefaultBackendName].expandOptions(); err != nil {
+			return fmt.Errorf("invalid backend_config in %s: %w", defaultSource, err)
+		}
+	}
+
+	for name, file := range backends {
+		if file.Type == "" {
+			return fmt.Errorf("backend %q has no type", name)
+		}
+
+		policy, err := file.Policy.policy(defaults.Policy)
+		if err != nil {
+			return fmt.Errorf("invalid policy for backend %q: %w", name, err)
+		}
+
+		c.Backends[name] = &Backend{
+			Name:   name,
+			Type:   file.Type,
+			Config: file.Config,
+			Policy: policy,
+			Source: file.source,
+		}
+		if err := c.Backends[name].expandOptions(); err != nil {
+			return fmt.Errorf("invalid config of backend %q in %s: %w", name, file.source, err)
+		}
+	}
+
+	// Configs that declare no backend use the user's default one
+	if len(c.Backends) == 0 && defaults.Backend != nil {
+		backend := *defaults.Backend
+		c.Backends[DefaultBackendName] = &backend
+	}
+
+	// Pick the backends used by secrets that don't name any
+	switch {
+	case len(defaultBackends) > 0:
+		if err := c.checkChain("default_backend", defaultBackends); err != nil {
+			return err
+		}
+		c.DefaultBackends = defaultBackends
+	case c.BackendType != "":
+		c.DefaultBackends = BackendChain{DefaultBackendName}
+	case len(c.Backends) == 1:
+		for name := range c.Backends {
+			c.DefaultBackends = BackendChain{name}
+		}
+	}
+
+	// Keep the top-level fields pointing at the first default backend
+	if len(c.DefaultBackends) > 0 {
+		backend := c.Backends[c.DefaultBackends[0]]
+		c.BackendType = backend.Type
+		c.BackendConfig = backend.Config
+		c.BackendPolicy = backend.Policy
+	}
+
+	c.SecretBackends = make(map[string]BackendChain, len(secretBackends))
+	for secretName, chain := range secretBackends {
+		if _, ok := c.Secrets[secretName]; !ok {
+			return fmt.Errorf("secret_backends names unknown secret %q", secretName)
+		}
+		if err := c.checkChain(fmt.Sprintf("secret %q", secretName), chain); err != nil {
+			return err
+		}
+		c.SecretBackends[secretName] = chain
+	}
+
+	for secretName, secret := range c.Secrets {
+		if len(secret.Backends) == 0 {
+			continue
+		}
+		if _, ok := c.SecretBackends[secretName]; ok {
+			return fmt.Errorf("secret %q sets its backend both in [secrets] and [secret_backends]", secretName)
+		}
+		if err := c.checkChain(fmt.Sprintf("secret %q", secretName), secret.Backends); err != nil {
+			return err
+		}
+		c.SecretBackends[secretName] = secret.Backends
+	}
+
+	return nil
+}
+
+// checkChain checks that every backend of a chain is declared exactly once
+func (c *ImbuedConfig) checkChain(owner string, chain BackendChain) error {
+	seen := make(map[string]bool, len(chain))
+	for _, name := range chain {
+		if _, ok := c.Backends[name]; !ok {
+			return fmt.Errorf("%s uses undeclared backend %q", owner, name)
+		}
+		if seen[name] {
+			return fmt.Errorf("%s lists backend %q more than once", owner, name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// BackendsFor returns the ordered chain of backends the given secret is
+// looked up in
+func (c *ImbuedConfig) BackendsFor(secretName string) ([]*Backend, error) {
+	chain := c.ChainFor(secretName)
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("secret %q doesn't name a backend and there is no default backend", secretName)
+	}
+
+	backends := make([]*Backend, 0, len(chain))
+	for _, name := range chain {
+		backend, ok := c.Backends[name]
+		if !ok {
+			return nil, fmt.Errorf("secret %q uses undeclared backend %q", secretName, name)
+		}
+		backends = append(backends, backend)
+	}
+
+	return backends, nil
+}
+
+// BackendFor returns the first backend the given secret is looked up in,
+// which is also the backend new values of the secret are stored in
+func (c *ImbuedConfig) BackendFor(secretName string) (*Backend, error) {
+	backends, err := c.BackendsFor(secretName)
+	if err != nil {
+		return nil, err
+	}
+	return backends[0], nil
+}
+
+// BackendName returns the name the given secret has in its backends, which
+// is the secret's own name unless its entry sets another one
+func (c *ImbuedConfig) BackendName(secretName string) string {
+	if secret, ok := c.Secrets[secretName]; ok && secret.Name != "" {
+		return secret.Name
+	}
+	return secretName
+}
+
+// ChainFor returns the names of the backends the given secret is looked up in, in order
+func (c *ImbuedConfig) ChainFor(secretName string) BackendChain {
+	if chain, ok := c.SecretBackends[secretName]; ok {
+		return chain
+	}
+	return c.DefaultBackends
+}
+
+// BackendNames returns the sorted names of the config's backends
+func (c *ImbuedConfig) BackendNames() []string {
+	names := make([]string, 0, len(c.Backends))
+	for name := range c.Backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadTestConfig loads a config holding data
+func loadTestConfig(t *testing.T, data string) (*ImbuedConfig, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".imbued")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return LoadConfig(path, BuiltinDefaults())
+}
+
+func TestBackendFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		secret  string
+		want    string // Name of the backend the secret is fetched from
+		loadErr string
+		err     string
+	}{
+		{
+			name: "top-level backend",
+			data: `backend_type = "env_file"
+[secrets]
+DB_PASSWORD = "DB_PASSWORD"`,
+			secret: "DB_PASSWORD",
+			want:   DefaultBackendName,
+		},
+		{
+			name: "selected by secret_backends",
+			data: `backend_type = "env_file"
+[backends.vault]
+type = "vault"
+[secrets]
+DB_PASSWORD = "DB_PASSWORD"
+API_KEY = "API_KEY"
+[secret_backends]
+API_KEY = "vault"`,
+			secret: "API_KEY",
+			want:   "vault",
+		},
+		{
+			name: "default_backend",
+			data: `default_backend = "aws"
+[backends.vault]
+type = "vault"
+[backends.aws]
+type = "aws_secret_manager"
+[secrets]
+DB_PASSWORD = "DB_PASSWORD"`,
+			secret: "DB_PASSWORD",
+			want:   "aws",
+		},
+		{
+			name: "single named backend",
+			data: `[backends.vault]
+type = "vault"
+[secrets]
+DB_PASSWORD = "DB_PASSWORD"`,
+			secret: "DB_PASSWORD",
+			want:   "vault",
+		},
+		{
+			name: "no default among several backends",
+			data: `[backends.vault]
+type = "vault"
+[backends.aws]
+type = "aws_secret_manager"
+[secrets]
+DB_PASSWORD = "DB_PASSWORD"`,
+			secret: "DB_PASSWORD",
+			err:    "doesn't name a backend and there is no default backend",
+		},
+		{
+			name: "default declared twice",
+			data: `backend_type = "env_file"
+[backends.default]
+type = "vault"`,
+			loadErr: `backend "default" is declared both by backend_type and [backends.default]`,
+		},
+		{
+			name: "backend listed twice in a chain",
+			data: `backend_type = "env_file"
+[secrets]
+API_KEY = "API_KEY"
+[secret_backends]
+API_KEY = ["default", "default"]`,
+			loadErr: `secret "API_KEY" lists backend "default" more than once`,
+		},
+		{
+			name: "empty chain",
+			data: `backend_type = "env_file"
+default_backend = []`,
+			loadErr: "backend list must not be empty",
+		},
+		{
+			name: "backend without a type",
+			data: `[backends.vault]
+config = { address = "https://vault.example.com" }`,
+			loadErr: `backend "vault" has no type`,
+		},
+		{
+			name: "undeclared default_backend",
+			data: `default_backend = "vault"
+backend_type = "env_file"`,
+			loadErr: `default_backend uses undeclared backend "vault"`,
+		},
+		{
+			name: "secret_backends of an unknown secret",
+			data: `backend_type = "env_file"
+[secret_backends]
+API_KEY = "default"`,
+			loadErr: `secret_backends names unknown secret "API_KEY"`,
+		},
+		{
+			name: "secret_backends naming an undeclared backend",
+			data: `backend_type = "env_file"
+[secrets]
+API_KEY = "API_KEY"
+[secret_backends]
+API_KEY = "vault"`,
+			loadErr: `secret "API_KEY" uses undeclared backend "vault"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadTestConfig(t, tt.data)
+			if tt.loadErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.loadErr) {
+					t.Fatalf("LoadConfig() error = %v, want %q", err, tt.loadErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+
+			backend, err := cfg.BackendFor(tt.secret)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("BackendFor() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BackendFor() error = %v", err)
+			}
+			if backend.Name != tt.want {
+				t.Errorf("BackendFor() = %s, want %s", backend.Name, tt.want)
+			}
+		})
+	}
+}
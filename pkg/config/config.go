@@ -4,33 +4,73 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/novacove/imbued/pkg/secrets"
 )
 
 // ImbuedConfig represents the parsed configuration from a .imbued file
 type ImbuedConfig struct {
-	Secrets       map[string]string // Map of secret name to environment variable name
-	ValidDepth    int               // Number of child directories down that secrets are available for
-	BackendType   string            // Type of secret backend to use
-	BackendConfig map[string]string // Backend-specific configuration
+	Secrets       map[string]*Secret   // Map of secret name to its entry
+	Templates     map[string]*Template // Map of environment variable name to the template it is rendered from
+	Env           map[string]string    // Plain, non-secret environment values
+	ValidDepth    int                  // Number of child directories down that secrets are available for
+	BackendType   string               // Type of secret backend to use
+	BackendConfig map[string]string    // Backend-specific configuration
+	BackendPolicy secrets.Policy       // Timeouts, retries and circuit breaker settings for backend calls
+
+	Backends        map[string]*Backend     // Named backends, including the top-level backend as "default"
+	DefaultBackends BackendChain            // Backends used by secrets that don't name any
+	SecretBackends  map[string]BackendChain // Map of secret name to the backends it is looked up in, in order
+
+	CacheTTL       time.Duration            // How long resolved secrets are cached by the daemon (0 disables caching)
+	SecretCacheTTL map[string]time.Duration // Per-secret overrides of CacheTTL
+
+	OfflineSnapshot     bool          // Whether to serve the last fetched values when the backend is unreachable
+	OfflineMaxStaleness time.Duration // Maximum age of a snapshotted value that may be served
+
+	Layers       []string      // Paths of the files the config was merged from, outermost parent first
+	Deprecations []string      // Outdated constructs found in the files, which imbued config migrate updates
+	Profile      string        // Name of the profile layered over the config, if any
+	Profiles     []string      // Sorted names of the profiles the config declares
+	ProfileRules []ProfileRule // Rules selecting a profile automatically, in order of precedence
 }
 
-// FindConfig looks for a .imbued file in the current directory or parent directories
-// up to maxLevels levels up. Returns the path to the file if found, or an empty string if not.
+// DefaultOfflineMaxStaleness is how old a snapshotted value may be when
+// offline_max_staleness is not set
+const DefaultOfflineMaxStaleness = 24 * time.Hour
+
+// FindConfig looks for a config file in startDir or its parent directories,
+// up to maxLevels levels up (0 for no limit). The search stops at the root of
+// the project, see IsProjectRoot, and doesn't climb into the user's home
+// directory.
 func FindConfig(startDir string, maxLevels int) (string, error) {
 	currentDir, err := filepath.Abs(startDir)
 	if err != nil {
 		return "", fmt.Errorf("failed to get absolute path: %w", err)
 	}
+	homeDir, _ := os.UserHomeDir()
 
-	for i := 0; i <= maxLevels; i++ {
-		configPath := filepath.Join(currentDir, ".imbued")
-		if _, err := os.Stat(configPath); err == nil {
+	for level := 0; maxLevels <= 0 || level <= maxLevels; level++ {
+		if level > 0 && currentDir == homeDir {
+			break
+		}
+
+		configPath, err := ConfigInDir(currentDir)
+		if err != nil {
+			return "", err
+		}
+		if configPath != "" {
 			return configPath, nil
 		}
 
+		if IsProjectRoot(currentDir) {
+			break
+		}
+
 		// Move up one directory
 		parentDir := filepath.Dir(currentDir)
 		if parentDir == currentDir {
@@ -40,28 +80,168 @@ func FindConfig(startDir string, maxLevels int) (string, error) {
 		currentDir = parentDir
 	}
 
-	return "", fmt.Errorf("no .imbued file found within %d levels up from %s", maxLevels, startDir)
+	return "", fmt.Errorf("no .imbued file found in %s or its parents up to the project root", startDir)
+}
+
+// configFile is the content of a single .imbued file
+type configFile struct {
+	Version int      `toml:"version"`
+	Inherit bool     `toml:"inherit"`
+	Extends string   `toml:"extends"`
+	Include []string `toml:"include"`
+
+	Secrets       map[string]*Secret `toml:"secrets"`
+	Templates     map[string]string  `toml:"templates"`
+	Env           map[string]string  `toml:"env"`
+	ValidDepth    int                `toml:"valid_depth"`
+	BackendType   string             `toml:"backend_type"`
+	BackendConfig map[string]string  `toml:"backend_config"`
+	BackendPolicy policyFile         `toml:"backend_policy"`
+
+	Backends       map[string]backendFile  `toml:"backends"`
+	DefaultBackend BackendChain            `toml:"default_backend"`
+	SecretBackends map[string]BackendChain `toml:"secret_backends"`
+
+	CacheTTL       string            `toml:"cache_ttl"`
+	SecretCacheTTL map[string]string `toml:"secret_cache_ttl"`
+
+	OfflineSnapshot     bool   `toml:"offline_snapshot"`
+	OfflineMaxStaleness string `toml:"offline_max_staleness"`
+
+	Profiles     map[string]*configFile `toml:"profiles"`
+	ProfileRules []ProfileRule          `toml:"profile_rules"`
+
+	path                string        // Path the file was read from
+	meta                toml.MetaData // Which keys the file defines
+	metaPrefix          []string      // Key path of a profile's table within the file
+	backendConfigSource string        // File backend_config was read from, kept through merges
 }
 
-// LoadConfig loads and parses the .imbued file at the given path
-func LoadConfig(configPath string) (*ImbuedConfig, error) {
-	var imbuedConfigFile struct {
-		Secrets       map[string]string `toml:"secrets"`
-		ValidDepth    int               `toml:"valid_depth"`
-		BackendType   string            `toml:"backend_type"`
-		BackendConfig map[string]string `toml:"backend_config"`
+// decodeConfigFile reads a single .imbued file
+func decodeConfigFile(configPath string) (*configFile, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", configPath, err)
+	}
+	return decodeConfigData(configPath, data)
+}
+
+// decodeConfigData decodes the content of the config file at configPath, in
+// the format given by its extension
+func decodeConfigData(configPath string, data []byte) (*configFile, error) {
+	file := &configFile{path: configPath}
+
+	document, err := toTOML(configPath, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode config file %s: %w", configPath, err)
 	}
 
-	_, err := toml.DecodeFile(configPath, &imbuedConfigFile)
+	meta, err := toml.Decode(document, file)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode config file: %w", err)
+		return nil, fmt.Errorf("failed to decode config file %s: %w", configPath, err)
 	}
+	file.meta = meta
+	file.setSource(configPath)
+
+	if err := file.checkVersion(); err != nil {
+		return nil, err
+	}
+
+	// Profiles are partial configs layered over the file
+	for name, profile := range file.Profiles {
+		if profile.Version != 0 || profile.Inherit || profile.Extends != "" || len(profile.Include) > 0 || len(profile.Profiles) > 0 || len(profile.ProfileRules) > 0 {
+			return nil, fmt.Errorf("profile %q of %s can't set version, inherit, extends, include, profiles or profile_rules", name, configPath)
+		}
+		profile.path = configPath
+		profile.meta = meta
+		profile.metaPrefix = []string{"profiles", name}
+		profile.setSource(configPath)
+	}
+
+	return file, nil
+}
+
+// setSource records the file the backend options of f were read from, so
+// that relative paths resolve against it once layers are merged
+func (f *configFile) setSource(path string) {
+	f.backendConfigSource = path
+	for name, backend := range f.Backends {
+		backend.source = path
+		f.Backends[name] = backend
+	}
+}
+
+// isDefined reports whether the file, or the profile, sets the given top-level key
+func (f *configFile) isDefined(key string) bool {
+	return f.meta.IsDefined(append(append([]string{}, f.metaPrefix...), key)...)
+}
+
+// LoadConfig loads and parses the .imbued file at the given path, merged
+// with the files it inherits from or extends. The defaults apply to what
+// the config doesn't set.
+func LoadConfig(configPath string, defaults Defaults) (*ImbuedConfig, error) {
+	return LoadConfigProfile(configPath, "", defaults)
+}
+
+// LoadConfigProfile loads a config like LoadConfig and layers the named
+// profile over it. An empty profile name loads the config as is.
+func LoadConfigProfile(configPath, profile string, defaults Defaults) (*ImbuedConfig, error) {
+	layers, err := loadLayers(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var deprecations []string
+	for _, layer := range layers {
+		for _, deprecation := range layer.deprecations() {
+			deprecations = append(deprecations, fmt.Sprintf("%s: %s", layer.path, deprecation.message))
+		}
+	}
+
+	merged := layers[0]
+	for _, layer := range layers[1:] {
+		merged = merged.merge(layer)
+	}
+
+	profiles := make([]string, 0, len(merged.Profiles))
+	for name := range merged.Profiles {
+		profiles = append(profiles, name)
+	}
+	sort.Strings(profiles)
+
+	if profile != "" {
+		overlay, ok := merged.Profiles[profile]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile %q (available: %s)", profile, strings.Join(profiles, ", "))
+		}
+		merged = merged.merge(overlay)
+	}
+
+	config, err := merged.build(defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Layers = make([]string, 0, len(layers))
+	for _, layer := range layers {
+		config.Layers = append(config.Layers, layer.path)
+	}
+	config.Deprecations = deprecations
+	config.Profile = profile
+	config.Profiles = profiles
+
+	return config, nil
+}
+
+// build converts a (merged) config file into an ImbuedConfig
+func (f *configFile) build(defaults Defaults) (*ImbuedConfig, error) {
+	var err error
 
 	config := &ImbuedConfig{
-		Secrets:       imbuedConfigFile.Secrets,
-		ValidDepth:    imbuedConfigFile.ValidDepth,
-		BackendType:   imbuedConfigFile.BackendType,
-		BackendConfig: imbuedConfigFile.BackendConfig,
+		Secrets:       f.Secrets,
+		ValidDepth:    f.ValidDepth,
+		BackendType:   f.BackendType,
+		BackendConfig: f.BackendConfig,
 	}
 
 	// Set default valid depth if not specified
@@ -69,42 +249,217 @@ func LoadConfig(configPath string) (*ImbuedConfig, error) {
 		config.ValidDepth = 1
 	}
 
+	if f.CacheTTL != "" {
+		config.CacheTTL, err = time.ParseDuration(f.CacheTTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cache_ttl: %w", err)
+		}
+	}
+
+	if config.Secrets == nil {
+		config.Secrets = make(map[string]*Secret)
+	}
+	for secretName, secret := range config.Secrets {
+		if secret.Name == "" {
+			secret.Name = secretName
+		}
+		if secret.Env == nil {
+			secret.Env = []string{secretName}
+		}
+	}
+
+	if err := config.loadTemplates(f.Templates); err != nil {
+		return nil, err
+	}
+
+	if err := config.loadEnv(f.Env); err != nil {
+		return nil, err
+	}
+
+	for i, rule := range f.ProfileRules {
+		if err := rule.check(f.Profiles); err != nil {
+			return nil, fmt.Errorf("profile rule %d %w", i+1, err)
+		}
+	}
+	config.ProfileRules = f.ProfileRules
+
+	config.SecretCacheTTL = make(map[string]time.Duration, len(f.SecretCacheTTL))
+	for secretName, ttl := range f.SecretCacheTTL {
+		config.SecretCacheTTL[secretName], err = time.ParseDuration(ttl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret_cache_ttl for %s: %w", secretName, err)
+		}
+	}
+	for secretName, secret := range config.Secrets {
+		if secret.CacheTTL == nil {
+			continue
+		}
+		if _, ok := config.SecretCacheTTL[secretName]; ok {
+			return nil, fmt.Errorf("secret %q sets cache_ttl both in [secrets] and [secret_cache_ttl]", secretName)
+		}
+		config.SecretCacheTTL[secretName] = *secret.CacheTTL
+	}
+
+	config.BackendPolicy, err = f.BackendPolicy.policy(defaults.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backend_policy: %w", err)
+	}
+
+	if err := config.loadBackends(f.Backends, f.backendConfigSource, f.DefaultBackend, f.SecretBackends, defaults); err != nil {
+		return nil, err
+	}
+
+	config.OfflineSnapshot = f.OfflineSnapshot
+	config.OfflineMaxStaleness = DefaultOfflineMaxStaleness
+	if f.OfflineMaxStaleness != "" {
+		config.OfflineMaxStaleness, err = time.ParseDuration(f.OfflineMaxStaleness)
+		if err != nil {
+			return nil, fmt.Errorf("invalid offline_max_staleness: %w", err)
+		}
+	}
+
 	return config, nil
 }
 
+// policyFile is the [backend_policy] table of a .imbued file. Unset keys
+// fall back to the defaults.
+type policyFile struct {
+	Timeout          string `toml:"timeout"`
+	Retries          *int   `toml:"retries"`
+	Backoff          string `toml:"backoff"`
+	BreakerThreshold *int   `toml:"breaker_threshold"`
+	BreakerCooldown  string `toml:"breaker_cooldown"`
+}
+
+// policy converts the table into a secrets.Policy, over the given defaults
+func (f policyFile) policy(defaults secrets.Policy) (secrets.Policy, error) {
+	policy := defaults
+
+	durations := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"timeout", f.Timeout, &policy.Timeout},
+		{"backoff", f.Backoff, &policy.Backoff},
+		{"breaker_cooldown", f.BreakerCooldown, &policy.BreakerCooldown},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(d.value)
+		if err != nil {
+			return policy, fmt.Errorf("invalid %s: %w", d.name, err)
+		}
+		if parsed < 0 {
+			return policy, fmt.Errorf("%s must not be negative", d.name)
+		}
+		*d.dest = parsed
+	}
+
+	if f.Retries != nil {
+		if *f.Retries < 0 {
+			return policy, fmt.Errorf("retries must not be negative")
+		}
+		if *f.Retries > secrets.MaxRetries {
+			return policy, fmt.Errorf("retries must be at most %d", secrets.MaxRetries)
+		}
+		policy.Retries = *f.Retries
+	}
+
+	if f.BreakerThreshold != nil {
+		if *f.BreakerThreshold < 0 {
+			return policy, fmt.Errorf("breaker_threshold must not be negative")
+		}
+		policy.BreakerThreshold = *f.BreakerThreshold
+	}
+
+	return policy, nil
+}
+
+// CacheTTLFor returns how long the daemon may cache the value of the given secret
+func (c *ImbuedConfig) CacheTTLFor(secretName string) time.Duration {
+	if ttl, ok := c.SecretCacheTTL[secretName]; ok {
+		return ttl
+	}
+	return c.CacheTTL
+}
+
 // IsWithinValidDepth checks if the current directory is within the valid depth
 // from the directory containing the .imbued file
 func IsWithinValidDepth(configDir, currentDir string, validDepth int) (bool, error) {
+	depth, err := DirDepth(configDir, currentDir)
+	if err != nil {
+		return false, err
+	}
+	return depth >= 0 && depth <= validDepth, nil
+}
+
+// DirDepth returns how many directories currentDir is below configDir. It
+// returns -1 if currentDir is neither configDir nor one of its subdirectories.
+func DirDepth(configDir, currentDir string) (int, error) {
 	// Get absolute paths
 	absConfigDir, err := filepath.Abs(configDir)
 	if err != nil {
-		return false, fmt.Errorf("failed to get absolute path for config dir: %w", err)
+		return 0, fmt.Errorf("failed to get absolute path for config dir: %w", err)
 	}
 
 	absCurrentDir, err := filepath.Abs(currentDir)
 	if err != nil {
-		return false, fmt.Errorf("failed to get absolute path for current dir: %w", err)
+		return 0, fmt.Errorf("failed to get absolute path for current dir: %w", err)
 	}
 
-	// Check if current directory is the same as or a subdirectory of the config directory
-	if !strings.HasPrefix(absCurrentDir, absConfigDir) {
-		return false, nil
-	}
-
-	// Calculate the depth difference
 	relPath, err := filepath.Rel(absConfigDir, absCurrentDir)
 	if err != nil {
-		return false, fmt.Errorf("failed to get relative path: %w", err)
+		return 0, fmt.Errorf("failed to get relative path: %w", err)
+	}
+
+	// Check if current directory is the same as or a subdirectory of the config directory
+	if relPath == ".." || strings.HasPrefix(relPath, ".."+string(os.PathSeparator)) {
+		return -1, nil
 	}
 
 	if relPath == "." {
 		// Current directory is the same as config directory
-		return true, nil
+		return 0, nil
 	}
 
 	// Count the number of directory separators to determine depth
-	depth := strings.Count(relPath, string(os.PathSeparator)) + 1
-	return depth <= validDepth, nil
+	return strings.Count(relPath, string(os.PathSeparator)) + 1, nil
+}
+
+// ValidDepthFor returns the number of child directories down that the given
+// secret is available for
+func (c *ImbuedConfig) ValidDepthFor(secretName string) int {
+	if secret, ok := c.Secrets[secretName]; ok && secret.ValidDepth != nil {
+		return *secret.ValidDepth
+	}
+	return c.ValidDepth
+}
+
+// MaxValidDepth returns the deepest directory level at which any value of
+// the config is available
+func (c *ImbuedConfig) MaxValidDepth() int {
+	maxDepth := c.ValidDepth
+	for secretName := range c.Secrets {
+		if depth := c.ValidDepthFor(secretName); depth > maxDepth {
+			maxDepth = depth
+		}
+	}
+	return maxDepth
+}
+
+// SecretNamesAt returns the sorted names of the secrets available at the
+// given number of directories below the config
+func (c *ImbuedConfig) SecretNamesAt(depth int) []string {
+	var names []string
+	for _, secretName := range c.SecretNames() {
+		if depth <= c.ValidDepthFor(secretName) {
+			names = append(names, secretName)
+		}
+	}
+	return names
 }
 
 // GetConfigDir returns the directory containing the .imbued file
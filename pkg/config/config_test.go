@@ -0,0 +1,89 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigProfile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".imbued": `backend_type = "vault"
+backend_config = { address = "https://vault.example.com" }
+
+[secrets]
+DB_PASSWORD = "DB_PASSWORD"
+
+[env]
+APP_ENV = "development"
+
+[profiles.staging]
+backend_config = { address = "https://vault.staging.example.com" }
+
+[profiles.staging.env]
+APP_ENV = "staging"
+
+[profiles.local]
+backend_type = "env_file"
+`,
+		"app/.imbued": `inherit = true
+
+[profiles.production.env]
+APP_ENV = "production"
+`,
+	})
+	configPath := filepath.Join(dir, "app", ".imbued")
+
+	tests := []struct {
+		profile string
+		backend string
+		config  map[string]string
+		env     string
+		err     string
+	}{
+		{profile: "", backend: "vault", config: map[string]string{"address": "https://vault.example.com"}, env: "development"},
+		{profile: "staging", backend: "vault", config: map[string]string{"address": "https://vault.staging.example.com"}, env: "staging"},
+		{profile: "local", backend: "env_file", config: nil, env: "development"},
+		{profile: "production", backend: "vault", config: map[string]string{"address": "https://vault.example.com"}, env: "production"},
+		{profile: "qa", err: `unknown profile "qa" (available: local, production, staging)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.profile, func(t *testing.T) {
+			cfg, err := LoadConfigProfile(configPath, tt.profile, BuiltinDefaults())
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("LoadConfigProfile() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfigProfile() error = %v", err)
+			}
+
+			if cfg.Profile != tt.profile {
+				t.Errorf("Profile = %q, want %q", cfg.Profile, tt.profile)
+			}
+			if want := []string{"local", "production", "staging"}; !reflect.DeepEqual(cfg.Profiles, want) {
+				t.Errorf("Profiles = %q, want %q", cfg.Profiles, want)
+			}
+			if cfg.BackendType != tt.backend || !reflect.DeepEqual(cfg.BackendConfig, tt.config) {
+				t.Errorf("backend = %s %v, want %s %v", cfg.BackendType, cfg.BackendConfig, tt.backend, tt.config)
+			}
+			if got := cfg.Env["APP_ENV"]; got != tt.env {
+				t.Errorf("APP_ENV = %q, want %q", got, tt.env)
+			}
+		})
+	}
+}
+
+func TestLoadConfigProfileNesting(t *testing.T) {
+	_, err := loadTestConfig(t, `backend_type = "env_file"
+[profiles.staging]
+extends = "../base.imbued"`)
+	if err == nil || !strings.Contains(err.Error(), `profile "staging" of`) {
+		t.Errorf("LoadConfig() error = %v, want a nested inheritance error", err)
+	}
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// loadEnv checks the plain values of the [env] table against the
+// environment variables exported by secrets and templates
+func (c *ImbuedConfig) loadEnv(env map[string]string) error {
+	exported := c.exportedBy()
+	for name := range env {
+		if owner, ok := exported[name]; ok {
+			return fmt.Errorf("env %s is also exported by %s", name, owner)
+		}
+	}
+
+	c.Env = env
+	if c.Env == nil {
+		c.Env = make(map[string]string)
+	}
+
+	return nil
+}
+
+// exportedBy maps each environment variable exported by a secret or a
+// template to a description of what exports it
+func (c *ImbuedConfig) exportedBy() map[string]string {
+	exported := make(map[string]string)
+	for secretName, secret := range c.Secrets {
+		for _, envName := range secret.Env {
+			exported[envName] = fmt.Sprintf("secret %q", secretName)
+		}
+	}
+	for name := range c.Templates {
+		exported[name] = fmt.Sprintf("template %s", name)
+	}
+	return exported
+}
+
+// EnvNames returns the sorted names of the config's plain environment values
+func (c *ImbuedConfig) EnvNames() []string {
+	names := make([]string, 0, len(c.Env))
+	for name := range c.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HasSecrets reports whether the config exports anything that requires
+// authentication, that is any secret or template
+func (c *ImbuedConfig) HasSecrets() bool {
+	return len(c.Secrets) > 0 || len(c.Templates) > 0
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		env     []string
+		secrets bool
+		err     string
+	}{
+		{
+			name: "plain values only",
+			data: `[env]
+NODE_ENV = "development"
+PORT = "3000"`,
+			env: []string{"NODE_ENV", "PORT"},
+		},
+		{
+			name: "alongside secrets",
+			data: `backend_type = "env_file"
+[secrets]
+DB_PASSWORD = "DB_PASSWORD"
+[env]
+DB_HOST = "localhost"`,
+			env:     []string{"DB_HOST"},
+			secrets: true,
+		},
+		{
+			name:    "no env table",
+			data:    `backend_type = "env_file"`,
+			env:     []string{},
+			secrets: false,
+		},
+		{
+			name: "exported by a secret",
+			data: `backend_type = "env_file"
+[secrets]
+DB_PASSWORD = { env = ["DB_PASSWORD", "PGPASSWORD"] }
+[env]
+PGPASSWORD = "postgres"`,
+			err: `env PGPASSWORD is also exported by secret "DB_PASSWORD"`,
+		},
+		{
+			name: "exported by a template",
+			data: `backend_type = "env_file"
+[secrets]
+DB_PASSWORD = "DB_PASSWORD"
+[templates]
+DATABASE_URL = "postgres://app:{{ .DB_PASSWORD }}@db/app"
+[env]
+DATABASE_URL = "postgres://localhost/app"`,
+			err: "env DATABASE_URL is also exported by template DATABASE_URL",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadTestConfig(t, tt.data)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("LoadConfig() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			if got := cfg.EnvNames(); !reflect.DeepEqual(got, tt.env) {
+				t.Errorf("EnvNames() = %q, want %q", got, tt.env)
+			}
+			if got := cfg.HasSecrets(); got != tt.secrets {
+				t.Errorf("HasSecrets() = %v, want %v", got, tt.secrets)
+			}
+		})
+	}
+}
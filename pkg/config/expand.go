@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/novacove/imbued/pkg/secrets"
+)
+
+// optionVariablePattern matches the ${...} variables of backend options
+var optionVariablePattern = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// expandOptions expands the variables of the backend's options, and
+// resolves relative paths against the directory of the file they were read
+// from. It runs once layers are merged, as the backend type making an
+// option a path may come from another file than the option.
+func (b *Backend) expandOptions() error {
+	absPath, err := filepath.Abs(b.Source)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	return expandBackendOptions(b.Config, b.Type, filepath.Dir(absPath))
+}
+
+// expandBackendOptions expands the options of a backend in place. Options
+// holding a path are made absolute relative to dir.
+func expandBackendOptions(options map[string]string, backendType, dir string) error {
+	for name, value := range options {
+		// References are resolved by the backend pool, not here
+		if secrets.IsReference(value) {
+			continue
+		}
+
+		expanded, err := expandOption(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if secrets.IsPath(backendType, name) && expanded != "" && !filepath.IsAbs(expanded) {
+			expanded = filepath.Join(dir, expanded)
+		}
+		options[name] = expanded
+	}
+	return nil
+}
+
+// expandOption expands a leading ~, ${HOME} and ${env:VAR} in the value of a
+// backend option. Environment variables are read from the server's
+// environment, and must be set.
+func expandOption(value string) (string, error) {
+	if value == "~" || strings.HasPrefix(value, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		value = home + value[1:]
+	}
+
+	var expandErr error
+	expanded := optionVariablePattern.ReplaceAllStringFunc(value, func(match string) string {
+		name := optionVariablePattern.FindStringSubmatch(match)[1]
+		switch {
+		case name == "HOME":
+			home, err := os.UserHomeDir()
+			if err != nil {
+				expandErr = fmt.Errorf("failed to get home directory: %w", err)
+			}
+			return home
+		case strings.HasPrefix(name, "env:"):
+			envName := strings.TrimPrefix(name, "env:")
+			envValue, ok := os.LookupEnv(envName)
+			if !ok {
+				expandErr = fmt.Errorf("environment variable %s is not set", envName)
+			}
+			return envValue
+		default:
+			expandErr = fmt.Errorf("unknown variable %s (expected ${HOME} or ${env:NAME})", match)
+			return match
+		}
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+
+	return expanded, nil
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandOption(t *testing.T) {
+	t.Setenv("HOME", "/home/dev")
+	t.Setenv("VAULT_ADDR", "https://vault.example.com")
+	t.Setenv("EMPTY", "")
+
+	tests := []struct {
+		value string
+		want  string
+		err   string
+	}{
+		{value: "plain", want: "plain"},
+		{value: "~", want: "/home/dev"},
+		{value: "~/secrets/.env", want: "/home/dev/secrets/.env"},
+		{value: "a~/b", want: "a~/b"},
+		{value: "${HOME}/.env", want: "/home/dev/.env"},
+		{value: "${env:VAULT_ADDR}/v1", want: "https://vault.example.com/v1"},
+		{value: "${env:EMPTY}", want: ""},
+		{value: "${env:UNSET_VARIABLE}", err: "environment variable UNSET_VARIABLE is not set"},
+		{value: "${USER}", err: "unknown variable ${USER} (expected ${HOME} or ${env:NAME})"},
+		{value: "$HOME", want: "$HOME"},
+	}
+
+	for _, tt := range tests {
+		got, err := expandOption(tt.value)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expandOption(%q) = %q, %v, want error %q", tt.value, got, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("expandOption(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigExpandsOptions(t *testing.T) {
+	t.Setenv("VAULT_TOKEN", "s.abc")
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".imbued": `version = 2
+backend_type = "env_file"
+backend_config = { file_path = "shared.env" }`,
+		"app/.imbued": `version = 2
+inherit = true
+
+[backends.local]
+type = "env_file"
+config = { file_path = "../local/.env" }
+
+[backends.vault]
+type = "vault"
+config = { address = "https://vault.example.com", token = "${env:VAULT_TOKEN}" }
+
+[backends.chain]
+type = "vault"
+config = { address = "https://vault.example.com", token = "keychain:vault.token" }`,
+	})
+
+	cfg, err := LoadConfig(filepath.Join(dir, "app", ".imbued"), BuiltinDefaults())
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		backend string
+		option  string
+		want    string
+	}{
+		// Relative paths are resolved against the file that sets them
+		{backend: DefaultBackendName, option: "file_path", want: filepath.Join(dir, "shared.env")},
+		{backend: "local", option: "file_path", want: filepath.Join(dir, "local", ".env")},
+		{backend: "vault", option: "token", want: "s.abc"},
+		// References are left to the backend pool
+		{backend: "chain", option: "token", want: "keychain:vault.token"},
+	}
+	for _, tt := range tests {
+		if got := cfg.Backends[tt.backend].Config[tt.option]; got != tt.want {
+			t.Errorf("backend %s option %s = %q, want %q", tt.backend, tt.option, got, tt.want)
+		}
+	}
+
+	_, err = loadTestConfig(t, `version = 2
+backend_type = "vault"
+backend_config = { address = "${env:UNSET_VAULT_ADDR}", token = "keychain:vault.token" }`)
+	if err == nil || !strings.Contains(err.Error(), "address: environment variable UNSET_VAULT_ADDR is not set") {
+		t.Errorf("LoadConfig() error = %v, want an unset variable error", err)
+	}
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the syntax a config file is written in
+type Format string
+
+const (
+	// FormatTOML is the syntax of .imbued and .imbued.toml files, and of any
+	// file without a YAML or JSON extension
+	FormatTOML Format = "toml"
+	// FormatYAML is the syntax of .imbued.yaml and .imbued.yml files
+	FormatYAML Format = "yaml"
+	// FormatJSON is the syntax of .imbued.json files
+	FormatJSON Format = "json"
+)
+
+// ConfigNames are the names of config files, in the order they are looked for
+var ConfigNames = []string{".imbued", ".imbued.toml", ".imbued.yaml", ".imbued.yml", ".imbued.json"}
+
+// RootMarker is the file marking the root of a project, like a .git
+// directory does. Configs aren't searched for above it.
+const RootMarker = ".imbued-root"
+
+// FormatOf returns the format of a config file, given by its extension
+func FormatOf(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".json":
+		return FormatJSON
+	default:
+		return FormatTOML
+	}
+}
+
+// ConfigInDir returns the path of the config file in dir, or an empty
+// string if there is none. A directory holding several config files is an
+// error, as it isn't clear which one applies.
+func ConfigInDir(dir string) (string, error) {
+	var found []string
+	for _, name := range ConfigNames {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			found = append(found, path)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", nil
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("%s holds several config files (%s), keep only one", dir, strings.Join(found, ", "))
+	}
+}
+
+// IsProjectRoot reports whether dir is the root of a project: it holds a
+// .git directory or file, or a .imbued-root marker
+func IsProjectRoot(dir string) bool {
+	for _, name := range []string{".git", RootMarker} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ProjectRoot returns the root directory of the project holding a config
+// file: the closest of its directories that is a project root
+func ProjectRoot(configPath string) (string, error) {
+	absPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	for dir := filepath.Dir(absPath); ; {
+		if IsProjectRoot(dir) {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("%s isn't part of a project: none of its directories holds .git or %s", configPath, RootMarker)
+		}
+		dir = parent
+	}
+}
+
+// ProjectPath returns the path of a config file relative to the root of its
+// project, with forward slashes, e.g. "services/api/.imbued"
+func ProjectPath(configPath string) (string, error) {
+	root, err := ProjectRoot(configPath)
+	if err != nil {
+		return "", err
+	}
+
+	absPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	rel, err := filepath.Rel(root, absPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// toTOML returns the content of a config file as TOML, converting YAML and
+// JSON so that every format decodes into the same model
+func toTOML(path string, data []byte) (string, error) {
+	var document interface{}
+	switch FormatOf(path) {
+	case FormatYAML:
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return "", err
+		}
+	case FormatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&document); err != nil {
+			return "", err
+		}
+	default:
+		return string(data), nil
+	}
+
+	// An empty YAML document is an empty config
+	if document == nil {
+		return "", nil
+	}
+
+	table, ok := document.(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("expected a mapping of keys to values at the top level, got %T", document)
+	}
+
+	// Editors may point at the JSON Schema from the file itself
+	delete(table, "$schema")
+
+	converted, err := tomlValue(table, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(converted); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// tomlValue converts a value decoded from YAML or JSON into one TOML can
+// encode, reporting the key of values TOML has no equivalent for
+func tomlValue(value interface{}, key []string) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		table := make(map[string]interface{}, len(v))
+		for name, item := range v {
+			converted, err := tomlValue(item, append(key, name))
+			if err != nil {
+				return nil, err
+			}
+			table[name] = converted
+		}
+		return table, nil
+	case map[interface{}]interface{}:
+		table := make(map[string]interface{}, len(v))
+		for name, item := range v {
+			nameString, ok := name.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: keys must be strings, got %v", toml.Key(key), name)
+			}
+			converted, err := tomlValue(item, append(key, nameString))
+			if err != nil {
+				return nil, err
+			}
+			table[nameString] = converted
+		}
+		return table, nil
+	case []interface{}:
+		array := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			converted, err := tomlValue(item, key)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, converted)
+		}
+		return array, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	case int:
+		return int64(v), nil
+	case nil:
+		return nil, fmt.Errorf("%s: null values aren't supported, leave the key out instead", toml.Key(key))
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,255 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigInDir(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+		err   string
+	}{
+		{name: "none", files: map[string]string{"README.md": ""}},
+		{name: "TOML", files: map[string]string{".imbued": ""}, want: ".imbued"},
+		{name: "YAML", files: map[string]string{".imbued.yml": ""}, want: ".imbued.yml"},
+		{name: "directory named like a config", files: map[string]string{".imbued/config": ""}},
+		{
+			name:  "several config files",
+			files: map[string]string{".imbued": "", ".imbued.json": "{}"},
+			err:   "holds several config files",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+
+			got, err := ConfigInDir(dir)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ConfigInDir() = %q, %v, want error %q", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ConfigInDir() error = %v", err)
+			}
+
+			want := ""
+			if tt.want != "" {
+				want = filepath.Join(dir, tt.want)
+			}
+			if got != want {
+				t.Errorf("ConfigInDir() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestFindConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     map[string]string
+		start     string // Directory the search starts in
+		maxLevels int
+		want      string
+		err       string
+	}{
+		{
+			name:  "in the start directory",
+			files: map[string]string{"project/app/.imbued": "", "project/.imbued": ""},
+			start: "project/app",
+			want:  "project/app/.imbued",
+		},
+		{
+			name:  "in a parent",
+			files: map[string]string{"project/.imbued.yaml": "", "project/app/src/main.go": ""},
+			start: "project/app/src",
+			want:  "project/.imbued.yaml",
+		},
+		{
+			name:  "at the git root",
+			files: map[string]string{"project/.git/HEAD": "", "project/.imbued": "", "project/app/main.go": ""},
+			start: "project/app",
+			want:  "project/.imbued",
+		},
+		{
+			name:  "stops at the git root",
+			files: map[string]string{".imbued": "", "project/.git/HEAD": "", "project/app/main.go": ""},
+			start: "project/app",
+			err:   "up to the project root",
+		},
+		{
+			name:  "stops at a root marker",
+			files: map[string]string{".imbued": "", "project/" + RootMarker: "", "project/app/main.go": ""},
+			start: "project/app",
+			err:   "up to the project root",
+		},
+		{
+			name:      "max levels",
+			files:     map[string]string{".imbued": "", "a/b/c/main.go": ""},
+			start:     "a/b/c",
+			maxLevels: 2,
+			err:       "no .imbued file found",
+		},
+		{
+			name:  "several config files",
+			files: map[string]string{"project/.imbued": "", "project/.imbued.toml": "", "project/app/main.go": ""},
+			start: "project/app",
+			err:   "holds several config files",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			// The search stops below the home directory
+			t.Setenv("HOME", dir)
+
+			got, err := FindConfig(filepath.Join(dir, tt.start), tt.maxLevels)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("FindConfig() = %q, %v, want error %q", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindConfig() error = %v", err)
+			}
+			if want := filepath.Join(dir, tt.want); got != want {
+				t.Errorf("FindConfig() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestProjectPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		config string
+		want   string
+		err    string
+	}{
+		{
+			name:   "at the git root",
+			files:  map[string]string{"project/.git/HEAD": "", "project/.imbued": ""},
+			config: "project/.imbued",
+			want:   ".imbued",
+		},
+		{
+			name:   "below a root marker",
+			files:  map[string]string{"project/" + RootMarker: "", "project/services/api/.imbued.yaml": ""},
+			config: "project/services/api/.imbued.yaml",
+			want:   "services/api/.imbued.yaml",
+		},
+		{
+			name:   "outside of a project",
+			files:  map[string]string{"project/.imbued": ""},
+			config: "project/.imbued",
+			err:    "isn't part of a project",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+
+			got, err := ProjectPath(filepath.Join(dir, tt.config))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("ProjectPath() = %q, %v, want error %q", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ProjectPath() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFormats(t *testing.T) {
+	tomlData := `version = 2
+backend_type = "env_file"
+backend_config = { file_path = "/run/secrets.env" }
+valid_depth = 2
+
+[secrets]
+DB_PASSWORD = { env = ["DB_PASSWORD", "PGPASSWORD"], required = true }`
+
+	tests := []struct {
+		name string
+		file string
+		data string
+		err  string
+	}{
+		{name: "TOML", file: ".imbued.toml", data: tomlData},
+		{
+			name: "YAML",
+			file: ".imbued.yaml",
+			data: `version: 2
+backend_type: env_file
+backend_config:
+  file_path: /run/secrets.env
+valid_depth: 2
+secrets:
+  DB_PASSWORD:
+    env: [DB_PASSWORD, PGPASSWORD]
+    required: true
+`,
+		},
+		{
+			name: "JSON",
+			file: ".imbued.json",
+			data: `{
+  "$schema": "https://github.com/novacove/imbued/imbued.schema.json",
+  "version": 2,
+  "backend_type": "env_file",
+  "backend_config": {"file_path": "/run/secrets.env"},
+  "valid_depth": 2,
+  "secrets": {"DB_PASSWORD": {"env": ["DB_PASSWORD", "PGPASSWORD"], "required": true}}
+}`,
+		},
+		{name: "YAML null", file: ".imbued.yaml", data: "version: 2\nbackend_type:\n", err: "backend_type: null values aren't supported"},
+		{name: "YAML list", file: ".imbued.yml", data: "- version: 2\n", err: "expected a mapping of keys to values at the top level"},
+	}
+
+	want, err := loadTestConfig(t, tomlData)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	// Backends remember the file that set them, which differs by format
+	want.Backends[DefaultBackendName].Source = ""
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{tt.file: tt.data})
+
+			cfg, err := LoadConfig(filepath.Join(dir, tt.file), BuiltinDefaults())
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("LoadConfig() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+
+			cfg.Backends[DefaultBackendName].Source = ""
+			if cfg.ValidDepth != want.ValidDepth || !reflect.DeepEqual(cfg.Secrets, want.Secrets) || !reflect.DeepEqual(cfg.Backends, want.Backends) {
+				t.Errorf("LoadConfig() = %+v, want %+v", cfg, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/novacove/imbued/pkg/secrets"
+)
+
+// Defaults are the settings configs use when they don't set their own,
+// taken from the user's global config
+type Defaults struct {
+	Backend *Backend       // Backend of configs that don't declare any, nil if unset
+	Policy  secrets.Policy // Policy of backends that don't set their own
+}
+
+// BuiltinDefaults returns the defaults of configs without a global config
+func BuiltinDefaults() Defaults {
+	return Defaults{Policy: secrets.DefaultPolicy}
+}
+
+// GlobalConfig holds the user's settings for the server, the clients, and
+// the configs that don't set their own, read from
+// $XDG_CONFIG_HOME/imbued/config.toml (~/.config/imbued/config.toml)
+type GlobalConfig struct {
+	Path string // File the settings were read from, or "" if there is none
+
+	Socket             string        // Unix socket the server listens on and clients connect to
+	AuthDuration       time.Duration // Duration for which authentication is valid
+	BackendIdleTimeout time.Duration // Duration after which an unused secret backend is closed
+	TrustSignedConfigs bool          // Whether configs signed by a trusted key are used without imbued allow
+	MaxLevels          int           // Maximum number of directory levels to search up for a config, 0 for up to the project root
+
+	LogLevel      slog.Level // Minimum level of the messages written to LogFile
+	LogFile       string     // Log of the client commands
+	AccessLogFile string     // Log of the secret accesses and authentications tracked by the server
+
+	DefaultBackend *Backend       // Backend of configs that don't declare any, nil if unset
+	DefaultPolicy  secrets.Policy // Policy of backends that don't set their own
+
+	meta toml.MetaData // Which keys the file defines
+}
+
+// globalFile is the content of the global config file
+type globalFile struct {
+	Server struct {
+		Socket             string `toml:"socket"`
+		AuthDuration       string `toml:"auth_duration"`
+		BackendIdleTimeout string `toml:"backend_idle_timeout"`
+		TrustSignedConfigs bool   `toml:"trust_signed_configs"`
+	} `toml:"server"`
+
+	Client struct {
+		MaxLevels int `toml:"max_levels"`
+	} `toml:"client"`
+
+	Log struct {
+		Level      string `toml:"level"`
+		File       string `toml:"file"`
+		AccessFile string `toml:"access_file"`
+	} `toml:"log"`
+
+	Defaults struct {
+		BackendType   string            `toml:"backend_type"`
+		BackendConfig map[string]string `toml:"backend_config"`
+		BackendPolicy policyFile        `toml:"backend_policy"`
+	} `toml:"defaults"`
+}
+
+// GlobalConfigPath returns the path of the global config file: the first
+// imbued/config.toml found in $XDG_CONFIG_HOME and $XDG_CONFIG_DIRS, or the
+// one in $XDG_CONFIG_HOME if there is none yet
+func GlobalConfigPath() (string, error) {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" || !filepath.IsAbs(configHome) {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get user home directory: %w", err)
+		}
+		configHome = filepath.Join(homeDir, ".config")
+	}
+
+	configDirs := os.Getenv("XDG_CONFIG_DIRS")
+	if configDirs == "" {
+		configDirs = "/etc/xdg"
+	}
+
+	userPath := filepath.Join(configHome, "imbued", "config.toml")
+	for _, dir := range append([]string{configHome}, filepath.SplitList(configDirs)...) {
+		if !filepath.IsAbs(dir) {
+			continue
+		}
+		path := filepath.Join(dir, "imbued", "config.toml")
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	return userPath, nil
+}
+
+// DefaultGlobalConfig returns the settings used when the global config file
+// doesn't set them
+func DefaultGlobalConfig() (*GlobalConfig, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	imbuedDir := filepath.Join(homeDir, ".imbued")
+
+	return &GlobalConfig{
+		Socket:             filepath.Join(imbuedDir, "imbued.sock"),
+		AuthDuration:       time.Hour,
+		BackendIdleTimeout: 10 * time.Minute,
+		TrustSignedConfigs: true,
+		MaxLevels:          0,
+		LogLevel:           slog.LevelInfo,
+		LogFile:            filepath.Join(imbuedDir, "logs", "info.log"),
+		AccessLogFile:      filepath.Join(imbuedDir, "logs", "imbued.log"),
+		DefaultPolicy:      secrets.DefaultPolicy,
+	}, nil
+}
+
+// LoadGlobalConfig reads the global config file, if there is one, over the
+// default settings
+func LoadGlobalConfig() (*GlobalConfig, error) {
+	global, err := DefaultGlobalConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := GlobalConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	var file globalFile
+	meta, err := toml.DecodeFile(path, &file)
+	if errors.Is(err, os.ErrNotExist) {
+		return global, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode global config %s: %w", path, err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("unknown key %s in global config %s", undecoded[0], path)
+	}
+	global.Path = path
+	global.meta = meta
+
+	if err := global.apply(&file); err != nil {
+		return nil, fmt.Errorf("invalid global config %s: %w", path, err)
+	}
+
+	return global, nil
+}
+
+// apply sets the settings defined by the file
+func (g *GlobalConfig) apply(file *globalFile) error {
+	var err error
+
+	// Paths may use ~ and variables like backend options, and are relative
+	// to the file
+	paths := []struct {
+		key   string
+		value string
+		dest  *string
+	}{
+		{"server.socket", file.Server.Socket, &g.Socket},
+		{"log.file", file.Log.File, &g.LogFile},
+		{"log.access_file", file.Log.AccessFile, &g.AccessLogFile},
+	}
+	for _, p := range paths {
+		if !g.IsSet(p.key) {
+			continue
+		}
+		if *p.dest, err = expandOption(p.value); err != nil {
+			return fmt.Errorf("%s: %w", p.key, err)
+		}
+		if !filepath.IsAbs(*p.dest) {
+			*p.dest = filepath.Join(filepath.Dir(g.Path), *p.dest)
+		}
+	}
+
+	durations := []struct {
+		key   string
+		value string
+		dest  *time.Duration
+	}{
+		{"server.auth_duration", file.Server.AuthDuration, &g.AuthDuration},
+		{"server.backend_idle_timeout", file.Server.BackendIdleTimeout, &g.BackendIdleTimeout},
+	}
+	for _, d := range durations {
+		if !g.IsSet(d.key) {
+			continue
+		}
+		if *d.dest, err = time.ParseDuration(d.value); err != nil {
+			return fmt.Errorf("invalid %s: %w", d.key, err)
+		}
+	}
+
+	if g.IsSet("server.trust_signed_configs") {
+		g.TrustSignedConfigs = file.Server.TrustSignedConfigs
+	}
+
+	if g.IsSet("client.max_levels") {
+		if file.Client.MaxLevels < 0 {
+			return fmt.Errorf("client.max_levels must not be negative")
+		}
+		g.MaxLevels = file.Client.MaxLevels
+	}
+
+	if g.IsSet("log.level") {
+		if err := g.LogLevel.UnmarshalText([]byte(file.Log.Level)); err != nil {
+			return fmt.Errorf("invalid log.level %q (expected debug, info, warn or error)", file.Log.Level)
+		}
+	}
+
+	if g.DefaultPolicy, err = file.Defaults.BackendPolicy.policy(secrets.DefaultPolicy); err != nil {
+		return fmt.Errorf("invalid defaults.backend_policy: %w", err)
+	}
+
+	if file.Defaults.BackendType != "" {
+		if _, ok := secrets.OptionsFor(file.Defaults.BackendType); !ok {
+			return fmt.Errorf("defaults.backend_type has unknown type %q (expected one of %s)",
+				file.Defaults.BackendType, strings.Join(secrets.BackendTypeNames(), ", "))
+		}
+		if err := expandBackendOptions(file.Defaults.BackendConfig, file.Defaults.BackendType, filepath.Dir(g.Path)); err != nil {
+			return fmt.Errorf("invalid defaults.backend_config: %w", err)
+		}
+		g.DefaultBackend = &Backend{
+			Name:   DefaultBackendName,
+			Type:   file.Defaults.BackendType,
+			Config: file.Defaults.BackendConfig,
+			Policy: g.DefaultPolicy,
+			Source: g.Path,
+		}
+	} else if g.IsSet("defaults.backend_config") {
+		return fmt.Errorf("defaults.backend_config is set without defaults.backend_type")
+	}
+
+	return nil
+}
+
+// Defaults returns the settings of the global config used by configs that
+// don't set their own
+func (g *GlobalConfig) Defaults() Defaults {
+	return Defaults{Backend: g.DefaultBackend, Policy: g.DefaultPolicy}
+}
+
+// IsSet reports whether the global config file sets the given dotted key
+func (g *GlobalConfig) IsSet(key string) bool {
+	return g.Path != "" && g.meta.IsDefined(strings.Split(key, ".")...)
+}
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/novacove/imbued/pkg/secrets"
+)
+
+func TestGlobalConfigPath(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string // Directories holding an imbued/config.toml
+		want  string
+	}{
+		{name: "none", want: "home"},
+		{name: "system only", files: []string{"system2"}, want: "system2"},
+		{name: "first system directory first", files: []string{"system1", "system2"}, want: "system1"},
+		{name: "user over system", files: []string{"home", "system1"}, want: "home"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "home"))
+			t.Setenv("XDG_CONFIG_DIRS", filepath.Join(dir, "system1")+string(filepath.ListSeparator)+filepath.Join(dir, "system2"))
+			for _, name := range tt.files {
+				writeFiles(t, dir, map[string]string{filepath.Join(name, "imbued", "config.toml"): ""})
+			}
+
+			got, err := GlobalConfigPath()
+			if err != nil {
+				t.Fatalf("GlobalConfigPath() error = %v", err)
+			}
+			if want := filepath.Join(dir, tt.want, "imbued", "config.toml"); got != want {
+				t.Errorf("GlobalConfigPath() = %s, want %s", got, want)
+			}
+		})
+	}
+
+	t.Run("relative XDG_CONFIG_HOME", func(t *testing.T) {
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		t.Setenv("XDG_CONFIG_HOME", "config")
+		t.Setenv("XDG_CONFIG_DIRS", "")
+
+		got, err := GlobalConfigPath()
+		if err != nil {
+			t.Fatalf("GlobalConfigPath() error = %v", err)
+		}
+		if want := filepath.Join(home, ".config", "imbued", "config.toml"); got != want {
+			t.Errorf("GlobalConfigPath() = %s, want %s", got, want)
+		}
+	})
+}
+
+func TestLoadGlobalConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string // Content of the global config, none if empty
+		check func(t *testing.T, global *GlobalConfig, configDir string)
+		err   string
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, global *GlobalConfig, configDir string) {
+				if global.Path != "" || global.MaxLevels != 0 || global.AuthDuration != time.Hour || !global.TrustSignedConfigs {
+					t.Errorf("settings = %+v, want the defaults", global)
+				}
+				if global.DefaultBackend != nil {
+					t.Errorf("DefaultBackend = %+v, want none", global.DefaultBackend)
+				}
+			},
+		},
+		{
+			name: "settings of the file",
+			data: `[server]
+socket = "run/imbued.sock"
+auth_duration = "15m"
+trust_signed_configs = false
+
+[client]
+max_levels = 5
+
+[log]
+level = "debug"
+file = "~/logs/imbued.log"`,
+			check: func(t *testing.T, global *GlobalConfig, configDir string) {
+				if global.Socket != filepath.Join(configDir, "run", "imbued.sock") {
+					t.Errorf("Socket = %s, want it relative to the file", global.Socket)
+				}
+				if global.AuthDuration != 15*time.Minute || global.TrustSignedConfigs || global.MaxLevels != 5 || global.LogLevel != slog.LevelDebug {
+					t.Errorf("settings = %+v", global)
+				}
+				if home, _ := os.UserHomeDir(); global.LogFile != filepath.Join(home, "logs", "imbued.log") {
+					t.Errorf("LogFile = %s, want it in the home directory", global.LogFile)
+				}
+				// Settings the file doesn't set keep their default
+				if global.BackendIdleTimeout != 10*time.Minute || !global.IsSet("client.max_levels") || global.IsSet("server.backend_idle_timeout") {
+					t.Errorf("BackendIdleTimeout = %s, want the default", global.BackendIdleTimeout)
+				}
+			},
+		},
+		{
+			name: "default backend",
+			data: `[defaults]
+backend_type = "env_file"
+backend_config = { file_path = "secrets.env" }
+backend_policy = { retries = 1 }`,
+			check: func(t *testing.T, global *GlobalConfig, configDir string) {
+				backend := global.DefaultBackend
+				if backend == nil || backend.Type != "env_file" || backend.Config["file_path"] != filepath.Join(configDir, "secrets.env") {
+					t.Fatalf("DefaultBackend = %+v", backend)
+				}
+				if backend.Policy.Retries != 1 || global.DefaultPolicy.Retries != 1 {
+					t.Errorf("retries = %d, want 1", backend.Policy.Retries)
+				}
+			},
+		},
+		{name: "unknown key", data: "[server]\nsocket_path = \"imbued.sock\"", err: "unknown key server.socket_path"},
+		{name: "invalid duration", data: "[server]\nauth_duration = \"1 hour\"", err: "invalid server.auth_duration"},
+		{name: "invalid log level", data: "[log]\nlevel = \"verbose\"", err: `invalid log.level "verbose"`},
+		{name: "negative max_levels", data: "[client]\nmax_levels = -1", err: "client.max_levels must not be negative"},
+		{name: "unknown backend type", data: "[defaults]\nbackend_type = \"consul\"", err: `defaults.backend_type has unknown type "consul"`},
+		{name: "backend_config without a type", data: "[defaults]\nbackend_config = { file_path = \".env\" }", err: "defaults.backend_config is set without defaults.backend_type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("XDG_CONFIG_HOME", dir)
+			t.Setenv("XDG_CONFIG_DIRS", filepath.Join(dir, "system"))
+			configDir := filepath.Join(dir, "imbued")
+			if tt.data != "" {
+				writeFiles(t, configDir, map[string]string{"config.toml": tt.data})
+			}
+
+			global, err := LoadGlobalConfig()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("LoadGlobalConfig() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadGlobalConfig() error = %v", err)
+			}
+			tt.check(t, global, configDir)
+		})
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	policy := secrets.DefaultPolicy
+	policy.Retries = 5
+	defaults := Defaults{
+		Backend: &Backend{Name: DefaultBackendName, Type: "env_file", Config: map[string]string{"file_path": "/etc/imbued/secrets.env"}},
+		Policy:  policy,
+	}
+
+	load := func(data string) *ImbuedConfig {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), ".imbued")
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadConfig(path, defaults)
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+		return cfg
+	}
+
+	// Configs without a backend use the default one
+	cfg := load(`version = 2
+[secrets]
+DB_PASSWORD = "DB_PASSWORD"`)
+	backend, err := cfg.BackendFor("DB_PASSWORD")
+	if err != nil || backend.Config["file_path"] != "/etc/imbued/secrets.env" {
+		t.Errorf("BackendFor() = %+v, %v, want the default backend", backend, err)
+	}
+
+	// Configs declaring a backend keep theirs, with the default policy under
+	// what they set
+	cfg = load(`version = 2
+[backends.vault]
+type = "vault"
+config = { address = "https://vault.example.com", token = "keychain:vault.token" }
+policy = { timeout = "5s" }
+[secrets]
+DB_PASSWORD = "DB_PASSWORD"`)
+	backend, err = cfg.BackendFor("DB_PASSWORD")
+	if err != nil || backend.Name != "vault" {
+		t.Fatalf("BackendFor() = %+v, %v, want vault", backend, err)
+	}
+	if backend.Policy.Retries != 5 || backend.Policy.Timeout != 5*time.Second {
+		t.Errorf("vault policy = %+v, want 5 retries and a 5s timeout", backend.Policy)
+	}
+}
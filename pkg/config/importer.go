@@ -0,0 +1,630 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/novacove/imbued/pkg/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+// ImportFileNames are the files imbued import reads when no file is given,
+// in the order they are read
+var ImportFileNames = []string{".env", ".envrc", ".env.tpl", "docker-compose.yml", "docker-compose.yaml", "compose.yml", "compose.yaml"}
+
+// onePassReferencePrefix starts the 1Password secret references of op
+// templates, e.g. op://Private/Stripe/api_key
+const onePassReferencePrefix = "op://"
+
+// ImportOptions are the choices of an import
+type ImportOptions struct {
+	BackendType string   // Backend type of the config to create, if there is none
+	Backend     string   // Backend of the existing config the values are stored in, instead of its default
+	Prefix      string   // Prepended to the variable names to name the secrets
+	Defaults    Defaults // Settings of the global config the config uses
+}
+
+// ImportedFile is a file variables were imported from
+type ImportedFile struct {
+	Path      string // Path of the file
+	Plaintext bool   // Whether the file holds secret values rather than only references
+	Complete  bool   // Whether every line of the file was imported, so deleting it loses nothing
+}
+
+// importedVar is a variable read from an imported file
+type importedVar struct {
+	env    string // Name of the environment variable
+	value  string // Value, or 1Password reference
+	source string // File the variable was read from
+}
+
+// Import is the result of importing variables from dotenv, direnv, op
+// template and docker-compose files into a config
+type Import struct {
+	Path     string            // Config file the secrets are added to
+	Create   bool              // Whether the config file is created
+	Files    []*ImportedFile   // Files the variables were read from
+	Secrets  map[string]string // Environment variable of each added secret, by secret name
+	Warnings []string          // Variables and lines that weren't imported, and why
+	Data     []byte            // Content of the config file after the import
+
+	values  map[string]string // Values to store in the backend, by secret name
+	backend *Backend          // Backend the values are stored in
+}
+
+// ImportFiles returns the files of dir imbued import reads by default
+func ImportFiles(dir string) []string {
+	var found []string
+	for _, name := range ImportFileNames {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			found = append(found, path)
+		}
+	}
+	return found
+}
+
+// ImportVariables reads the variables of files and prepares adding them as
+// secrets to the config at configPath, which is created if it doesn't exist,
+// without writing anything. Values are stored under their secret name in the
+// backend; 1Password references become secrets of a onepass backend.
+func ImportVariables(configPath string, files []string, opts ImportOptions) (*Import, error) {
+	imp := &Import{
+		Path:    configPath,
+		Secrets: make(map[string]string),
+		values:  make(map[string]string),
+	}
+
+	// Later files take precedence, like in docker-compose
+	vars := make(map[string]importedVar)
+	for _, path := range files {
+		read, err := imp.readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range read {
+			if previous, ok := vars[v.env]; ok && previous.value != v.value {
+				imp.Warnings = append(imp.Warnings, fmt.Sprintf("%s is set by both %s and %s, using %s", v.env, previous.source, v.source, v.source))
+			}
+			vars[v.env] = v
+		}
+	}
+
+	var file *configFile
+	var cfg *ImbuedConfig
+	if _, err := os.Stat(configPath); err == nil {
+		if format := FormatOf(configPath); format != FormatTOML {
+			return nil, fmt.Errorf("can't add secrets to %s automatically: only TOML configs are supported, update the %s file by hand", configPath, strings.ToUpper(string(format)))
+		}
+		if file, err = decodeConfigFile(configPath); err != nil {
+			return nil, err
+		}
+		if cfg, err = LoadConfig(configPath, opts.Defaults); err != nil {
+			return nil, err
+		}
+	} else if errors.Is(err, os.ErrNotExist) {
+		imp.Create = true
+	} else {
+		return nil, fmt.Errorf("failed to stat config file: %w", err)
+	}
+
+	hasValues := false
+	for _, v := range vars {
+		if !strings.HasPrefix(v.value, onePassReferencePrefix) {
+			hasValues = true
+		}
+	}
+
+	backendType, err := imp.chooseBackend(cfg, opts, hasValues)
+	if err != nil {
+		return nil, err
+	}
+
+	// References are read from a onepass backend, declared if the config
+	// has none
+	onePassBackend, declareOnePass := "", false
+	if backendType != string(secrets.OnePass) {
+		onePassBackend, declareOnePass = string(secrets.OnePass), true
+		if cfg != nil {
+			for _, name := range cfg.BackendNames() {
+				if cfg.Backends[name].Type == string(secrets.OnePass) {
+					onePassBackend, declareOnePass = name, false
+					break
+				}
+			}
+		}
+		if declareOnePass && cfg != nil && cfg.Backends[onePassBackend] != nil {
+			return nil, fmt.Errorf("backend %q of %s isn't a onepass backend, declare one to import 1Password references", onePassBackend, configPath)
+		}
+	}
+
+	exported := make(map[string]string)
+	if cfg != nil {
+		exported = cfg.exportedBy()
+		for name := range cfg.Env {
+			exported[name] = "env " + name
+		}
+	}
+
+	var entries []string
+	needsOnePass := false
+	envNames := sortedKeys(vars)
+	for _, env := range envNames {
+		v := vars[env]
+		if owner, ok := exported[env]; ok {
+			imp.Warnings = append(imp.Warnings, fmt.Sprintf("%s is already exported by %s of the config, skipped", env, owner))
+			continue
+		}
+
+		name, fields, value := opts.Prefix+env, []string{fmt.Sprintf("env = %q", env)}, v.value
+		if reference, ok := strings.CutPrefix(v.value, onePassReferencePrefix); ok {
+			item, field, err := parseOnePassReference(reference)
+			if err != nil {
+				imp.Warnings = append(imp.Warnings, fmt.Sprintf("%s of %s: %v, skipped", env, v.source, err))
+				continue
+			}
+			// Several variables may read fields of the same item
+			fields = append(fields, fmt.Sprintf("name = %q", item), fmt.Sprintf("field = %q", field))
+			if onePassBackend != "" {
+				fields = append(fields, fmt.Sprintf("backend = %q", onePassBackend))
+			}
+			value = ""
+		} else if opts.Backend != "" {
+			fields = append(fields, fmt.Sprintf("backend = %q", opts.Backend))
+		}
+
+		if cfg != nil && cfg.Secrets[name] != nil {
+			imp.Warnings = append(imp.Warnings, fmt.Sprintf("%s: secret %s is already declared by the config, skipped", env, name))
+			continue
+		}
+
+		if value != "" {
+			imp.values[name] = value
+		} else if onePassBackend != "" {
+			needsOnePass = true
+		}
+		imp.Secrets[name] = env
+		entries = append(entries, fmt.Sprintf("%s = { %s }", toml.Key{name}, strings.Join(fields, ", ")))
+	}
+
+	var tables []string
+	if needsOnePass && declareOnePass {
+		tables = append(tables, fmt.Sprintf("[backends.%s]", onePassBackend), fmt.Sprintf("type = %q", secrets.OnePass))
+	}
+
+	if imp.Create {
+		imp.Data = newImportedConfig(backendType, opts.BackendType != "" || opts.Defaults.Backend == nil, entries, tables)
+	} else {
+		if imp.Data, err = insertSecrets(configPath, file, entries, tables); err != nil {
+			return nil, err
+		}
+	}
+
+	// Make sure the result still decodes
+	if _, err := decodeConfigData(configPath, imp.Data); err != nil {
+		return nil, fmt.Errorf("imported config is invalid: %w", err)
+	}
+
+	return imp, nil
+}
+
+// chooseBackend picks the backend the imported values are stored in and
+// returns the type of the backend secrets without a backend key are read
+// from, or an empty string if there is none
+func (imp *Import) chooseBackend(cfg *ImbuedConfig, opts ImportOptions, hasValues bool) (string, error) {
+	if cfg == nil {
+		if opts.Backend != "" {
+			return "", fmt.Errorf("%s doesn't exist, choose the type of its backend instead of a backend name", imp.Path)
+		}
+
+		switch {
+		case opts.BackendType != "":
+			options, ok := secrets.OptionsFor(opts.BackendType)
+			if !ok {
+				return "", fmt.Errorf("unknown backend type %q (expected one of %s)", opts.BackendType, strings.Join(secrets.BackendTypeNames(), ", "))
+			}
+			// A new config only declares the backend type
+			for _, option := range options {
+				if option.Required && hasValues {
+					return "", fmt.Errorf("backend type %s needs %s, create %s with its backend_config first", opts.BackendType, option.Name, imp.Path)
+				}
+			}
+			imp.backend = &Backend{Name: DefaultBackendName, Type: opts.BackendType, Policy: opts.Defaults.Policy}
+		case opts.Defaults.Backend != nil:
+			imp.backend = opts.Defaults.Backend
+		case !hasValues:
+			// References alone only need 1Password
+			return string(secrets.OnePass), nil
+		default:
+			return "", fmt.Errorf("choose the backend type to store the values in, as the global config sets no default backend")
+		}
+		return imp.backend.Type, nil
+	}
+
+	if opts.BackendType != "" {
+		return "", fmt.Errorf("%s already exists, choose one of its backends (%s) instead of a backend type", imp.Path, strings.Join(cfg.BackendNames(), ", "))
+	}
+
+	var defaultType string
+	if len(cfg.DefaultBackends) > 0 {
+		if backend, ok := cfg.Backends[cfg.DefaultBackends[0]]; ok {
+			imp.backend = backend
+			defaultType = backend.Type
+		}
+	}
+	if opts.Backend != "" {
+		backend, ok := cfg.Backends[opts.Backend]
+		if !ok {
+			return "", fmt.Errorf("%s has no backend %q (expected one of %s)", imp.Path, opts.Backend, strings.Join(cfg.BackendNames(), ", "))
+		}
+		imp.backend = backend
+	}
+	if imp.backend == nil && hasValues {
+		return "", fmt.Errorf("%s has no default backend, choose one of its backends to store the values in", imp.Path)
+	}
+
+	return defaultType, nil
+}
+
+// Write stores the imported values in the backend, then writes the config.
+// The imported files are left as they are.
+func (imp *Import) Write(ctx context.Context) error {
+	if len(imp.values) > 0 {
+		pool := secrets.NewPool(time.Minute)
+		defer pool.Close()
+
+		backend, release, err := pool.Acquire(ctx, imp.Path, imp.backend.Source, imp.backend.Type, imp.backend.Config, imp.backend.Policy)
+		if err != nil {
+			return fmt.Errorf("failed to get secret backend: %w", err)
+		}
+		defer release()
+
+		if err := backend.StoreSecrets(ctx, imp.values); err != nil {
+			return fmt.Errorf("failed to store secrets in the %s backend: %w", imp.backend.Type, err)
+		}
+	}
+
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(imp.Path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if err := os.WriteFile(imp.Path, imp.Data, perm); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	return nil
+}
+
+// BackendType returns the type of the backend the values are stored in, or
+// an empty string if only references were imported
+func (imp *Import) BackendType() string {
+	if len(imp.values) == 0 || imp.backend == nil {
+		return ""
+	}
+	return imp.backend.Type
+}
+
+// readFile reads the variables of an imported file, and of the env files of
+// a docker-compose file
+func (imp *Import) readFile(path string) ([]importedVar, error) {
+	name := filepath.Base(path)
+	if strings.HasPrefix(name, "docker-compose") || strings.HasPrefix(name, "compose") {
+		envFiles, err := composeEnvFiles(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var vars []importedVar
+		for _, envFile := range envFiles {
+			read, err := imp.readFile(envFile)
+			if err != nil {
+				return nil, err
+			}
+			vars = append(vars, read...)
+		}
+		return vars, nil
+	}
+
+	for _, f := range imp.Files {
+		if f.Path == path {
+			return nil, nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	// direnv runs .envrc as a shell script, only its exports are imported
+	vars, skipped := parseDotenv(path, data, name == ".envrc")
+	imp.Warnings = append(imp.Warnings, skipped...)
+
+	f := &ImportedFile{Path: path, Complete: len(skipped) == 0}
+	for _, v := range vars {
+		if !strings.HasPrefix(v.value, onePassReferencePrefix) {
+			f.Plaintext = true
+		}
+	}
+	imp.Files = append(imp.Files, f)
+
+	return vars, nil
+}
+
+// parseDotenv reads the KEY=VALUE lines of a dotenv file, which may start
+// with export. With exportsOnly, other lines are skipped. It returns the
+// variables and a warning for each line that was skipped.
+func parseDotenv(path string, data []byte, exportsOnly bool) ([]importedVar, []string) {
+	var vars []importedVar
+	var skipped []string
+	skip := func(n int, reason string) {
+		skipped = append(skipped, fmt.Sprintf("%s:%d: %s, skipped", path, n, reason))
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rest, exported := strings.CutPrefix(line, "export ")
+		if exportsOnly && !exported {
+			skip(n, "only export lines are imported from direnv files")
+			continue
+		}
+
+		env, value, ok := strings.Cut(strings.TrimSpace(rest), "=")
+		if !ok || !envNamePattern.MatchString(env) {
+			skip(n, "not a VARIABLE=value line")
+			continue
+		}
+
+		value, err := unquoteDotenv(value)
+		if err != nil {
+			skip(n, fmt.Sprintf("%s %v", env, err))
+			continue
+		}
+		if value == "" {
+			skip(n, fmt.Sprintf("%s is empty", env))
+			continue
+		}
+
+		// op inject templates wrap references in {{ }}
+		if inner, ok := strings.CutPrefix(value, "{{"); ok {
+			if inner, ok := strings.CutSuffix(inner, "}}"); ok && strings.HasPrefix(strings.TrimSpace(inner), onePassReferencePrefix) {
+				value = strings.TrimSpace(inner)
+			}
+		}
+
+		vars = append(vars, importedVar{env: env, value: value, source: path})
+	}
+
+	return vars, skipped
+}
+
+// unquoteDotenv returns the value of a dotenv variable. Values using shell
+// expansion are refused, as their value isn't known until a shell runs them.
+func unquoteDotenv(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+
+	var value, rest string
+	switch raw[0] {
+	case '\'':
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("has an unterminated or multi-line quoted value")
+		}
+		value, rest = raw[1:end+1], raw[end+2:]
+	case '"':
+		var b strings.Builder
+		end := -1
+		for i := 1; i < len(raw); i++ {
+			c := raw[i]
+			if c == '\\' && i+1 < len(raw) {
+				i++
+				switch raw[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(raw[i])
+				}
+				continue
+			}
+			if c == '$' {
+				return "", fmt.Errorf("uses shell expansion, import it by hand")
+			}
+			if c == '"' {
+				end = i
+				break
+			}
+			b.WriteByte(c)
+		}
+		if end < 0 {
+			return "", fmt.Errorf("has an unterminated or multi-line quoted value")
+		}
+		value, rest = b.String(), raw[end+1:]
+	default:
+		value = raw
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = value[:i]
+		}
+		value = strings.TrimSpace(value)
+		if strings.ContainsAny(value, "$`") {
+			return "", fmt.Errorf("uses shell expansion, import it by hand")
+		}
+	}
+
+	if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+		return "", fmt.Errorf("has text after its quoted value")
+	}
+	return value, nil
+}
+
+// parseOnePassReference returns the item, as vault/item, and the field of a
+// 1Password reference, given without its op:// prefix:
+// vault/item[/section]/field
+func parseOnePassReference(reference string) (string, string, error) {
+	parts := strings.Split(reference, "/")
+	if len(parts) < 3 || len(parts) > 4 {
+		return "", "", fmt.Errorf("expected a reference like op://vault/item/field, got op://%s", reference)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return "", "", fmt.Errorf("expected a reference like op://vault/item/field, got op://%s", reference)
+		}
+	}
+	return parts[0] + "/" + parts[1], parts[len(parts)-1], nil
+}
+
+// composeEnvFiles returns the env files the services of a docker-compose
+// file read, relative to the compose file's directory
+func composeEnvFiles(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var compose struct {
+		Services map[string]struct {
+			EnvFile interface{} `yaml:"env_file"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	var files []string
+	seen := make(map[string]bool)
+	add := func(service string, entry interface{}) error {
+		file, required := "", true
+		switch v := entry.(type) {
+		case string:
+			file = v
+		case map[string]interface{}:
+			file, _ = v["path"].(string)
+			if r, ok := v["required"].(bool); ok {
+				required = r
+			}
+		}
+		if file == "" {
+			return fmt.Errorf("%s: env_file of service %s must be a path or a list of paths", path, service)
+		}
+
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(path), file)
+		}
+		if _, err := os.Stat(file); err != nil && !required {
+			return nil
+		}
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+		return nil
+	}
+
+	for _, service := range sortedKeys(compose.Services) {
+		switch v := compose.Services[service].EnvFile.(type) {
+		case nil:
+		case []interface{}:
+			for _, entry := range v {
+				if err := add(service, entry); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			if err := add(service, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// newImportedConfig returns the content of a config holding the imported
+// secrets
+func newImportedConfig(backendType string, declareType bool, entries, tables []string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "version = %d\n", CurrentVersion)
+	if declareType && backendType != "" {
+		fmt.Fprintf(&b, "backend_type = %q\n", backendType)
+	}
+	b.WriteString("\n[secrets]\n")
+	for _, entry := range entries {
+		b.WriteString(entry + "\n")
+	}
+	if len(tables) > 0 {
+		b.WriteString("\n" + strings.Join(tables, "\n") + "\n")
+	}
+	return []byte(b.String())
+}
+
+// insertSecrets adds entries to the [secrets] table of the config file at
+// configPath, and appends tables to it. Comments and layout are kept.
+func insertSecrets(configPath string, file *configFile, entries, tables []string) ([]byte, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", configPath, err)
+	}
+	if len(entries) == 0 {
+		return data, nil
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	header, last := -1, -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			if header >= 0 {
+				break
+			}
+			if table, _, _ := strings.Cut(trimmed, "#"); strings.TrimSpace(table) == "[secrets]" {
+				header, last = i, i
+			}
+			continue
+		}
+		if header >= 0 && trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			last = i
+		}
+	}
+
+	if header >= 0 {
+		lines = append(lines[:last+1], append(entries, lines[last+1:]...)...)
+	} else {
+		if file.meta.IsDefined("secrets") {
+			return nil, fmt.Errorf("can't add secrets to %s automatically: its secrets aren't declared in a [secrets] table, add them by hand", configPath)
+		}
+		lines = append(lines, "", "[secrets]")
+		lines = append(lines, entries...)
+	}
+	if len(tables) > 0 {
+		lines = append(lines, "")
+		lines = append(lines, tables...)
+	}
+
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+// SortedSecrets returns the names of the imported secrets, sorted by the
+// variable they are exported as
+func (imp *Import) SortedSecrets() []string {
+	names := sortedKeys(imp.Secrets)
+	sort.SliceStable(names, func(i, j int) bool { return imp.Secrets[names[i]] < imp.Secrets[names[j]] })
+	return names
+}
@@ -0,0 +1,294 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/novacove/imbued/pkg/secrets"
+)
+
+func TestUnquoteDotenv(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+		err  string
+	}{
+		{raw: "value", want: "value"},
+		{raw: "  value  ", want: "value"},
+		{raw: "value # comment", want: "value"},
+		{raw: "value#not-a-comment", want: "value#not-a-comment"},
+		{raw: "", want: ""},
+		{raw: `'single $quoted'`, want: "single $quoted"},
+		{raw: `'a' # comment`, want: "a"},
+		{raw: `"double quoted"`, want: "double quoted"},
+		{raw: `"line\nbreak\ttab \"quote\" \\ \$HOME"`, want: "line\nbreak\ttab \"quote\" \\ $HOME"},
+		{raw: `"a" # comment`, want: "a"},
+		{raw: `""`, want: ""},
+		{raw: `$HOME/bin`, err: "uses shell expansion"},
+		{raw: "`date`", err: "uses shell expansion"},
+		{raw: `"${HOME}"`, err: "uses shell expansion"},
+		{raw: `'unterminated`, err: "has an unterminated or multi-line quoted value"},
+		{raw: `"unterminated`, err: "has an unterminated or multi-line quoted value"},
+		{raw: `"a"b`, err: "has text after its quoted value"},
+		{raw: `'a' 'b'`, err: "has text after its quoted value"},
+	}
+
+	for _, tt := range tests {
+		got, err := unquoteDotenv(tt.raw)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("unquoteDotenv(%q) = %q, %v, want error %q", tt.raw, got, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("unquoteDotenv(%q) = %q, %v, want %q", tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseDotenv(t *testing.T) {
+	data := []byte(`# Database
+DB_HOST=localhost
+export DB_PASSWORD="s3cr3t" # dev only
+
+API_KEY={{ op://Private/Stripe/api_key }}
+TOKEN=op://Private/GitHub/token
+EMPTY=
+PATH_EXT=$HOME/bin
+not a variable
+1BAD=value
+`)
+
+	tests := []struct {
+		name        string
+		exportsOnly bool
+		want        []importedVar
+		skipped     []string
+	}{
+		{
+			name: "dotenv",
+			want: []importedVar{
+				{env: "DB_HOST", value: "localhost", source: ".env"},
+				{env: "DB_PASSWORD", value: "s3cr3t", source: ".env"},
+				{env: "API_KEY", value: "op://Private/Stripe/api_key", source: ".env"},
+				{env: "TOKEN", value: "op://Private/GitHub/token", source: ".env"},
+			},
+			skipped: []string{
+				".env:7: EMPTY is empty, skipped",
+				".env:8: PATH_EXT uses shell expansion, import it by hand, skipped",
+				".env:9: not a VARIABLE=value line, skipped",
+				".env:10: not a VARIABLE=value line, skipped",
+			},
+		},
+		{
+			name:        "direnv",
+			exportsOnly: true,
+			want: []importedVar{
+				{env: "DB_PASSWORD", value: "s3cr3t", source: ".env"},
+			},
+			skipped: []string{
+				".env:2: only export lines are imported from direnv files, skipped",
+				".env:5: only export lines are imported from direnv files, skipped",
+				".env:6: only export lines are imported from direnv files, skipped",
+				".env:7: only export lines are imported from direnv files, skipped",
+				".env:8: only export lines are imported from direnv files, skipped",
+				".env:9: only export lines are imported from direnv files, skipped",
+				".env:10: only export lines are imported from direnv files, skipped",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars, skipped := parseDotenv(".env", data, tt.exportsOnly)
+			if !reflect.DeepEqual(vars, tt.want) {
+				t.Errorf("parseDotenv() vars = %+v, want %+v", vars, tt.want)
+			}
+			if !reflect.DeepEqual(skipped, tt.skipped) {
+				t.Errorf("parseDotenv() skipped = %q, want %q", skipped, tt.skipped)
+			}
+		})
+	}
+}
+
+func TestParseOnePassReference(t *testing.T) {
+	tests := []struct {
+		reference string
+		item      string
+		field     string
+		err       bool
+	}{
+		{reference: "Private/Stripe/api_key", item: "Private/Stripe", field: "api_key"},
+		{reference: "Private/Stripe/live/api_key", item: "Private/Stripe", field: "api_key"},
+		{reference: "Stripe/api_key", err: true},
+		{reference: "Private/Stripe/live/keys/api_key", err: true},
+		{reference: "Private//api_key", err: true},
+	}
+
+	for _, tt := range tests {
+		item, field, err := parseOnePassReference(tt.reference)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseOnePassReference(%q) = %q, %q, want an error", tt.reference, item, field)
+			}
+			continue
+		}
+		if err != nil || item != tt.item || field != tt.field {
+			t.Errorf("parseOnePassReference(%q) = %q, %q, %v, want %q, %q", tt.reference, item, field, err, tt.item, tt.field)
+		}
+	}
+}
+
+func TestComposeEnvFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		compose string
+		files   []string // Files created next to the compose file
+		want    []string
+		err     string
+	}{
+		{
+			name: "path",
+			compose: `services:
+  web:
+    env_file: .env
+`,
+			want: []string{".env"},
+		},
+		{
+			name: "list shared by services",
+			compose: `services:
+  worker:
+    env_file:
+      - .env
+      - worker.env
+  web:
+    env_file: [.env, config/web.env]
+  db:
+    image: postgres
+`,
+			want: []string{".env", "config/web.env", "worker.env"},
+		},
+		{
+			name: "optional files",
+			compose: `services:
+  web:
+    env_file:
+      - path: .env
+      - path: .env.local
+        required: false
+      - path: .env.override
+        required: false
+`,
+			files: []string{".env.override"},
+			want:  []string{".env", ".env.override"},
+		},
+		{
+			name: "missing required file",
+			compose: `services:
+  web:
+    env_file:
+      - path: .env.local
+        required: true
+`,
+			want: []string{".env.local"},
+		},
+		{
+			name: "absolute path",
+			compose: `services:
+  web:
+    env_file: /etc/app.env
+`,
+			want: []string{"/etc/app.env"},
+		},
+		{
+			name: "invalid entry",
+			compose: `services:
+  web:
+    env_file:
+      - required: false
+`,
+			err: "env_file of service web must be a path or a list of paths",
+		},
+		{
+			name:    "invalid YAML",
+			compose: "services: [",
+			err:     "failed to decode",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "docker-compose.yml")
+			if err := os.WriteFile(path, []byte(tt.compose), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			for _, file := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, file), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			files, err := composeEnvFiles(path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("composeEnvFiles() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("composeEnvFiles() error = %v", err)
+			}
+
+			var want []string
+			for _, file := range tt.want {
+				if !filepath.IsAbs(file) {
+					file = filepath.Join(dir, file)
+				}
+				want = append(want, file)
+			}
+			if !reflect.DeepEqual(files, want) {
+				t.Errorf("composeEnvFiles() = %q, want %q", files, want)
+			}
+		})
+	}
+}
+
+func TestImportVariablesOnePassItems(t *testing.T) {
+	dir := t.TempDir()
+	template := filepath.Join(dir, ".env.tpl")
+	data := `STRIPE_KEY={{ op://Private/Stripe/api_key }}
+WORK_STRIPE_KEY={{ op://Work/Stripe/api_key }}
+STRIPE_SECRET=op://Private/Stripe/live/secret
+`
+	if err := os.WriteFile(template, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	imp, err := ImportVariables(filepath.Join(dir, ".imbued"), []string{template}, ImportOptions{BackendType: string(secrets.OnePass)})
+	if err != nil {
+		t.Fatalf("ImportVariables() error = %v", err)
+	}
+
+	want := map[string]string{"STRIPE_KEY": "STRIPE_KEY", "WORK_STRIPE_KEY": "WORK_STRIPE_KEY", "STRIPE_SECRET": "STRIPE_SECRET"}
+	if !reflect.DeepEqual(imp.Secrets, want) {
+		t.Errorf("ImportVariables() secrets = %v, want %v", imp.Secrets, want)
+	}
+	for _, entry := range []string{
+		`STRIPE_KEY = { env = "STRIPE_KEY", name = "Private/Stripe", field = "api_key" }`,
+		`WORK_STRIPE_KEY = { env = "WORK_STRIPE_KEY", name = "Work/Stripe", field = "api_key" }`,
+		`STRIPE_SECRET = { env = "STRIPE_SECRET", name = "Private/Stripe", field = "secret" }`,
+	} {
+		if !strings.Contains(string(imp.Data), entry) {
+			t.Errorf("ImportVariables() data =\n%s\nwant an entry %s", imp.Data, entry)
+		}
+	}
+	if backendType := imp.BackendType(); backendType != "" {
+		t.Errorf("ImportVariables() backend type = %q, want none as there are no values to store", backendType)
+	}
+}
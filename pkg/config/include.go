@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// setKeys are the top-level keys an included set may declare
+var setKeys = []string{"version", "secrets", "templates", "env", "backends", "secret_backends", "secret_cache_ttl"}
+
+// includePaths returns the paths of the sets the file includes. Paths may
+// use ~ and variables like backend options, and are relative to the file.
+func (f *configFile) includePaths() ([]string, error) {
+	paths := make([]string, 0, len(f.Include))
+	seen := make(map[string]bool, len(f.Include))
+
+	for _, include := range f.Include {
+		path, err := expandOption(include)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include %q in %s: %w", include, f.path, err)
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(f.path), path)
+		}
+
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		if seen[absPath] {
+			return nil, fmt.Errorf("config %s includes %s more than once", f.path, include)
+		}
+		seen[absPath] = true
+
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// loadSets reads the sets the file includes, reading each with decode. Sets
+// may only declare entries, and no two sets of a file may declare the same
+// entry.
+func (f *configFile) loadSets(decode func(path string) (*configFile, error)) ([]*configFile, error) {
+	paths, err := f.includePaths()
+	if err != nil {
+		return nil, err
+	}
+
+	sets := make([]*configFile, 0, len(paths))
+	owners := make(map[string]string)
+	for _, path := range paths {
+		set, err := decode(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range set.meta.Keys() {
+			if len(key) == 1 && !containsString(setKeys, key[0]) {
+				return nil, fmt.Errorf("set %s included by %s can't set %s (sets may only set %s)",
+					path, f.path, key[0], strings.Join(setKeys, ", "))
+			}
+		}
+
+		for _, entry := range set.entries() {
+			if owner, ok := owners[entry]; ok {
+				return nil, fmt.Errorf("%s is declared by both %s and %s, included by %s", entry, owner, path, f.path)
+			}
+			owners[entry] = path
+		}
+
+		sets = append(sets, set)
+	}
+
+	return sets, nil
+}
+
+// entries returns descriptions of the named entries the file declares, such
+// as `secret "GITHUB_TOKEN"`
+func (f *configFile) entries() []string {
+	var entries []string
+	add := func(kind string, names []string) {
+		for _, name := range names {
+			entries = append(entries, fmt.Sprintf("%s %q", kind, name))
+		}
+	}
+
+	add("secret", sortedKeys(f.Secrets))
+	add("template", sortedKeys(f.Templates))
+	add("env value", sortedKeys(f.Env))
+	add("backend", sortedKeys(f.Backends))
+	add("secret_backends entry", sortedKeys(f.SecretBackends))
+	add("secret_cache_ttl entry", sortedKeys(f.SecretCacheTTL))
+
+	return entries
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadSets(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string // Sets, relative to the directory of the files
+		err   string
+	}{
+		{
+			name: "missing set",
+			files: map[string]string{
+				".imbued": `include = ["sets/db.imbued"]`,
+			},
+			err: "failed to read config file",
+		},
+		{
+			name: "entries of each set",
+			files: map[string]string{
+				".imbued": `include = ["sets/db.imbued", "sets/api.imbued"]`,
+				"sets/db.imbued": `[secrets]
+DB_PASSWORD = { env = "DB_PASSWORD" }`,
+				"sets/api.imbued": `version = 2
+
+[secrets]
+API_KEY = { env = "API_KEY" }
+
+[backends.vault]
+type = "vault"`,
+			},
+			want: []string{"sets/db.imbued", "sets/api.imbued"},
+		},
+		{
+			name: "same secret in two sets",
+			files: map[string]string{
+				".imbued":    `include = ["db.imbued", "api.imbued"]`,
+				"db.imbued":  `secrets.TOKEN = { env = "DB_TOKEN" }`,
+				"api.imbued": `secrets.TOKEN = { env = "API_TOKEN" }`,
+			},
+			err: `secret "TOKEN" is declared by both`,
+		},
+		{
+			name: "same backend in two sets",
+			files: map[string]string{
+				".imbued":    `include = ["db.imbued", "api.imbued"]`,
+				"db.imbued":  `backends.vault.type = "vault"`,
+				"api.imbued": `backends.vault.type = "vault"`,
+			},
+			err: `backend "vault" is declared by both`,
+		},
+		{
+			name: "different kinds of entries with the same name",
+			files: map[string]string{
+				".imbued":    `include = ["db.imbued", "api.imbued"]`,
+				"db.imbued":  `secrets.TOKEN = { env = "TOKEN" }`,
+				"api.imbued": `templates.TOKEN = "{{ .TOKEN }}"`,
+			},
+			want: []string{"db.imbued", "api.imbued"},
+		},
+		{
+			name: "set with a top-level setting",
+			files: map[string]string{
+				".imbued":   `include = ["db.imbued"]`,
+				"db.imbued": `backend_type = "vault"`,
+			},
+			err: "can't set backend_type",
+		},
+		{
+			name: "included twice",
+			files: map[string]string{
+				".imbued":   `include = ["db.imbued", "./sets/../db.imbued"]`,
+				"db.imbued": "",
+			},
+			err: "includes ./sets/../db.imbued more than once",
+		},
+		{
+			name: "unknown variable",
+			files: map[string]string{
+				".imbued": `include = ["${PROJECT}/db.imbued"]`,
+			},
+			err: "unknown variable ${PROJECT}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+
+			file, err := decodeConfigFile(filepath.Join(dir, ".imbued"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sets, err := file.loadSets(decodeConfigFile)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("loadSets() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadSets() error = %v", err)
+			}
+
+			var got []string
+			for _, set := range sets {
+				path, err := filepath.Rel(dir, set.path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, filepath.ToSlash(path))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadSets() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
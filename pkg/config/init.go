@@ -0,0 +1,95 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/novacove/imbued/pkg/secrets"
+)
+
+// InitOptions describe the config created by imbued init
+type InitOptions struct {
+	Path          string            // Config file to create
+	BackendType   string            // Backend type, or "" to use defaults.backend_type of the global config
+	BackendConfig map[string]string // Backend options
+	BackendNote   string            // Where the backend was found, written as a comment
+	Prefix        string            // Prepended to the variable names to name the secrets
+	EnvNames      []string          // Environment variables the project needs
+}
+
+// InitialConfig returns the commented content of a new config exporting
+// the given environment variables as secrets
+func InitialConfig(opts InitOptions) ([]byte, error) {
+	for _, env := range opts.EnvNames {
+		if !envNamePattern.MatchString(env) {
+			return nil, fmt.Errorf("invalid environment variable name %q", env)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("# Secrets and values imbued injects into shells in this project.\n")
+	b.WriteString("# Run `imbued allow` again after every change to this file.\n\n")
+
+	b.WriteString("# Format version of the file\n")
+	fmt.Fprintf(&b, "version = %d\n\n", CurrentVersion)
+
+	if opts.BackendType != "" {
+		b.WriteString("# Type of secret backend to use")
+		if opts.BackendNote != "" {
+			fmt.Fprintf(&b, " (%s)", opts.BackendNote)
+		}
+		fmt.Fprintf(&b, "\nbackend_type = %q\n", opts.BackendType)
+		if len(opts.BackendConfig) > 0 {
+			options := make([]string, 0, len(opts.BackendConfig))
+			for _, name := range sortedKeys(opts.BackendConfig) {
+				options = append(options, fmt.Sprintf("%s = %q", name, opts.BackendConfig[name]))
+			}
+			b.WriteString("# Settings of the backend, credentials are kept in the keychain\n")
+			fmt.Fprintf(&b, "backend_config = { %s }\n", strings.Join(options, ", "))
+		} else if options, _ := secrets.OptionsFor(opts.BackendType); len(options) > 0 {
+			// Leave the settings to fill in, credentials are best read from the
+			// environment or moved to the keychain with imbued config migrate
+			b.WriteString("# Settings of the backend:\n")
+			placeholders := make([]string, 0, len(options))
+			for _, option := range options {
+				required := ""
+				if option.Required {
+					required = ", required"
+					placeholders = append(placeholders, fmt.Sprintf("%s = \"\"", option.Name))
+				}
+				fmt.Fprintf(&b, "#   %s: %s%s\n", option.Name, option.Description, required)
+			}
+			fmt.Fprintf(&b, "# backend_config = { %s }\n", strings.Join(placeholders, ", "))
+		}
+	} else {
+		b.WriteString("# Secrets are read from defaults.backend_type of the global config,\n")
+		b.WriteString("# set backend_type to use another backend\n")
+		b.WriteString("# backend_type = \"macos_keychain_manager\"\n")
+	}
+	b.WriteString("\n")
+
+	b.WriteString("# Number of subdirectories down the secrets are available in\n")
+	b.WriteString("valid_depth = 1\n\n")
+
+	b.WriteString("# Secrets to retrieve, and the environment variables they are exported as.\n")
+	b.WriteString("# Store a value with `imbued client set-secret --name <secret>`.\n")
+	b.WriteString("[secrets]\n")
+	for _, env := range opts.EnvNames {
+		fmt.Fprintf(&b, "%s = { env = %q }\n", toml.Key{opts.Prefix + env}, env)
+	}
+	b.WriteString("\n")
+
+	b.WriteString("# Non-sensitive values, set without authentication\n")
+	b.WriteString("# [env]\n")
+	b.WriteString("# LOG_LEVEL = \"debug\"\n")
+
+	data := []byte(b.String())
+
+	// Make sure the result decodes
+	if _, err := decodeConfigData(opts.Path, data); err != nil {
+		return nil, fmt.Errorf("generated config is invalid: %w", err)
+	}
+
+	return data, nil
+}
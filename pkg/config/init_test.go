@@ -0,0 +1,93 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestInitialConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     InitOptions
+		contains []string
+		err      string
+	}{
+		{
+			name: "backend with options",
+			opts: InitOptions{
+				BackendType:   "env_file",
+				BackendConfig: map[string]string{"file_path": ".env.secrets"},
+				BackendNote:   "found .env.secrets",
+				Prefix:        "app/",
+				EnvNames:      []string{"DB_PASSWORD", "API_KEY"},
+			},
+			contains: []string{
+				"# Type of secret backend to use (found .env.secrets)\nbackend_type = \"env_file\"\n",
+				`backend_config = { file_path = ".env.secrets" }`,
+				`"app/DB_PASSWORD" = { env = "DB_PASSWORD" }`,
+			},
+		},
+		{
+			name: "backend options to fill in",
+			opts: InitOptions{BackendType: "vault", EnvNames: []string{"API_KEY"}},
+			contains: []string{
+				"#   token: ",
+				`# backend_config = { address = "", token = "" }`,
+			},
+		},
+		{
+			name:     "backend of the global config",
+			opts:     InitOptions{EnvNames: []string{"API_KEY"}},
+			contains: []string{"# backend_type = \"macos_keychain_manager\"\n"},
+		},
+		{
+			name: "invalid variable name",
+			opts: InitOptions{BackendType: "env_file", EnvNames: []string{"API-KEY"}},
+			err:  `invalid environment variable name "API-KEY"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Path = filepath.Join(t.TempDir(), ".imbued")
+			data, err := InitialConfig(tt.opts)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("InitialConfig() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InitialConfig() error = %v", err)
+			}
+
+			for _, want := range tt.contains {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("InitialConfig() =\n%s\nwant it to contain %q", data, want)
+				}
+			}
+
+			// The config is up to date and exports every variable
+			file, err := decodeConfigData(tt.opts.Path, data)
+			if err != nil {
+				t.Fatalf("decodeConfigData() error = %v", err)
+			}
+			if file.version() != CurrentVersion {
+				t.Errorf("version = %d, want %d", file.version(), CurrentVersion)
+			}
+			var envNames []string
+			for _, name := range sortedKeys(file.Secrets) {
+				envNames = append(envNames, file.Secrets[name].Env...)
+			}
+			want := append([]string{}, tt.opts.EnvNames...)
+			sort.Strings(envNames)
+			sort.Strings(want)
+			if !reflect.DeepEqual(envNames, want) {
+				t.Errorf("exported variables = %q, want %q", envNames, want)
+			}
+		})
+	}
+}
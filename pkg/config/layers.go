@@ -0,0 +1,195 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// loadLayers reads the config file at configPath, the files it inherits
+// from or extends, and the sets each of them includes, returning them in the
+// order they are merged: outermost parent first, and each file right after
+// its sets
+func loadLayers(configPath string) ([]*configFile, error) {
+	return walkLayers(configPath, decodeConfigFile)
+}
+
+// walkLayers finds the layers of the config at configPath like loadLayers,
+// reading each file with decode
+func walkLayers(configPath string, decode func(path string) (*configFile, error)) ([]*configFile, error) {
+	var layers []*configFile
+	seen := make(map[string]bool)
+
+	for path := configPath; path != ""; {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		if seen[absPath] {
+			return nil, fmt.Errorf("config %s is part of an inheritance cycle", absPath)
+		}
+		seen[absPath] = true
+
+		file, err := decode(path)
+		if err != nil {
+			return nil, err
+		}
+
+		sets, err := file.loadSets(decode)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(append(sets, file), layers...)
+
+		path, err = file.parentPath()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return layers, nil
+}
+
+// Sources returns the paths of the files the config at configPath is made
+// of, including the sets they include, outermost parent first
+func Sources(configPath string) ([]string, error) {
+	layers, err := loadLayers(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(layers))
+	for _, layer := range layers {
+		paths = append(paths, layer.path)
+	}
+	return paths, nil
+}
+
+// parentPath returns the path of the file this file inherits from or
+// extends, or an empty string if it stands alone
+func (f *configFile) parentPath() (string, error) {
+	switch {
+	case f.Inherit && f.Extends != "":
+		return "", fmt.Errorf("config %s sets both inherit and extends", f.path)
+	case f.Extends != "":
+		if filepath.IsAbs(f.Extends) {
+			return f.Extends, nil
+		}
+		return filepath.Join(filepath.Dir(f.path), f.Extends), nil
+	case f.Inherit:
+		return findParentConfig(f.path)
+	default:
+		return "", nil
+	}
+}
+
+// findParentConfig returns the nearest config file in a directory above the
+// one containing configPath
+func findParentConfig(configPath string) (string, error) {
+	absPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	dir := filepath.Dir(absPath)
+	for {
+		parentDir := filepath.Dir(dir)
+		if parentDir == dir {
+			return "", fmt.Errorf("config %s sets inherit but there is no .imbued file above it", configPath)
+		}
+		dir = parentDir
+
+		parentPath, err := ConfigInDir(dir)
+		if err != nil {
+			return "", err
+		}
+		if parentPath != "" {
+			return parentPath, nil
+		}
+	}
+}
+
+// merge returns the result of layering child, a file or a profile, over f.
+// Entries of the tables (secrets, templates, env, backends, profiles,
+// secret_backends and secret_cache_ttl) are merged by name, with the child's
+// entry replacing the parent's. A secret redefined by the child also drops
+// the parent's secret_backends and secret_cache_ttl entries for it. Profile
+// rules of the child are tried before the parent's. Top-level keys set by
+// the child replace the parent's; setting backend_type also resets the
+// parent's backend_config and backend_policy.
+func (f *configFile) merge(child *configFile) *configFile {
+	merged := *f
+	merged.Inherit = child.Inherit
+	merged.Extends = child.Extends
+	merged.Include = child.Include
+	merged.path = child.path
+	merged.meta = child.meta
+	merged.metaPrefix = child.metaPrefix
+
+	merged.Secrets = mergeMaps(f.Secrets, child.Secrets)
+	merged.Templates = mergeMaps(f.Templates, child.Templates)
+	merged.Env = mergeMaps(f.Env, child.Env)
+	merged.Backends = mergeMaps(f.Backends, child.Backends)
+	merged.Profiles = mergeMaps(f.Profiles, child.Profiles)
+
+	// The child's profile rules take precedence over the parent's
+	merged.ProfileRules = append(append([]ProfileRule{}, child.ProfileRules...), f.ProfileRules...)
+
+	secretBackends := mergeMaps(f.SecretBackends, nil)
+	secretCacheTTL := mergeMaps(f.SecretCacheTTL, nil)
+	for secretName := range child.Secrets {
+		delete(secretBackends, secretName)
+		delete(secretCacheTTL, secretName)
+	}
+	merged.SecretBackends = mergeMaps(secretBackends, child.SecretBackends)
+	merged.SecretCacheTTL = mergeMaps(secretCacheTTL, child.SecretCacheTTL)
+
+	defined := child.isDefined
+	if defined("backend_type") {
+		// A different backend type makes the parent's settings meaningless
+		merged.BackendType = child.BackendType
+		merged.BackendConfig = child.BackendConfig
+		merged.BackendPolicy = child.BackendPolicy
+		merged.backendConfigSource = child.backendConfigSource
+	}
+	if defined("backend_config") {
+		merged.BackendConfig = child.BackendConfig
+		merged.backendConfigSource = child.backendConfigSource
+	}
+	if defined("backend_policy") {
+		merged.BackendPolicy = child.BackendPolicy
+	}
+	if defined("default_backend") {
+		merged.DefaultBackend = child.DefaultBackend
+	}
+	if defined("valid_depth") {
+		merged.ValidDepth = child.ValidDepth
+	}
+	if defined("cache_ttl") {
+		merged.CacheTTL = child.CacheTTL
+	}
+	if defined("offline_snapshot") {
+		merged.OfflineSnapshot = child.OfflineSnapshot
+	}
+	if defined("offline_max_staleness") {
+		merged.OfflineMaxStaleness = child.OfflineMaxStaleness
+	}
+
+	return &merged
+}
+
+// mergeMaps returns a new map with the entries of parent, overridden by the
+// entries of child
+func mergeMaps[V any](parent, child map[string]V) map[string]V {
+	if parent == nil && child == nil {
+		return nil
+	}
+
+	merged := make(map[string]V, len(parent)+len(child))
+	for key, value := range parent {
+		merged[key] = value
+	}
+	for key, value := range child {
+		merged[key] = value
+	}
+	return merged
+}
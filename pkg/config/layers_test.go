@@ -0,0 +1,256 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates files in dir, by path relative to dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		config string
+		want   []string // Layers, relative to the directory of the files
+		err    string
+	}{
+		{
+			name:   "standalone",
+			files:  map[string]string{".imbued": ""},
+			config: ".imbued",
+			want:   []string{".imbued"},
+		},
+		{
+			name: "extends",
+			files: map[string]string{
+				"app/.imbued":        `extends = "../base.imbued"`,
+				"base.imbued":        `extends = "shared/base.imbued"`,
+				"shared/base.imbued": "",
+			},
+			config: "app/.imbued",
+			want:   []string{"shared/base.imbued", "base.imbued", "app/.imbued"},
+		},
+		{
+			name: "inherit",
+			files: map[string]string{
+				".imbued":         "",
+				"app/api/.imbued": "inherit = true",
+			},
+			config: "app/api/.imbued",
+			want:   []string{".imbued", "app/api/.imbued"},
+		},
+		{
+			name: "sets before their file",
+			files: map[string]string{
+				".imbued": `extends = "base.imbued"
+include = ["sets/a.imbued", "sets/b.imbued"]`,
+				"base.imbued":   `include = ["sets/c.imbued"]`,
+				"sets/a.imbued": "",
+				"sets/b.imbued": "",
+				"sets/c.imbued": "",
+			},
+			config: ".imbued",
+			want:   []string{"sets/c.imbued", "base.imbued", "sets/a.imbued", "sets/b.imbued", ".imbued"},
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				"a.imbued": `extends = "b.imbued"`,
+				"b.imbued": `extends = "a.imbued"`,
+			},
+			config: "a.imbued",
+			err:    "a.imbued is part of an inheritance cycle",
+		},
+		{
+			name:   "extends itself",
+			files:  map[string]string{".imbued": `extends = ".imbued"`},
+			config: ".imbued",
+			err:    ".imbued is part of an inheritance cycle",
+		},
+		{
+			name: "inherit and extends",
+			files: map[string]string{
+				".imbued": `inherit = true
+extends = "base.imbued"`,
+				"base.imbued": "",
+			},
+			config: ".imbued",
+			err:    "sets both inherit and extends",
+		},
+		{
+			name:   "missing parent",
+			files:  map[string]string{".imbued": `extends = "base.imbued"`},
+			config: ".imbued",
+			err:    "failed to read config file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+
+			layers, err := loadLayers(filepath.Join(dir, tt.config))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("loadLayers() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadLayers() error = %v", err)
+			}
+
+			var got []string
+			for _, layer := range layers {
+				path, err := filepath.Rel(dir, layer.path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, filepath.ToSlash(path))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadLayers() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name   string
+		parent string
+		child  string
+		check  func(t *testing.T, merged *configFile)
+	}{
+		{
+			name: "secrets by name",
+			parent: `[secrets]
+DB_PASSWORD = { env = "DB_PASSWORD" }
+API_KEY = { env = "API_KEY" }
+
+[secret_backends]
+DB_PASSWORD = ["vault"]
+API_KEY = ["vault"]
+
+[secret_cache_ttl]
+DB_PASSWORD = "1m"`,
+			child: `[secrets]
+DB_PASSWORD = { env = "DATABASE_PASSWORD" }
+TOKEN = { env = "TOKEN" }`,
+			check: func(t *testing.T, merged *configFile) {
+				if len(merged.Secrets) != 3 || merged.Secrets["API_KEY"] == nil || merged.Secrets["TOKEN"] == nil {
+					t.Errorf("secrets = %v, want API_KEY, DB_PASSWORD and TOKEN", merged.Secrets)
+				}
+				if got := merged.Secrets["DB_PASSWORD"].Env; !reflect.DeepEqual(got, []string{"DATABASE_PASSWORD"}) {
+					t.Errorf("DB_PASSWORD env = %q, want the child's", got)
+				}
+				// The parent's settings of a redefined secret don't apply to the child's
+				if want := map[string]BackendChain{"API_KEY": {"vault"}}; !reflect.DeepEqual(merged.SecretBackends, want) {
+					t.Errorf("secret_backends = %v, want %v", merged.SecretBackends, want)
+				}
+				if len(merged.SecretCacheTTL) != 0 {
+					t.Errorf("secret_cache_ttl = %v, want none", merged.SecretCacheTTL)
+				}
+			},
+		},
+		{
+			name: "backend_type resets the parent's backend",
+			parent: `backend_type = "vault"
+backend_config = { address = "https://vault.example.com" }
+backend_policy = { retries = 5 }`,
+			child: `backend_type = "env_file"`,
+			check: func(t *testing.T, merged *configFile) {
+				if merged.BackendType != "env_file" || merged.BackendConfig != nil {
+					t.Errorf("backend = %s %v, want env_file without config", merged.BackendType, merged.BackendConfig)
+				}
+				if merged.BackendPolicy.Retries != nil {
+					t.Errorf("backend_policy retries = %v, want unset", *merged.BackendPolicy.Retries)
+				}
+			},
+		},
+		{
+			name: "backend_config keeps the parent's type",
+			parent: `backend_type = "vault"
+backend_config = { address = "https://vault.example.com", token = "keychain:vault.token" }`,
+			child: `backend_config = { address = "https://vault.internal" }`,
+			check: func(t *testing.T, merged *configFile) {
+				want := map[string]string{"address": "https://vault.internal"}
+				if merged.BackendType != "vault" || !reflect.DeepEqual(merged.BackendConfig, want) {
+					t.Errorf("backend = %s %v, want vault %v", merged.BackendType, merged.BackendConfig, want)
+				}
+			},
+		},
+		{
+			name: "top-level keys",
+			parent: `valid_depth = 2
+cache_ttl = "5m"
+include = ["sets/a.imbued"]`,
+			child: `cache_ttl = "1m"`,
+			check: func(t *testing.T, merged *configFile) {
+				if merged.ValidDepth != 2 || merged.CacheTTL != "1m" {
+					t.Errorf("valid_depth = %d, cache_ttl = %s, want 2 and 1m", merged.ValidDepth, merged.CacheTTL)
+				}
+				if len(merged.Include) != 0 {
+					t.Errorf("include = %q, want the child's", merged.Include)
+				}
+			},
+		},
+		{
+			name: "profile rules of the child first",
+			parent: `[[profile_rules]]
+profile = "production"
+branch = "main"`,
+			child: `[[profile_rules]]
+profile = "staging"
+branch = "staging"`,
+			check: func(t *testing.T, merged *configFile) {
+				var got []string
+				for _, rule := range merged.ProfileRules {
+					got = append(got, rule.Profile)
+				}
+				if !reflect.DeepEqual(got, []string{"staging", "production"}) {
+					t.Errorf("profile rules = %q", got)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{".imbued": tt.parent, "app/.imbued": tt.child})
+
+			parent, err := decodeConfigFile(filepath.Join(dir, ".imbued"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			child, err := decodeConfigFile(filepath.Join(dir, "app/.imbued"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			merged := parent.merge(child)
+			if merged.path != child.path {
+				t.Errorf("path = %s, want the child's", merged.path)
+			}
+			tt.check(t, merged)
+		})
+	}
+}
@@ -0,0 +1,437 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/novacove/imbued/pkg/secrets"
+)
+
+// Severity is how serious a lint issue is
+type Severity string
+
+const (
+	// SeverityError marks issues that break the config or make it behave unexpectedly
+	SeverityError Severity = "error"
+	// SeverityWarning marks issues that are likely mistakes
+	SeverityWarning Severity = "warning"
+)
+
+// Issue is a problem found in a config by Lint
+type Issue struct {
+	Path     string   // File the issue was found in
+	Line     int      // Line of the issue, or 0 if it isn't tied to a line
+	Column   int      // Column of the issue, or 0 if unknown
+	Severity Severity // How serious the issue is
+	Message  string   // Description of the issue
+}
+
+// String formats the issue like a compiler diagnostic, e.g.
+// ".imbued:3:1: error: unknown key backend_typ"
+func (i Issue) String() string {
+	position := i.Path
+	if i.Line > 0 {
+		position += fmt.Sprintf(":%d", i.Line)
+		if i.Column > 0 {
+			position += fmt.Sprintf(":%d", i.Column)
+		}
+	}
+	return fmt.Sprintf("%s: %s: %s", position, i.Severity, i.Message)
+}
+
+// envNamePattern matches valid environment variable names
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// lintLayer is one of the files of a config being linted
+type lintLayer struct {
+	file *configFile
+	data []byte
+}
+
+// linter collects the issues found in a config
+type linter struct {
+	configPath string
+	layers     []lintLayer // Files of the config, in the order they are merged
+	issues     []Issue
+}
+
+// Lint checks the config at configPath and the files it inherits from or
+// includes. It reports syntax errors, unknown keys, deprecated constructs,
+// invalid values, environment variables that have invalid names or are
+// exported more than once, and backends with an unknown type or missing
+// options. The issues are sorted by position.
+func Lint(configPath string, defaults Defaults) []Issue {
+	l := &linter{configPath: configPath}
+	if !l.loadLayers() {
+		return l.sorted()
+	}
+
+	for _, layer := range l.layers {
+		l.checkUndecoded(layer)
+		l.checkDeprecations(layer)
+	}
+
+	// The remaining checks work on the merged config, and on each profile
+	cfg, err := LoadConfig(configPath, defaults)
+	if err != nil {
+		l.add(l.position(""), SeverityError, err.Error())
+		return l.sorted()
+	}
+	l.checkConfig(cfg, "")
+
+	for _, profile := range cfg.Profiles {
+		profileCfg, err := LoadConfigProfile(configPath, profile, defaults)
+		if err != nil {
+			l.add(l.position(profile), SeverityError, fmt.Sprintf("profile %q: %v", profile, err))
+			continue
+		}
+		l.checkConfig(profileCfg, profile)
+	}
+
+	return l.sorted()
+}
+
+// loadLayers decodes the files of the config, reporting the first file that
+// can't be decoded. It returns false if the config can't be checked further.
+func (l *linter) loadLayers() bool {
+	contents := make(map[*configFile][]byte)
+	reported := false
+
+	files, err := walkLayers(l.configPath, func(path string) (*configFile, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			l.add(lintPosition{path: path}, SeverityError, fmt.Sprintf("failed to read file: %v", err))
+			reported = true
+			return nil, err
+		}
+
+		file, err := decodeConfigData(path, data)
+		if err != nil {
+			l.addDecodeError(path, err)
+			reported = true
+			return nil, err
+		}
+		// Positions are only known in TOML files
+		if FormatOf(path) == FormatTOML {
+			contents[file] = data
+		}
+		return file, nil
+	})
+	if err != nil {
+		if !reported {
+			l.add(lintPosition{path: l.configPath}, SeverityError, err.Error())
+		}
+		return false
+	}
+
+	for _, file := range files {
+		l.layers = append(l.layers, lintLayer{file: file, data: contents[file]})
+	}
+	return true
+}
+
+// addDecodeError reports an error returned while decoding a file, at the
+// position TOML gives for it
+func (l *linter) addDecodeError(path string, err error) {
+	var parseErr toml.ParseError
+	if !errors.As(err, &parseErr) {
+		l.add(lintPosition{path: path}, SeverityError, err.Error())
+		return
+	}
+
+	message := parseErr.Message
+	if parseErr.LastKey != "" {
+		message = fmt.Sprintf("%s: %s", parseErr.LastKey, message)
+	}
+	l.add(lintPosition{path: path, line: parseErr.Position.Line, column: parseErr.Position.Col}, SeverityError, message)
+}
+
+// checkUndecoded reports the keys of a file that don't mean anything to imbued
+func (l *linter) checkUndecoded(layer lintLayer) {
+	undecoded := make(map[string]bool)
+	for _, key := range layer.file.meta.Undecoded() {
+		undecoded[key.String()] = true
+
+		// Only report the outermost unknown table, not each of its keys
+		if len(key) > 1 && undecoded[key[:len(key)-1].String()] {
+			continue
+		}
+
+		line, column := keyPosition(layer.data, key)
+		l.add(lintPosition{path: layer.file.path, line: line, column: column}, SeverityError, fmt.Sprintf("unknown key %s", key))
+	}
+}
+
+// checkDeprecations reports the outdated constructs of a file, which imbued
+// config migrate updates
+func (l *linter) checkDeprecations(layer lintLayer) {
+	for _, deprecation := range layer.file.deprecations() {
+		position := lintPosition{path: layer.file.path}
+		if deprecation.key != nil {
+			position.line, position.column = keyPosition(layer.data, deprecation.key)
+		}
+		l.add(position, SeverityWarning, deprecation.message)
+	}
+}
+
+// checkConfig checks a config loaded with the given profile
+func (l *linter) checkConfig(cfg *ImbuedConfig, profile string) {
+	l.checkBackends(cfg, profile)
+
+	// Every secret needs a backend to be looked up in
+	for _, secretName := range cfg.SecretNames() {
+		if len(cfg.ChainFor(secretName)) == 0 {
+			l.add(l.position(profile, "secrets", secretName), SeverityError,
+				fmt.Sprintf("secret %q has no backend: set backend_type, default_backend or the secret's backend", secretName))
+		}
+	}
+
+	// Environment variables must have valid names and a single source
+	exported := make(map[string]string)
+	for _, secretName := range cfg.SecretNames() {
+		for _, envName := range cfg.Secrets[secretName].Env {
+			position := l.position(profile, "secrets", secretName)
+			l.checkEnvName(position, envName)
+			if owner, ok := exported[envName]; ok {
+				l.add(position, SeverityError, fmt.Sprintf("%s is exported by both %s and secret %q", envName, owner, secretName))
+				continue
+			}
+			exported[envName] = fmt.Sprintf("secret %q", secretName)
+		}
+	}
+	for _, name := range cfg.TemplateNames() {
+		l.checkEnvName(l.position(profile, "templates", name), name)
+	}
+	for _, name := range cfg.EnvNames() {
+		l.checkEnvName(l.position(profile, "env", name), name)
+	}
+}
+
+// checkBackends checks the type and options of the backends of a config
+func (l *linter) checkBackends(cfg *ImbuedConfig, profile string) {
+	// An empty backend_type declares no backend at all
+	if position := l.position(profile, "backend_type"); position.file != nil && position.file.BackendType == "" {
+		l.add(position, SeverityError, "backend_type is empty")
+	}
+
+	for _, name := range cfg.BackendNames() {
+		backend := cfg.Backends[name]
+
+		// The default backend may come from the top-level keys
+		typePosition := l.position(profile, "backends", name, "type")
+		configPosition := l.position(profile, "backends", name, "config")
+		if name == DefaultBackendName && typePosition.line == 0 {
+			typePosition = l.position(profile, "backend_type")
+			configPosition = l.position(profile, "backend_config")
+		}
+		if configPosition.line == 0 {
+			configPosition = typePosition
+		}
+
+		options, ok := secrets.OptionsFor(backend.Type)
+		if !ok {
+			l.add(typePosition, SeverityError, fmt.Sprintf("backend %q has unknown type %q (expected one of %s)",
+				name, backend.Type, strings.Join(secrets.BackendTypeNames(), ", ")))
+			continue
+		}
+
+		known := make([]string, 0, len(options))
+		for _, option := range options {
+			known = append(known, option.Name)
+			if _, ok := backend.Config[option.Name]; option.Required && !ok {
+				l.add(configPosition, SeverityError, fmt.Sprintf("backend %q (%s) is missing required option %s", name, backend.Type, option.Name))
+			}
+		}
+
+		keys := make([]string, 0, len(backend.Config))
+		for key := range backend.Config {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !containsString(known, key) {
+				l.add(configPosition, SeverityWarning, fmt.Sprintf("backend %q (%s) has unknown option %s", name, backend.Type, key))
+			}
+		}
+	}
+}
+
+// checkEnvName reports an environment variable name that shells can't export
+func (l *linter) checkEnvName(position lintPosition, name string) {
+	if !envNamePattern.MatchString(name) {
+		l.add(position, SeverityError, fmt.Sprintf("invalid environment variable name %q", name))
+	}
+}
+
+// lintPosition is where in the config a key is defined
+type lintPosition struct {
+	path   string
+	line   int
+	column int
+	file   *configFile // File or profile defining the key, nil if none does
+}
+
+// position returns where a key of the config is defined, looking at the
+// given profile first and at the files closest to the config first. If no
+// file defines the key, the position is the config file itself.
+func (l *linter) position(profile string, key ...string) lintPosition {
+	var candidates [][]string
+	if profile != "" {
+		candidates = append(candidates, append([]string{"profiles", profile}, key...))
+	}
+	if len(key) > 0 {
+		candidates = append(candidates, key)
+	}
+
+	for _, candidate := range candidates {
+		for i := len(l.layers) - 1; i >= 0; i-- {
+			layer := l.layers[i]
+			if !layer.file.meta.IsDefined(candidate...) {
+				continue
+			}
+
+			file := layer.file
+			if len(candidate) > len(key) {
+				file = layer.file.Profiles[profile]
+			}
+			line, column := keyPosition(layer.data, candidate)
+			return lintPosition{path: layer.file.path, line: line, column: column, file: file}
+		}
+	}
+
+	return lintPosition{path: l.configPath}
+}
+
+// add records an issue
+func (l *linter) add(position lintPosition, severity Severity, message string) {
+	l.issues = append(l.issues, Issue{
+		Path:     position.path,
+		Line:     position.line,
+		Column:   position.column,
+		Severity: severity,
+		Message:  message,
+	})
+}
+
+// sorted returns the issues ordered by position, without the duplicates
+// found again while checking profiles
+func (l *linter) sorted() []Issue {
+	sort.SliceStable(l.issues, func(i, j int) bool {
+		a, b := l.issues[i], l.issues[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	issues := make([]Issue, 0, len(l.issues))
+	seen := make(map[Issue]bool, len(l.issues))
+	for _, issue := range l.issues {
+		if !seen[issue] {
+			seen[issue] = true
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// keyPosition returns the line and column a key is defined at in a TOML
+// document, or 0, 0 if it can't be found. Keys defined inside an inline
+// table or an array are reported at the key holding the table or array.
+func keyPosition(data []byte, key []string) (int, int) {
+	line, column, length := 0, 0, 0
+	forEachKeyLine(data, func(index, col int, defined []string) {
+		// The first exact definition wins, otherwise the closest parent key
+		if length == len(key) || len(defined) <= length || !hasKeyPrefix(key, defined) {
+			return
+		}
+		line, column, length = index+1, col, len(defined)
+	})
+	return line, column
+}
+
+// findKeyLine returns the index of the line defining exactly the given key
+// in a TOML document, or -1 if no line does
+func findKeyLine(data []byte, key []string) int {
+	found := -1
+	forEachKeyLine(data, func(index, _ int, defined []string) {
+		if found < 0 && len(defined) == len(key) && hasKeyPrefix(key, defined) {
+			found = index
+		}
+	})
+	return found
+}
+
+// forEachKeyLine calls fn with the index, column and full key of each line
+// of a TOML document that opens a table or assigns a key
+func forEachKeyLine(data []byte, fn func(index, column int, defined []string)) {
+	var table []string
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		column := len(line) - len(strings.TrimLeft(line, " \t")) + 1
+
+		if strings.HasPrefix(trimmed, "[") {
+			end := strings.LastIndex(trimmed, "]")
+			if end < 0 {
+				continue
+			}
+			table = splitKey(strings.Trim(trimmed[:end+1], "[]"))
+			fn(i, column, table)
+			continue
+		}
+
+		eq := strings.Index(trimmed, "=")
+		if eq < 0 {
+			continue
+		}
+		fn(i, column, append(append([]string{}, table...), splitKey(trimmed[:eq])...))
+	}
+}
+
+// splitKey splits a dotted TOML key into its parts, removing quotes
+func splitKey(key string) []string {
+	var parts []string
+	var part strings.Builder
+	var quote rune
+
+	for _, r := range key {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			part.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '.':
+			parts = append(parts, strings.TrimSpace(part.String()))
+			part.Reset()
+		default:
+			part.WriteRune(r)
+		}
+	}
+	return append(parts, strings.TrimSpace(part.String()))
+}
+
+// hasKeyPrefix reports whether prefix is key or one of its parent keys
+func hasKeyPrefix(key, prefix []string) bool {
+	if len(prefix) == 0 || len(prefix) > len(key) {
+		return false
+	}
+	for i := range prefix {
+		if key[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
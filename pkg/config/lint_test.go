@@ -0,0 +1,175 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"version", []string{"version"}},
+		{"backends.vault.config", []string{"backends", "vault", "config"}},
+		{" backends . vault ", []string{"backends", "vault"}},
+		{`secrets."DB.PASSWORD"`, []string{"secrets", "DB.PASSWORD"}},
+		{`secrets.'API_KEY'`, []string{"secrets", "API_KEY"}},
+		{`"it's".'a.b'`, []string{"it's", "a.b"}},
+		{`""`, []string{""}},
+	}
+
+	for _, tt := range tests {
+		if got := splitKey(tt.key); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitKey(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestKeyPosition(t *testing.T) {
+	data := []byte(`# Format version
+version = 2
+backend_type = "vault"
+
+[backend_config]
+  address = "https://vault.example.com"
+
+[secrets]
+DB_PASSWORD = { env = "DATABASE_PASSWORD" }
+"API.KEY" = { env = "API_KEY" }
+
+[profiles.staging.secrets]
+DB_PASSWORD = { env = "STAGING_PASSWORD" }
+`)
+
+	tests := []struct {
+		name   string
+		key    []string
+		line   int
+		column int
+	}{
+		{"top-level key", []string{"version"}, 2, 1},
+		{"table", []string{"backend_config"}, 5, 1},
+		{"indented key of a table", []string{"backend_config", "address"}, 6, 3},
+		{"entry", []string{"secrets", "DB_PASSWORD"}, 9, 1},
+		{"quoted key", []string{"secrets", "API.KEY"}, 10, 1},
+		{"key inside an inline table", []string{"secrets", "DB_PASSWORD", "env"}, 9, 1},
+		{"nested table", []string{"profiles", "staging", "secrets", "DB_PASSWORD"}, 13, 1},
+		{"key only implied by a nested table", []string{"profiles", "staging"}, 0, 0},
+		{"undefined key of a table", []string{"backend_config", "token"}, 5, 1},
+		{"undefined key", []string{"templates"}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, column := keyPosition(data, tt.key)
+			if line != tt.line || column != tt.column {
+				t.Errorf("keyPosition(%q) = %d:%d, want %d:%d", tt.key, line, column, tt.line, tt.column)
+			}
+		})
+	}
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string // Issues, with paths relative to the directory of the files
+	}{
+		{
+			name: "valid",
+			files: map[string]string{".imbued": `version = 2
+backend_type = "env_file"
+backend_config = { file_path = ".env" }
+
+[secrets]
+DB_PASSWORD = "DB_PASSWORD"`},
+		},
+		{
+			name: "unknown keys and options",
+			files: map[string]string{".imbued": `version = 2
+backend_typ = "vault"
+backend_type = "env_file"
+backend_config = { file_path = ".env", token = "x" }
+
+[secrets]
+DB_PASSWORD = "DB_PASSWORD"
+
+[backends.vault]
+type = "vault"
+config = { address = "https://vault.example.com" }`},
+			want: []string{
+				".imbued:2:1: error: unknown key backend_typ",
+				`.imbued:4:1: warning: backend "default" (env_file) has unknown option token`,
+				`.imbued:11:1: error: backend "vault" (vault) is missing required option token`,
+			},
+		},
+		{
+			name: "environment variables",
+			files: map[string]string{".imbued": `version = 2
+backend_type = "env_file"
+backend_config = { file_path = ".env" }
+
+[secrets]
+DB_PASSWORD = { env = ["DB-PASSWORD"] }
+API_KEY = { env = ["TOKEN"] }
+TOKEN = "TOKEN"`},
+			want: []string{
+				`.imbued:6:1: error: invalid environment variable name "DB-PASSWORD"`,
+				`.imbued:8:1: error: TOKEN is exported by both secret "API_KEY" and secret "TOKEN"`,
+			},
+		},
+		{
+			name: "unknown backend type in a parent",
+			files: map[string]string{
+				".imbued": `version = 2
+backend_type = "consul"`,
+				"app/.imbued": `version = 2
+inherit = true
+[secrets]
+DB_PASSWORD = "DB_PASSWORD"`,
+			},
+			want: []string{
+				`.imbued:2:1: error: backend "default" has unknown type "consul" (expected one of aws_secret_manager, env_file, gcp_secret_manager, macos_keychain_manager, onepass, vault)`,
+			},
+		},
+		{
+			name: "format version 1",
+			files: map[string]string{".imbued": `backend_type = "env_file"
+backend_config = { file_path = ".env" }`},
+			want: []string{".imbued: warning: format version 1 is deprecated, run `imbued config migrate` to update the file to version 2"},
+		},
+		{
+			name:  "syntax error",
+			files: map[string]string{".imbued": "version = 2\nbackend_type = \"env_file\"\ncache_ttl = 5m\n"},
+			want:  []string{".imbued:3:"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+
+			configPath := filepath.Join(dir, ".imbued")
+			if _, ok := tt.files["app/.imbued"]; ok {
+				configPath = filepath.Join(dir, "app", ".imbued")
+			}
+
+			var got []string
+			for _, issue := range Lint(configPath, BuiltinDefaults()) {
+				got = append(got, strings.TrimPrefix(issue.String(), dir+string(filepath.Separator)))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Lint() = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if !strings.HasPrefix(got[i], tt.want[i]) {
+					t.Errorf("Lint()[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
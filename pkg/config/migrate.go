@@ -0,0 +1,330 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/novacove/imbued/pkg/secrets"
+)
+
+// CurrentVersion is the format version of .imbued files written by this
+// version of imbued. Files without a version key are version 1.
+//
+// Version 2 writes every [secrets] entry as an inline table and keeps backend
+// credentials in the keychain, referenced from the config.
+const CurrentVersion = 2
+
+// checkVersion checks that the file's format can be read by this version of imbued
+func (f *configFile) checkVersion() error {
+	if !f.isDefined("version") {
+		return nil
+	}
+	if f.Version < 1 {
+		return fmt.Errorf("config %s has invalid version %d", f.path, f.Version)
+	}
+	if f.Version > CurrentVersion {
+		return fmt.Errorf("config %s uses format version %d, which requires a newer imbued (this one supports up to %d)", f.path, f.Version, CurrentVersion)
+	}
+	return nil
+}
+
+// version returns the format version of the file
+func (f *configFile) version() int {
+	if f.Version == 0 {
+		return 1
+	}
+	return f.Version
+}
+
+// deprecation is an outdated construct found in a file
+type deprecation struct {
+	key     []string // Key the construct is defined at, if any
+	message string
+}
+
+// deprecations returns the outdated constructs of the file, which
+// imbued config migrate updates
+func (f *configFile) deprecations() []deprecation {
+	var found []deprecation
+	// Only TOML files can be migrated automatically
+	migrate := "run `imbued config migrate` to"
+	if FormatOf(f.path) != FormatTOML {
+		migrate = "edit the file to"
+	}
+
+	if version := f.version(); version < CurrentVersion {
+		found = append(found, deprecation{
+			message: fmt.Sprintf("format version %d is deprecated, %s update the file to version %d", version, migrate, CurrentVersion),
+		})
+	}
+
+	for _, credential := range f.credentials() {
+		found = append(found, deprecation{
+			key: credential.key,
+			message: fmt.Sprintf("%s of backend %q is stored in plain text, %s move it to the keychain",
+				credential.option, credential.backend, migrate),
+		})
+	}
+
+	return found
+}
+
+// credential is a backend credential written in plain text in a file
+type credential struct {
+	key     []string // Key of the option in the file
+	profile string   // Profile the backend is declared in, if any
+	backend string   // Name of the backend
+	option  string   // Name of the option
+	value   string
+}
+
+// credentials returns the backend credentials of the file, and of its
+// profiles, that are neither references nor read from the environment
+func (f *configFile) credentials() []credential {
+	var found []credential
+	scopes := []struct {
+		profile string
+		file    *configFile
+		prefix  []string
+	}{{file: f}}
+	for _, name := range sortedKeys(f.Profiles) {
+		scopes = append(scopes, struct {
+			profile string
+			file    *configFile
+			prefix  []string
+		}{name, f.Profiles[name], []string{"profiles", name}})
+	}
+
+	for _, scope := range scopes {
+		add := func(backend, backendType string, options map[string]string, key ...string) {
+			for _, option := range sortedKeys(options) {
+				value := options[option]
+				if !secrets.IsCredential(backendType, option) || secrets.IsReference(value) || optionVariablePattern.MatchString(value) {
+					continue
+				}
+				found = append(found, credential{
+					key:     append(append(append([]string{}, scope.prefix...), key...), option),
+					profile: scope.profile,
+					backend: backend,
+					option:  option,
+					value:   value,
+				})
+			}
+		}
+
+		// Profiles may leave the type of a backend to the file
+		backendType := scope.file.BackendType
+		if backendType == "" {
+			backendType = f.BackendType
+		}
+		add(DefaultBackendName, backendType, scope.file.BackendConfig, "backend_config")
+		for _, name := range sortedKeys(scope.file.Backends) {
+			backend := scope.file.Backends[name]
+			backendType := backend.Type
+			if backendType == "" {
+				backendType = f.Backends[name].Type
+			}
+			add(name, backendType, backend.Config, "backends", name, "config")
+		}
+	}
+
+	return found
+}
+
+// Migration is the result of updating a .imbued file to the current format
+type Migration struct {
+	Path    string   // File being migrated
+	From    int      // Format version of the file before migrating
+	Changes []string // Descriptions of the changes made to the file
+	Data    []byte   // Migrated content of the file
+
+	credentials []credential // Credentials to move to the keychain
+}
+
+// Migrate updates the .imbued file at configPath to the current format,
+// without writing it. Comments and layout of the file are kept.
+func Migrate(configPath string) (*Migration, error) {
+	if format := FormatOf(configPath); format != FormatTOML {
+		return nil, fmt.Errorf("can't migrate %s automatically: only TOML configs are supported, update the %s file by hand", configPath, strings.ToUpper(string(format)))
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", configPath, err)
+	}
+
+	file, err := decodeConfigData(configPath, data)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Migration{Path: configPath, From: file.version()}
+	lines := strings.Split(string(data), "\n")
+
+	// Secrets written as a plain string become inline tables
+	for _, key := range file.meta.Keys() {
+		isEntry := (len(key) == 2 && key[0] == "secrets") ||
+			(len(key) == 4 && key[0] == "profiles" && key[2] == "secrets")
+		if !isEntry || file.meta.Type(key...) != "String" {
+			continue
+		}
+
+		err := rewriteValue(lines, data, key, func(literal string) string {
+			return fmt.Sprintf("{ env = %s }", literal)
+		})
+		if err != nil {
+			return nil, err
+		}
+		m.Changes = append(m.Changes, fmt.Sprintf("converted %s to a structured entry", key))
+	}
+
+	// Credentials are moved to the keychain when the migration is written.
+	// The file only names them, so that it reads the same on every machine.
+	for _, cred := range file.credentials() {
+		cred.key = append([]string{}, cred.key...)
+		err := rewriteValue(lines, data, cred.key, func(string) string {
+			return fmt.Sprintf("%q", secrets.KeychainReference(cred.referenceName()))
+		})
+		if err != nil {
+			return nil, err
+		}
+		m.credentials = append(m.credentials, cred)
+		m.Changes = append(m.Changes, fmt.Sprintf("moved %s to the keychain", toml.Key(cred.key)))
+	}
+
+	// Record the new version
+	versionLine := fmt.Sprintf("version = %d", CurrentVersion)
+	if i := findKeyLine(data, []string{"version"}); i >= 0 {
+		if m.From != CurrentVersion {
+			lines[i] = versionLine
+		}
+	} else {
+		// Top-level keys must come before the first table, and the comments
+		// right above the first key belong to it, unlike #: directives
+		at := 0
+		for at < len(lines) {
+			trimmed := strings.TrimSpace(lines[at])
+			if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+				break
+			}
+			at++
+		}
+		for at > 0 && strings.HasPrefix(strings.TrimSpace(lines[at-1]), "#") && !strings.HasPrefix(strings.TrimSpace(lines[at-1]), "#:") {
+			at--
+		}
+		lines = append(lines[:at], append([]string{versionLine, ""}, lines[at:]...)...)
+	}
+	if m.From != CurrentVersion {
+		m.Changes = append(m.Changes, fmt.Sprintf("updated the format version from %d to %d", m.From, CurrentVersion))
+	}
+
+	if len(m.Changes) == 0 {
+		m.Data = data
+		return m, nil
+	}
+
+	m.Data = []byte(strings.Join(lines, "\n"))
+
+	// Make sure the result still decodes
+	if _, err := decodeConfigData(configPath, m.Data); err != nil {
+		return nil, fmt.Errorf("migrated config is invalid: %w", err)
+	}
+
+	return m, nil
+}
+
+// Write moves the credentials of the migration to the keychain and writes
+// the migrated file
+func (m *Migration) Write() error {
+	if len(m.Changes) == 0 {
+		return nil
+	}
+
+	for _, cred := range m.credentials {
+		if _, err := secrets.StoreReference(m.Path, cred.referenceName(), cred.value); err != nil {
+			return fmt.Errorf("failed to move %s to the keychain: %w", toml.Key(cred.key), err)
+		}
+	}
+
+	info, err := os.Stat(m.Path)
+	if err != nil {
+		return fmt.Errorf("failed to stat config file: %w", err)
+	}
+	if err := os.WriteFile(m.Path, m.Data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	return nil
+}
+
+// referenceName returns the name the file refers to the credential by once
+// it is moved to the keychain, e.g. "vault.token"
+func (c credential) referenceName() string {
+	backend := c.backend
+	if c.profile != "" {
+		backend = c.profile + "." + backend
+	}
+	return backend + "." + c.option
+}
+
+// rewriteValue replaces the string value of a key defined on its own line
+// with the result of replace, which is given the value's TOML literal
+func rewriteValue(lines []string, data []byte, key []string, replace func(literal string) string) error {
+	i := findKeyLine(data, key)
+	if i < 0 {
+		return fmt.Errorf("can't migrate %s automatically: it isn't defined on a line of its own, update it by hand", strings.Join(key, "."))
+	}
+
+	line := lines[i]
+	eq := strings.Index(line, "=")
+	start := eq + 1
+	for start < len(line) && (line[start] == ' ' || line[start] == '\t') {
+		start++
+	}
+
+	end := stringLiteralEnd(line, start)
+	if end < 0 {
+		return fmt.Errorf("can't migrate %s automatically: its value isn't a single-line string, update it by hand", strings.Join(key, "."))
+	}
+
+	lines[i] = line[:start] + replace(line[start:end]) + line[end:]
+	return nil
+}
+
+// stringLiteralEnd returns the index just past the single-line TOML string
+// starting at start, or -1 if there is none
+func stringLiteralEnd(line string, start int) int {
+	if start >= len(line) || strings.HasPrefix(line[start:], `"""`) || strings.HasPrefix(line[start:], "'''") {
+		return -1
+	}
+
+	switch line[start] {
+	case '\'':
+		if end := strings.IndexByte(line[start+1:], '\''); end >= 0 {
+			return start + end + 2
+		}
+	case '"':
+		for i := start + 1; i < len(line); i++ {
+			switch line[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+// sortedKeys returns the sorted keys of a map
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,242 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		want    string // Migrated content, or the error's prefix
+		changes int
+		err     bool
+	}{
+		{
+			name: "version 1",
+			data: `# Project secrets
+backend_type = "vault"
+
+[backend_config]
+address = "https://vault.example.com"
+token = 's.abc' # dev token
+
+[secrets]
+DB_PASSWORD = "DATABASE_PASSWORD"
+API_KEY = { env = "API_KEY" }
+
+[profiles.staging.backend_config]
+token = "s.\"staging\""
+`,
+			want: `version = 2
+
+# Project secrets
+backend_type = "vault"
+
+[backend_config]
+address = "https://vault.example.com"
+token = "keychain:default.token" # dev token
+
+[secrets]
+DB_PASSWORD = { env = "DATABASE_PASSWORD" }
+API_KEY = { env = "API_KEY" }
+
+[profiles.staging.backend_config]
+token = "keychain:staging.default.token"
+`,
+			changes: 4,
+		},
+		{
+			name: "version kept after directives",
+			data: `#: shell bash
+
+[secrets]
+DB_PASSWORD = { env = "DATABASE_PASSWORD" }
+`,
+			want: `#: shell bash
+
+version = 2
+
+[secrets]
+DB_PASSWORD = { env = "DATABASE_PASSWORD" }
+`,
+			changes: 1,
+		},
+		{
+			name: "named backends and environment variables",
+			data: `version = 1
+
+[backends.vault]
+type = "vault"
+config.address = "https://vault.example.com"
+config.token = "${env:VAULT_TOKEN}"
+
+[backends.aws]
+type = "aws_secret_manager"
+
+[backends.aws.config]
+access_key = "AKIA"
+secret_key = "keychain:aws.secret_key"
+
+[profiles.ci.backends.aws.config]
+access_key = "AKIB"
+`,
+			want: `version = 2
+
+[backends.vault]
+type = "vault"
+config.address = "https://vault.example.com"
+config.token = "${env:VAULT_TOKEN}"
+
+[backends.aws]
+type = "aws_secret_manager"
+
+[backends.aws.config]
+access_key = "keychain:aws.access_key"
+secret_key = "keychain:aws.secret_key"
+
+[profiles.ci.backends.aws.config]
+access_key = "keychain:ci.aws.access_key"
+`,
+			changes: 3,
+		},
+		{
+			name: "current version",
+			data: `version = 2
+
+[secrets]
+DB_PASSWORD = { env = "DATABASE_PASSWORD" }
+`,
+			want: `version = 2
+
+[secrets]
+DB_PASSWORD = { env = "DATABASE_PASSWORD" }
+`,
+		},
+		{
+			name: "credential in an inline table",
+			data: `backend_type = "vault"
+backend_config = { token = "s.abc" }
+`,
+			err:  true,
+			want: "can't migrate backend_config.token automatically: it isn't defined on a line of its own",
+		},
+		{
+			name: "multi-line credential",
+			data: `backend_type = "vault"
+
+[backend_config]
+token = """
+s.abc"""
+`,
+			err:  true,
+			want: "can't migrate backend_config.token automatically: its value isn't a single-line string",
+		},
+		{
+			name: "YAML file",
+			file: ".imbued.yaml",
+			data: "secrets:\n  DB_PASSWORD: DATABASE_PASSWORD\n",
+			err:  true,
+			want: "can't migrate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := tt.file
+			if file == "" {
+				file = ".imbued"
+			}
+			path := filepath.Join(t.TempDir(), file)
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			m, err := Migrate(path)
+			if tt.err {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+					t.Fatalf("Migrate() error = %v, want %q", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Migrate() error = %v", err)
+			}
+			if got := string(m.Data); got != tt.want {
+				t.Errorf("Migrate() data =\n%s\nwant\n%s", got, tt.want)
+			}
+			if len(m.Changes) != tt.changes {
+				t.Errorf("Migrate() changes = %q, want %d", m.Changes, tt.changes)
+			}
+		})
+	}
+}
+
+func TestRewriteValue(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		key  []string
+		want string
+		err  bool
+	}{
+		{"basic string", `token = "s.abc"`, []string{"token"}, `token = <"s.abc">`, false},
+		{"escaped quote", `token = "s.\"abc\"" # comment`, []string{"token"}, `token = <"s.\"abc\""> # comment`, false},
+		{"literal string", "  token\t=\t's.abc'", []string{"token"}, "  token\t=\t<'s.abc'>", false},
+		{"dotted key", `config.token = "s.abc"`, []string{"config", "token"}, `config.token = <"s.abc">`, false},
+		{"not a string", `token = 42`, []string{"token"}, "", true},
+		{"undefined key", `address = "https://vault.example.com"`, []string{"token"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := []string{tt.line}
+			err := rewriteValue(lines, []byte(tt.line), tt.key, func(literal string) string {
+				return "<" + literal + ">"
+			})
+			if tt.err {
+				if err == nil {
+					t.Fatalf("rewriteValue() = %q, want an error", lines[0])
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rewriteValue() error = %v", err)
+			}
+			if lines[0] != tt.want {
+				t.Errorf("rewriteValue() = %q, want %q", lines[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestStringLiteralEnd(t *testing.T) {
+	tests := []struct {
+		line  string
+		start int
+		want  int
+	}{
+		{`"abc"`, 0, 5},
+		{`x = "abc" # comment`, 4, 9},
+		{`"a\"b"`, 0, 6},
+		{`"a\\" "b"`, 0, 5},
+		{`'a\'`, 0, 4},
+		{`''`, 0, 2},
+		{`"abc`, 0, -1},
+		{`'abc`, 0, -1},
+		{`"""abc"""`, 0, -1},
+		{`'''abc'''`, 0, -1},
+		{`abc`, 0, -1},
+		{`x = `, 4, -1},
+	}
+
+	for _, tt := range tests {
+		if got := stringLiteralEnd(tt.line, tt.start); got != tt.want {
+			t.Errorf("stringLiteralEnd(%q, %d) = %d, want %d", tt.line, tt.start, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		err    string
+	}{
+		{name: "valid", policy: `{ timeout = "5s", retries = 3, backoff = "1s" }`},
+		{name: "negative timeout", policy: `{ timeout = "-5s" }`, err: "timeout must not be negative"},
+		{name: "negative retries", policy: `{ retries = -1 }`, err: "retries must not be negative"},
+		{name: "too many retries", policy: `{ retries = 1000 }`, err: "retries must be at most"},
+		{name: "invalid backoff", policy: `{ backoff = "later" }`, err: "invalid backoff"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadTestConfig(t, `version = 2
+backend_type = "env_file"
+backend_policy = `+tt.policy)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("LoadConfig() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			if policy := cfg.BackendPolicy; policy.Timeout != 5*time.Second || policy.Retries != 3 || policy.Backoff != time.Second {
+				t.Errorf("BackendPolicy = %+v", policy)
+			}
+		})
+	}
+}
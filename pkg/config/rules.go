@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ProfileRule selects a profile automatically when all of its conditions
+// match. Branch, hostname and user are glob patterns as understood by
+// path.Match, so "release/*" matches "release/1.2" but not "release/1.2/hotfix".
+type ProfileRule struct {
+	Profile  string `toml:"profile"`  // Profile selected by the rule
+	Branch   string `toml:"branch"`   // Pattern for the git branch of the config's repository
+	Hostname string `toml:"hostname"` // Pattern for the machine's hostname
+	User     string `toml:"user"`     // Pattern for the current username
+	Env      string `toml:"env"`      // Environment variable that must be set in the shell
+}
+
+// RuleContext holds the facts profile rules are matched against
+type RuleContext struct {
+	Branch   string          // Current git branch, empty outside a repository or on a detached HEAD
+	Hostname string          // Hostname of the machine
+	User     string          // Name of the current user
+	Env      map[string]bool // Names of the environment variables set in the shell
+}
+
+// check validates the rule against the profiles of the config
+func (r ProfileRule) check(profiles map[string]*configFile) error {
+	if _, ok := profiles[r.Profile]; !ok {
+		return fmt.Errorf("selects unknown profile %q", r.Profile)
+	}
+
+	if r.Branch == "" && r.Hostname == "" && r.User == "" && r.Env == "" {
+		return fmt.Errorf("has no conditions")
+	}
+
+	for _, pattern := range []string{r.Branch, r.Hostname, r.User} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// Match reports whether every condition of the rule holds in the given
+// context, and if so describes why
+func (r ProfileRule) Match(ctx RuleContext) (bool, string) {
+	var reasons []string
+
+	patterns := []struct {
+		name, pattern, value string
+	}{
+		{"branch", r.Branch, ctx.Branch},
+		{"hostname", r.Hostname, ctx.Hostname},
+		{"user", r.User, ctx.User},
+	}
+	for _, p := range patterns {
+		if p.pattern == "" {
+			continue
+		}
+		if matched, _ := path.Match(p.pattern, p.value); !matched || p.value == "" {
+			return false, ""
+		}
+		reasons = append(reasons, fmt.Sprintf("%s %q matches %q", p.name, p.value, p.pattern))
+	}
+
+	if r.Env != "" {
+		if !ctx.Env[r.Env] {
+			return false, ""
+		}
+		reasons = append(reasons, fmt.Sprintf("env %s is set", r.Env))
+	}
+
+	return true, strings.Join(reasons, ", ")
+}
+
+// SelectProfile returns the profile of the first rule that matches the
+// context and the reason it matched. It returns an empty profile if no rule
+// matches.
+func (c *ImbuedConfig) SelectProfile(ctx RuleContext) (string, string) {
+	for _, rule := range c.ProfileRules {
+		if matched, reason := rule.Match(ctx); matched {
+			return rule.Profile, reason
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProfileRuleMatch(t *testing.T) {
+	ctx := RuleContext{
+		Branch:   "release/1.2",
+		Hostname: "ci-runner-3",
+		User:     "deploy",
+		Env:      map[string]bool{"CI": true},
+	}
+
+	tests := []struct {
+		name   string
+		rule   ProfileRule
+		match  bool
+		reason string
+	}{
+		{name: "exact branch", rule: ProfileRule{Branch: "release/1.2"}, match: true, reason: `branch "release/1.2" matches "release/1.2"`},
+		{name: "branch glob", rule: ProfileRule{Branch: "release/*"}, match: true, reason: `branch "release/1.2" matches "release/*"`},
+		{name: "glob stops at slashes", rule: ProfileRule{Branch: "*"}, match: false},
+		{name: "character class", rule: ProfileRule{Hostname: "ci-runner-[0-9]"}, match: true, reason: `hostname "ci-runner-3" matches "ci-runner-[0-9]"`},
+		{name: "other user", rule: ProfileRule{User: "admin"}, match: false},
+		{name: "env set", rule: ProfileRule{Env: "CI"}, match: true, reason: "env CI is set"},
+		{name: "env unset", rule: ProfileRule{Env: "DEPLOY"}, match: false},
+		{
+			name:   "all conditions",
+			rule:   ProfileRule{Branch: "release/*", User: "deploy", Env: "CI"},
+			match:  true,
+			reason: `branch "release/1.2" matches "release/*", user "deploy" matches "deploy", env CI is set`,
+		},
+		{name: "one condition fails", rule: ProfileRule{Branch: "release/*", User: "admin"}, match: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, reason := tt.rule.Match(ctx)
+			if match != tt.match || reason != tt.reason {
+				t.Errorf("Match() = %v, %q, want %v, %q", match, reason, tt.match, tt.reason)
+			}
+		})
+	}
+
+	// Outside a repository no branch pattern matches, not even "*"
+	if match, _ := (ProfileRule{Branch: "*"}).Match(RuleContext{}); match {
+		t.Error("Match() = true for a branch pattern without a branch")
+	}
+}
+
+func TestSelectProfile(t *testing.T) {
+	cfg, err := loadTestConfig(t, `backend_type = "env_file"
+
+[profiles.production]
+[profiles.staging]
+
+[[profile_rules]]
+profile = "production"
+branch = "main"
+
+[[profile_rules]]
+profile = "staging"
+env = "CI"`)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		ctx     RuleContext
+		profile string
+	}{
+		{ctx: RuleContext{Branch: "main", Env: map[string]bool{"CI": true}}, profile: "production"},
+		{ctx: RuleContext{Branch: "feature", Env: map[string]bool{"CI": true}}, profile: "staging"},
+		{ctx: RuleContext{Branch: "feature"}, profile: ""},
+	}
+	for _, tt := range tests {
+		if profile, _ := cfg.SelectProfile(tt.ctx); profile != tt.profile {
+			t.Errorf("SelectProfile(%+v) = %q, want %q", tt.ctx, profile, tt.profile)
+		}
+	}
+}
+
+func TestProfileRuleCheck(t *testing.T) {
+	tests := []struct {
+		rule string
+		err  string
+	}{
+		{rule: `profile = "qa"
+branch = "main"`, err: `profile rule 1 selects unknown profile "qa"`},
+		{rule: `profile = "staging"`, err: "profile rule 1 has no conditions"},
+		{rule: `profile = "staging"
+branch = "release/["`, err: `profile rule 1 invalid pattern "release/["`},
+	}
+
+	for _, tt := range tests {
+		_, err := loadTestConfig(t, `backend_type = "env_file"
+[profiles.staging]
+[[profile_rules]]
+`+tt.rule)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("LoadConfig() error = %v, want %q", err, tt.err)
+		}
+	}
+}
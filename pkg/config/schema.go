@@ -0,0 +1,229 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/novacove/imbued/pkg/secrets"
+)
+
+// SchemaID is the identifier of the JSON Schema of .imbued files
+const SchemaID = "https://github.com/novacove/imbued/imbued.schema.json"
+
+// schema is a JSON Schema document or subschema
+type schema map[string]interface{}
+
+// schemaProvider is implemented by config types that decode themselves from
+// more than one TOML shape, and so describe their own schema
+type schemaProvider interface {
+	jsonSchema() schema
+}
+
+// schemaDescriptions documents the keys of each config type, by Go type name
+// and TOML key
+var schemaDescriptions = map[string]string{
+	"configFile.version":               "Format version of the file, updated by imbued config migrate",
+	"configFile.inherit":               "Merge this file over the nearest .imbued file in a parent directory",
+	"configFile.extends":               "Path of a .imbued file to merge this file over, relative to this file",
+	"configFile.include":               "Paths of sets of secrets, templates, env values and backends to merge this file over, relative to this file",
+	"configFile.secrets":               "Secrets to inject, by name in the backend",
+	"configFile.templates":             "Environment variables rendered from Go templates over the secrets, e.g. \"postgres://app:{{ .DB_PASSWORD }}@db/app\"",
+	"configFile.env":                   "Plain, non-secret environment values",
+	"configFile.valid_depth":           "Number of child directories down that the config's values are available for (default 1)",
+	"configFile.backend_type":          "Type of the default secret backend",
+	"configFile.backend_config":        "Options of the default secret backend",
+	"configFile.backend_policy":        "Timeouts, retries and circuit breaker settings of the default secret backend",
+	"configFile.backends":              "Named secret backends",
+	"configFile.default_backend":       "Backend, or chain of backends, of the secrets that don't name one",
+	"configFile.secret_backends":       "Backend, or chain of backends, of individual secrets",
+	"configFile.cache_ttl":             "How long the server caches resolved secrets, as a duration such as \"5m\" (default: no caching)",
+	"configFile.secret_cache_ttl":      "Per-secret overrides of cache_ttl",
+	"configFile.offline_snapshot":      "Serve the last fetched values when the backend is unreachable",
+	"configFile.offline_max_staleness": "Maximum age of a snapshotted value that may be served, as a duration (default \"24h\")",
+	"configFile.profiles":              "Named partial configs layered over the file with `imbued use`",
+	"configFile.profile_rules":         "Rules selecting a profile automatically, in order of precedence",
+	"backendFile.type":                 "Type of the secret backend",
+	"backendFile.config":               "Backend-specific options",
+	"backendFile.policy":               "Timeouts, retries and circuit breaker settings of the backend",
+	"policyFile.timeout":               "Maximum duration of a single backend call",
+	"policyFile.retries":               "Number of times a failed call is retried",
+	"policyFile.backoff":               "Delay before the first retry, doubled on each further retry",
+	"policyFile.breaker_threshold":     "Consecutive failures after which calls fail fast (0 disables the circuit breaker)",
+	"policyFile.breaker_cooldown":      "How long calls fail fast once the circuit breaker opens",
+	"ProfileRule.profile":              "Profile selected by the rule",
+	"ProfileRule.branch":               "Glob pattern for the git branch of the config's repository",
+	"ProfileRule.hostname":             "Glob pattern for the machine's hostname",
+	"ProfileRule.user":                 "Glob pattern for the current username",
+	"ProfileRule.env":                  "Environment variable that must be set in the shell",
+}
+
+// profileExcludedKeys are the keys of a .imbued file that profiles can't set
+var profileExcludedKeys = []string{"version", "inherit", "extends", "include", "profiles", "profile_rules"}
+
+// JSONSchema returns a JSON Schema of .imbued files, generated from the
+// config types and the options registered by each backend
+func JSONSchema() ([]byte, error) {
+	configType := reflect.TypeOf(configFile{})
+
+	root := schemaForStruct(configType, nil)
+	root["$schema"] = "http://json-schema.org/draft-07/schema#"
+	root["$id"] = SchemaID
+	root["title"] = ".imbued"
+	root["description"] = "Configuration of the secrets and values imbued injects into a directory"
+	root["properties"].(schema)["$schema"] = schema{
+		"type":        "string",
+		"description": "JSON Schema of the file, for editors of YAML and JSON configs",
+	}
+	root["definitions"] = schema{
+		"profile": schemaForStruct(configType, profileExcludedKeys),
+	}
+
+	return json.MarshalIndent(root, "", "  ")
+}
+
+// schemaFor returns the schema of a config type
+func schemaFor(t reflect.Type) schema {
+	if t.Kind() == reflect.Ptr {
+		return schemaFor(t.Elem())
+	}
+	if t.Implements(reflect.TypeOf((*schemaProvider)(nil)).Elem()) {
+		return reflect.Zero(t).Interface().(schemaProvider).jsonSchema()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return schema{"type": "string"}
+	case reflect.Bool:
+		return schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return schema{"type": "integer"}
+	case reflect.Slice:
+		return schema{"type": "array", "items": schemaFor(t.Elem())}
+	case reflect.Map:
+		return schema{"type": "object", "additionalProperties": schemaFor(t.Elem())}
+	case reflect.Struct:
+		// Profiles are config files themselves, without the keys they can't set
+		if t == reflect.TypeOf(configFile{}) {
+			return schema{"$ref": "#/definitions/profile"}
+		}
+		return schemaForStruct(t, nil)
+	default:
+		return schema{}
+	}
+}
+
+// schemaForStruct returns the schema of a struct decoded from a TOML table,
+// leaving out the given keys
+func schemaForStruct(t reflect.Type, excluded []string) schema {
+	properties := schema{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := strings.Split(field.Tag.Get("toml"), ",")[0]
+		if !field.IsExported() || key == "" || key == "-" || containsString(excluded, key) {
+			continue
+		}
+
+		property := schemaFor(field.Type)
+		if description, ok := schemaDescriptions[t.Name()+"."+key]; ok {
+			property["description"] = description
+		}
+		properties[key] = property
+	}
+
+	s := schema{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+
+	// Backend types decide which options their config takes
+	switch t {
+	case reflect.TypeOf(configFile{}):
+		s["allOf"] = backendOptionsSchema("backend_type", "backend_config")
+	case reflect.TypeOf(backendFile{}):
+		s["allOf"] = backendOptionsSchema("type", "config")
+		s["required"] = []string{"type"}
+	}
+
+	return s
+}
+
+// backendOptionsSchema returns conditions that restrict typeKey to the
+// supported backend types, and configKey to the options of the chosen type
+func backendOptionsSchema(typeKey, configKey string) []schema {
+	types := secrets.BackendTypeNames()
+	conditions := []schema{{
+		"properties": schema{typeKey: schema{"enum": types}},
+	}}
+
+	for _, backendType := range types {
+		options, _ := secrets.OptionsFor(backendType)
+
+		properties := schema{}
+		required := []string{}
+		for _, option := range options {
+			properties[option.Name] = schema{"type": "string", "description": option.Description}
+			if option.Required {
+				required = append(required, option.Name)
+			}
+		}
+
+		conditions = append(conditions, schema{
+			"if": schema{
+				"properties": schema{typeKey: schema{"const": backendType}},
+				"required":   []string{typeKey},
+			},
+			"then": schema{
+				"properties": schema{configKey: schema{
+					"type":       "object",
+					"properties": properties,
+					"required":   required,
+				}},
+			},
+		})
+	}
+
+	return conditions
+}
+
+// jsonSchema describes the string and inline table forms of a secret entry
+func (s Secret) jsonSchema() schema {
+	return schema{
+		"oneOf": []schema{
+			{
+				"type":        "string",
+				"description": "Environment variable the secret is exported as",
+			},
+			{
+				"type": "object",
+				"properties": schema{
+					"env": schema{
+						"description": "Environment variable, or list of variables, the value is exported as. Defaults to the secret name",
+						"oneOf":       []schema{{"type": "string"}, {"type": "array", "items": schema{"type": "string"}}},
+					},
+					"name":        schema{"type": "string", "description": "Name of the secret in the backend, e.g. vault/item for 1Password. Defaults to the secret name"},
+					"field":       schema{"type": "string", "description": "Field of the item to read instead of the password (1Password)"},
+					"json_key":    schema{"type": "string", "description": "Key to extract when the value is a JSON object"},
+					"required":    schema{"type": "boolean", "description": "Fail injecting instead of skipping the secret if it can't be resolved"},
+					"transform":   schema{"enum": secrets.TransformNames(), "description": "Transform applied to the value, after json_key"},
+					"backend":     BackendChain{}.jsonSchema(),
+					"cache_ttl":   schema{"type": "string", "description": "How long the value may be cached, in place of secret_cache_ttl"},
+					"valid_depth": schema{"type": "integer", "minimum": 0, "description": "Number of child directories down the secret is available for, in place of valid_depth"},
+				},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+// jsonSchema describes the single name and list forms of a backend chain
+func (c BackendChain) jsonSchema() schema {
+	return schema{
+		"description": "Backend name, or list of backend names looked up in order",
+		"oneOf": []schema{
+			{"type": "string"},
+			{"type": "array", "items": schema{"type": "string"}, "minItems": 1},
+		},
+	}
+}
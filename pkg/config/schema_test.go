@@ -0,0 +1,79 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONSchema(t *testing.T) {
+	data, err := JSONSchema()
+	if err != nil {
+		t.Fatalf("JSONSchema() error = %v", err)
+	}
+
+	var root map[string]interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		t.Fatalf("JSONSchema() isn't valid JSON: %v", err)
+	}
+	if root["$id"] != SchemaID {
+		t.Errorf("$id = %v, want %s", root["$id"], SchemaID)
+	}
+
+	// Every key of a .imbued file is described, and profiles can't set the excluded ones
+	properties := root["properties"].(map[string]interface{})
+	profile := root["definitions"].(map[string]interface{})["profile"].(map[string]interface{})
+	profileProperties := profile["properties"].(map[string]interface{})
+
+	configType := reflect.TypeOf(configFile{})
+	for i := 0; i < configType.NumField(); i++ {
+		key := strings.Split(configType.Field(i).Tag.Get("toml"), ",")[0]
+		if key == "" {
+			continue
+		}
+
+		property, ok := properties[key].(map[string]interface{})
+		if !ok {
+			t.Errorf("schema has no property %s", key)
+			continue
+		}
+		if property["description"] == nil {
+			t.Errorf("property %s has no description", key)
+		}
+
+		_, inProfile := profileProperties[key]
+		if excluded := containsString(profileExcludedKeys, key); inProfile == excluded {
+			t.Errorf("profile property %s present = %v, want %v", key, inProfile, !excluded)
+		}
+	}
+
+	// Secret entries take every key UnmarshalTOML accepts
+	secretSchema := properties["secrets"].(map[string]interface{})["additionalProperties"].(map[string]interface{})
+	secretTable := secretSchema["oneOf"].([]interface{})[1].(map[string]interface{})
+	for _, key := range secretKeys {
+		if _, ok := secretTable["properties"].(map[string]interface{})[key]; !ok {
+			t.Errorf("secret entry schema has no property %s", key)
+		}
+	}
+
+	// Backend types restrict their config to the options they register
+	var envFile map[string]interface{}
+	for _, condition := range root["allOf"].([]interface{}) {
+		condition := condition.(map[string]interface{})
+		ifSchema, ok := condition["if"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		backendType := ifSchema["properties"].(map[string]interface{})["backend_type"].(map[string]interface{})["const"]
+		if backendType == "env_file" {
+			envFile = condition["then"].(map[string]interface{})["properties"].(map[string]interface{})["backend_config"].(map[string]interface{})
+		}
+	}
+	if envFile == nil {
+		t.Fatal("schema has no condition for env_file backends")
+	}
+	if got := envFile["required"]; !reflect.DeepEqual(got, []interface{}{"file_path"}) {
+		t.Errorf("env_file required options = %v, want [file_path]", got)
+	}
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/novacove/imbued/pkg/secrets"
+)
+
+// Secret is an entry of the [secrets] table. An entry is either a plain
+// string naming the environment variable, or an inline table:
+//
+//	API_KEY = { env = ["API_KEY", "LEGACY_API_KEY"], field = "token", json_key = "value", required = true, transform = "base64decode" }
+type Secret struct {
+	Name       string         // Name of the secret in the backend, the key of the entry unless set by name
+	Env        []string       // Environment variables the value is exported as
+	Field      string         // Field of the backend item to read, for backends that support fields
+	JSONKey    string         // Key to extract when the value is a JSON object
+	Required   bool           // Whether injecting fails when the secret can't be resolved
+	Transform  string         // Transform applied to the value, see secrets.TransformNames
+	Backends   BackendChain   // Backends the secret is looked up in, in place of secret_backends
+	CacheTTL   *time.Duration // How long the value may be cached, in place of secret_cache_ttl
+	ValidDepth *int           // Number of child directories down the secret is available for, in place of valid_depth
+}
+
+// secretKeys are the keys allowed in an inline secret table
+var secretKeys = []string{"env", "name", "field", "json_key", "required", "transform", "backend", "cache_ttl", "valid_depth"}
+
+// UnmarshalTOML decodes a secret entry from a string or an inline table
+func (s *Secret) UnmarshalTOML(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		s.Env = []string{v}
+		return nil
+	case map[string]interface{}:
+		return s.unmarshalTable(v)
+	default:
+		return fmt.Errorf("expected an environment variable name or a table, got %T", value)
+	}
+}
+
+// unmarshalTable decodes the inline table form of a secret entry
+func (s *Secret) unmarshalTable(table map[string]interface{}) error {
+	for key := range table {
+		if !containsString(secretKeys, key) {
+			return fmt.Errorf("unknown key %q (expected one of %s)", key, strings.Join(secretKeys, ", "))
+		}
+	}
+
+	// Without an env key the secret is exported under its own name, which
+	// LoadConfig fills in. An empty list means the secret is never exported.
+	if env, ok := table["env"]; ok {
+		names, err := stringList(env)
+		if err != nil {
+			return fmt.Errorf("invalid env: %w", err)
+		}
+		s.Env = names
+	}
+
+	var err error
+	if s.Name, err = optionalString(table, "name"); err != nil {
+		return err
+	}
+	if s.Field, err = optionalString(table, "field"); err != nil {
+		return err
+	}
+	if s.JSONKey, err = optionalString(table, "json_key"); err != nil {
+		return err
+	}
+	if s.Transform, err = optionalString(table, "transform"); err != nil {
+		return err
+	}
+	if s.Transform != "" && !secrets.IsTransform(s.Transform) {
+		return fmt.Errorf("unknown transform %q (expected one of %s)", s.Transform, strings.Join(secrets.TransformNames(), ", "))
+	}
+
+	if required, ok := table["required"]; ok {
+		if s.Required, ok = required.(bool); !ok {
+			return fmt.Errorf("required must be a boolean, got %T", required)
+		}
+	}
+
+	if backend, ok := table["backend"]; ok {
+		if err := s.Backends.UnmarshalTOML(backend); err != nil {
+			return fmt.Errorf("invalid backend: %w", err)
+		}
+	}
+
+	if ttl, ok := table["cache_ttl"]; ok {
+		str, ok := ttl.(string)
+		if !ok {
+			return fmt.Errorf("cache_ttl must be a duration string, got %T", ttl)
+		}
+		parsed, err := time.ParseDuration(str)
+		if err != nil {
+			return fmt.Errorf("invalid cache_ttl: %w", err)
+		}
+		s.CacheTTL = &parsed
+	}
+
+	// A depth of 0 limits the secret to the config's own directory
+	if depth, ok := table["valid_depth"]; ok {
+		value, ok := depth.(int64)
+		if !ok {
+			return fmt.Errorf("valid_depth must be an integer, got %T", depth)
+		}
+		if value < 0 {
+			return fmt.Errorf("valid_depth must not be negative")
+		}
+		validDepth := int(value)
+		s.ValidDepth = &validDepth
+	}
+
+	return nil
+}
+
+// Process applies the entry's json_key and transform to a value fetched from the backend
+func (s *Secret) Process(value string) (string, error) {
+	var err error
+	if s.JSONKey != "" {
+		if value, err = secrets.ExtractJSONKey(value, s.JSONKey); err != nil {
+			return "", err
+		}
+	}
+
+	if s.Transform != "" {
+		if value, err = secrets.ApplyTransform(s.Transform, value); err != nil {
+			return "", err
+		}
+	}
+
+	return value, nil
+}
+
+// EnvNames returns the environment variables of the secret as a comma separated list
+func (s *Secret) EnvNames() string {
+	return strings.Join(s.Env, ",")
+}
+
+// SecretNames returns the sorted names of the config's secrets
+func (c *ImbuedConfig) SecretNames() []string {
+	names := make([]string, 0, len(c.Secrets))
+	for name := range c.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// stringList decodes a string or an array of strings
+func stringList(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			str, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected strings, got %T", item)
+			}
+			list = append(list, str)
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("expected a string or a list of strings, got %T", value)
+	}
+}
+
+// optionalString returns the string value of a key in a table, or "" if absent
+func optionalString(table map[string]interface{}, key string) (string, error) {
+	value, ok := table[key]
+	if !ok {
+		return "", nil
+	}
+
+	str, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string, got %T", key, value)
+	}
+	return str, nil
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
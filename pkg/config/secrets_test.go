@@ -0,0 +1,182 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestSecretUnmarshalTOML(t *testing.T) {
+	minute := time.Minute
+
+	tests := []struct {
+		name  string
+		entry string
+		want  Secret
+		err   string
+	}{
+		{
+			name:  "string",
+			entry: `"DATABASE_PASSWORD"`,
+			want:  Secret{Env: []string{"DATABASE_PASSWORD"}},
+		},
+		{
+			name:  "table",
+			entry: `{ env = "API_KEY", field = "token", json_key = "value", required = true, transform = "base64decode", backend = "vault", cache_ttl = "1m" }`,
+			want: Secret{
+				Env:       []string{"API_KEY"},
+				Field:     "token",
+				JSONKey:   "value",
+				Required:  true,
+				Transform: "base64decode",
+				Backends:  BackendChain{"vault"},
+				CacheTTL:  &minute,
+			},
+		},
+		{
+			name:  "several variables and backends",
+			entry: `{ env = ["API_KEY", "LEGACY_API_KEY"], backend = ["local", "vault"] }`,
+			want:  Secret{Env: []string{"API_KEY", "LEGACY_API_KEY"}, Backends: BackendChain{"local", "vault"}},
+		},
+		{
+			name:  "never exported",
+			entry: `{ env = [] }`,
+			want:  Secret{Env: []string{}},
+		},
+		{
+			name:  "valid_depth",
+			entry: `{ valid_depth = 0 }`,
+			want:  Secret{ValidDepth: new(int)},
+		},
+		{
+			name:  "unknown key",
+			entry: `{ envs = "API_KEY" }`,
+			err:   `unknown key "envs"`,
+		},
+		{
+			name:  "unknown transform",
+			entry: `{ transform = "rot13" }`,
+			err:   `unknown transform "rot13"`,
+		},
+		{
+			name:  "invalid env",
+			entry: `{ env = [1] }`,
+			err:   "invalid env: expected strings, got int64",
+		},
+		{
+			name:  "invalid required",
+			entry: `{ required = "yes" }`,
+			err:   "required must be a boolean, got string",
+		},
+		{
+			name:  "invalid field",
+			entry: `{ field = 1 }`,
+			err:   "field must be a string, got int64",
+		},
+		{
+			name:  "invalid cache_ttl",
+			entry: `{ cache_ttl = "soon" }`,
+			err:   "invalid cache_ttl",
+		},
+		{
+			name:  "negative valid_depth",
+			entry: `{ valid_depth = -1 }`,
+			err:   "valid_depth must not be negative",
+		},
+		{
+			name:  "empty backend list",
+			entry: `{ backend = [] }`,
+			err:   "invalid backend: backend list must not be empty",
+		},
+		{
+			name:  "neither a string nor a table",
+			entry: `42`,
+			err:   "expected an environment variable name or a table, got int64",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var file struct {
+				Secrets map[string]*Secret `toml:"secrets"`
+			}
+			_, err := toml.Decode("[secrets]\nAPI_KEY = "+tt.entry, &file)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Decode() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if got := file.Secrets["API_KEY"]; !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("Decode() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretProcess(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret Secret
+		value  string
+		want   string
+		err    string
+	}{
+		{name: "as is", value: " s3cr3t ", want: " s3cr3t "},
+		{name: "json_key", secret: Secret{JSONKey: "password"}, value: `{"user": "app", "password": "s3cr3t"}`, want: "s3cr3t"},
+		{name: "json_key of an object", secret: Secret{JSONKey: "db"}, value: `{"db": {"port": 5432}}`, want: `{"port": 5432}`},
+		{name: "transform", secret: Secret{Transform: "base64decode"}, value: "czNjcjN0", want: "s3cr3t"},
+		{name: "json_key then transform", secret: Secret{JSONKey: "key", Transform: "upper"}, value: `{"key": "abc"}`, want: "ABC"},
+		{name: "missing json_key", secret: Secret{JSONKey: "password"}, value: `{"user": "app"}`, err: `JSON key "password" not found`},
+		{name: "not JSON", secret: Secret{JSONKey: "password"}, value: "s3cr3t", err: "secret is not a JSON object"},
+		{name: "failing transform", secret: Secret{Transform: "base64decode"}, value: "not base64!", err: "base64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.secret.Process(tt.value)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Process() = %q, %v, want error %q", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Process() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigSecrets(t *testing.T) {
+	cfg, err := loadTestConfig(t, `backend_type = "env_file"
+[secrets]
+DB_PASSWORD = {}
+API_KEY = { cache_ttl = "1m" }`)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	secret := cfg.Secrets["DB_PASSWORD"]
+	if secret.Name != "DB_PASSWORD" || !reflect.DeepEqual(secret.Env, []string{"DB_PASSWORD"}) {
+		t.Errorf("DB_PASSWORD = %+v, want exported under its own name", secret)
+	}
+	if ttl := cfg.CacheTTLFor("API_KEY"); ttl != time.Minute {
+		t.Errorf("CacheTTLFor(API_KEY) = %s, want 1m", ttl)
+	}
+
+	_, err = loadTestConfig(t, `backend_type = "env_file"
+[secrets]
+API_KEY = { cache_ttl = "1m" }
+[secret_cache_ttl]
+API_KEY = "5m"`)
+	if err == nil || !strings.Contains(err.Error(), `secret "API_KEY" sets cache_ttl both in [secrets] and [secret_cache_ttl]`) {
+		t.Errorf("LoadConfig() error = %v, want a cache_ttl conflict", err)
+	}
+}
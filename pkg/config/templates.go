@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Template is an entry of the [templates] table: an environment variable
+// rendered with text/template from the values of other secrets, e.g.
+//
+//	DATABASE_URL = "postgres://{{ .DB_USER }}:{{ urlquery .DB_PASSWORD }}@db:5432/app"
+type Template struct {
+	Name         string   // Environment variable the template is exported as
+	Text         string   // Template source
+	Dependencies []string // Sorted names of the secrets the template references
+
+	tmpl *template.Template
+}
+
+// parseTemplate parses the template of an environment variable and collects
+// the secrets it references
+func parseTemplate(name, text string) (*Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	deps := make(map[string]bool)
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			collectFields(t.Tree.Root, deps)
+		}
+	}
+
+	dependencies := make([]string, 0, len(deps))
+	for dep := range deps {
+		dependencies = append(dependencies, dep)
+	}
+	sort.Strings(dependencies)
+
+	return &Template{
+		Name:         name,
+		Text:         text,
+		Dependencies: dependencies,
+		tmpl:         tmpl,
+	}, nil
+}
+
+// collectFields adds the top-level fields referenced under a node, such as
+// DB_USER in {{ .DB_USER }}, to deps
+func collectFields(node parse.Node, deps map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectFields(child, deps)
+		}
+	case *parse.ActionNode:
+		collectFields(n.Pipe, deps)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectFields(cmd, deps)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectFields(arg, deps)
+		}
+	case *parse.FieldNode:
+		deps[n.Ident[0]] = true
+	case *parse.IfNode:
+		collectBranch(&n.BranchNode, deps)
+	case *parse.RangeNode:
+		collectBranch(&n.BranchNode, deps)
+	case *parse.WithNode:
+		collectBranch(&n.BranchNode, deps)
+	case *parse.TemplateNode:
+		collectFields(n.Pipe, deps)
+	}
+}
+
+// collectBranch collects the fields of an if, range or with node
+func collectBranch(n *parse.BranchNode, deps map[string]bool) {
+	collectFields(n.Pipe, deps)
+	collectFields(n.List, deps)
+	collectFields(n.ElseList, deps)
+}
+
+// Render renders the template from the given values
+func (t *Template) Render(values map[string]string) (string, error) {
+	var out strings.Builder
+	if err := t.tmpl.Execute(&out, values); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", t.Name, err)
+	}
+	return out.String(), nil
+}
+
+// loadTemplates parses the [templates] table and checks that every template
+// only references declared secrets and doesn't clash with a secret's
+// environment variables
+func (c *ImbuedConfig) loadTemplates(templates map[string]string) error {
+	exported := c.exportedBy()
+
+	c.Templates = make(map[string]*Template, len(templates))
+	for name, text := range templates {
+		if owner, ok := exported[name]; ok {
+			return fmt.Errorf("template %s is also exported by %s", name, owner)
+		}
+
+		tmpl, err := parseTemplate(name, text)
+		if err != nil {
+			return fmt.Errorf("invalid template %s: %w", name, err)
+		}
+
+		for _, dep := range tmpl.Dependencies {
+			if _, ok := c.Secrets[dep]; !ok {
+				return fmt.Errorf("template %s references unknown secret %q", name, dep)
+			}
+		}
+
+		c.Templates[name] = tmpl
+	}
+
+	return nil
+}
+
+// TemplateNames returns the sorted names of the config's templates
+func (c *ImbuedConfig) TemplateNames() []string {
+	names := make([]string, 0, len(c.Templates))
+	for name := range c.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTemplate(t *testing.T) {
+	tests := []struct {
+		text string
+		deps []string
+		err  string
+	}{
+		{text: "plain", deps: []string{}},
+		{text: "postgres://{{ .DB_USER }}:{{ urlquery .DB_PASSWORD }}@db/app", deps: []string{"DB_PASSWORD", "DB_USER"}},
+		{text: "{{ if .TLS }}https{{ else }}{{ .SCHEME }}{{ end }}://{{ .HOST }}", deps: []string{"HOST", "SCHEME", "TLS"}},
+		{text: "{{ with .TOKEN }}Bearer {{ . }}{{ end }}", deps: []string{"TOKEN"}},
+		{text: "{{ .A }}{{ .A }}", deps: []string{"A"}},
+		{text: "{{ .DB_USER", err: "unclosed action"},
+		{text: "{{ nosuchfunc .A }}", err: `function "nosuchfunc" not defined`},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := parseTemplate("DATABASE_URL", tt.text)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseTemplate(%q) error = %v, want %q", tt.text, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTemplate(%q) error = %v", tt.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(tmpl.Dependencies, tt.deps) {
+			t.Errorf("parseTemplate(%q) dependencies = %q, want %q", tt.text, tmpl.Dependencies, tt.deps)
+		}
+	}
+}
+
+func TestTemplateRender(t *testing.T) {
+	values := map[string]string{"DB_USER": "app", "DB_PASSWORD": "p@ss word", "TLS": ""}
+
+	tests := []struct {
+		name string
+		text string
+		want string
+		err  string
+	}{
+		{name: "fields", text: "postgres://{{ .DB_USER }}:{{ urlquery .DB_PASSWORD }}@db/app", want: "postgres://app:p%40ss+word@db/app"},
+		{name: "condition", text: "{{ if .TLS }}https{{ else }}http{{ end }}", want: "http"},
+		{name: "missing value", text: "{{ .API_KEY }}", err: `failed to render DATABASE_URL: template: DATABASE_URL:1:3: executing "DATABASE_URL" at <.API_KEY>: map has no entry for key "API_KEY"`},
+		{name: "failing function", text: `{{ index .DB_USER 10 }}`, err: "failed to render DATABASE_URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseTemplate("DATABASE_URL", tt.text)
+			if err != nil {
+				t.Fatalf("parseTemplate() error = %v", err)
+			}
+
+			got, err := tmpl.Render(values)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Render() = %q, %v, want error %q", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Render() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTemplates(t *testing.T) {
+	tests := []struct {
+		name      string
+		templates string
+		err       string
+	}{
+		{name: "valid", templates: `DATABASE_URL = "postgres://{{ .DB_USER }}:{{ .DB_PASSWORD }}@db/app"`},
+		{name: "unknown secret", templates: `DATABASE_URL = "{{ .DB_HOST }}"`, err: `template DATABASE_URL references unknown secret "DB_HOST"`},
+		{name: "exported by a secret", templates: `DB_PASS = "{{ .DB_USER }}"`, err: `template DB_PASS is also exported by secret "DB_PASSWORD"`},
+		{name: "invalid", templates: `DATABASE_URL = "{{ .DB_USER"`, err: "invalid template DATABASE_URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadTestConfig(t, `backend_type = "env_file"
+[secrets]
+DB_USER = "DB_USER"
+DB_PASSWORD = { env = ["DB_PASSWORD", "DB_PASS"] }
+[templates]
+`+tt.templates)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("LoadConfig() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			if got := cfg.TemplateNames(); !reflect.DeepEqual(got, []string{"DATABASE_URL"}) {
+				t.Errorf("TemplateNames() = %q", got)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package secrets
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -13,8 +14,17 @@ type AWSSecretManagerBackend struct {
 	initialized  bool
 }
 
+func init() {
+	RegisterBackendOptions(AWSSecretManager,
+		BackendOption{Name: "region", Description: "AWS region of the secrets", Required: true},
+		BackendOption{Name: "access_key", Description: "AWS access key ID", Required: true, Credential: true},
+		BackendOption{Name: "secret_key", Description: "AWS secret access key", Required: true, Credential: true},
+		BackendOption{Name: "session_token", Description: "AWS session token, for temporary credentials", Credential: true},
+	)
+}
+
 // Initialize initializes the AWSSecretManagerBackend with the given configuration
-func (b *AWSSecretManagerBackend) Initialize(config map[string]string) error {
+func (b *AWSSecretManagerBackend) Initialize(ctx context.Context, config map[string]string) error {
 	region, ok := config["region"]
 	if !ok {
 		return fmt.Errorf("region is required for aws_secret_manager backend")
@@ -46,7 +56,7 @@ func (b *AWSSecretManagerBackend) Initialize(config map[string]string) error {
 }
 
 // GetSecret retrieves a secret by its key
-func (b *AWSSecretManagerBackend) GetSecret(key string) (string, error) {
+func (b *AWSSecretManagerBackend) GetSecret(ctx context.Context, key string) (string, error) {
 	if !b.initialized {
 		return "", fmt.Errorf("aws_secret_manager backend not initialized")
 	}
@@ -56,7 +66,7 @@ func (b *AWSSecretManagerBackend) GetSecret(key string) (string, error) {
 	return fmt.Sprintf("aws-secret-%s", key), nil
 }
 
-func (b *AWSSecretManagerBackend) StoreSecrets(secrets map[string]string) error {
+func (b *AWSSecretManagerBackend) StoreSecrets(ctx context.Context, secrets map[string]string) error {
 	if !b.initialized {
 		return fmt.Errorf("aws_secret_manager backend not initialized")
 	}
@@ -1,23 +1,57 @@
 package secrets
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
 )
 
-// Backend defines the interface for secret backends
+// ErrSecretNotFound is returned (wrapped) by backends when the requested
+// secret does not exist, as opposed to the backend failing to answer
+var ErrSecretNotFound = errors.New("secret not found")
+
+// Backend defines the interface for secret backends. Every call takes a
+// context, and backends are expected to give up once it is done.
 type Backend interface {
 	// Initialize initializes the backend with the given configuration
-	Initialize(config map[string]string) error
+	Initialize(ctx context.Context, config map[string]string) error
 
 	// GetSecret retrieves a secret by its key
-	GetSecret(key string) (string, error)
+	GetSecret(ctx context.Context, key string) (string, error)
 
-	StoreSecrets(secrets map[string]string) error
+	StoreSecrets(ctx context.Context, secrets map[string]string) error
 
 	// Close cleans up any resources used by the backend
 	Close() error
 }
 
+// BatchGetter is implemented by backends that can retrieve several secrets
+// in a single round trip. Backends that don't implement it are queried with
+// bounded parallel GetSecret calls instead (see GetSecrets).
+type BatchGetter interface {
+	// GetSecrets retrieves the given keys, returning the values that were found
+	// and a per-key error for those that were not
+	GetSecrets(ctx context.Context, keys []string) (map[string]string, map[string]error)
+}
+
+// FieldGetter is implemented by backends whose secrets hold several fields,
+// such as 1Password items, and that can retrieve a single named field
+type FieldGetter interface {
+	// GetSecretField retrieves the given field of a secret
+	GetSecretField(ctx context.Context, key, field string) (string, error)
+}
+
+// GetSecretField retrieves a field of a secret, failing if the backend
+// doesn't support fields
+func GetSecretField(ctx context.Context, backend Backend, key, field string) (string, error) {
+	getter, ok := backend.(FieldGetter)
+	if !ok {
+		return "", fmt.Errorf("backend does not support secret fields")
+	}
+	return getter.GetSecretField(ctx, key, field)
+}
+
 // BackendType represents the type of secret backend
 type BackendType string
 
@@ -40,6 +74,65 @@ const (
 	MacOSKeychainManager BackendType = "macos_keychain_manager"
 )
 
+// BackendOption describes a backend_config key understood by a backend type
+type BackendOption struct {
+	Name        string // Key in backend_config
+	Description string // What the option is for
+	Required    bool   // Whether Initialize fails without it
+	Credential  bool   // Whether the value should be kept out of .imbued files, see KeychainReference
+	Path        bool   // Whether the value is a file path, relative to the .imbued file declaring it
+}
+
+// backendOptions holds the options registered by each backend type
+var backendOptions = make(map[BackendType][]BackendOption)
+
+// RegisterBackendOptions records the backend_config keys of a backend type.
+// Each backend registers its options from init, so that config lint and the
+// config schema stay in sync with what Initialize reads.
+func RegisterBackendOptions(backendType BackendType, options ...BackendOption) {
+	backendOptions[backendType] = append(backendOptions[backendType], options...)
+}
+
+// IsCredential reports whether the named option of a backend type holds a credential
+func IsCredential(backendType, name string) bool {
+	option, _ := findOption(backendType, name)
+	return option.Credential
+}
+
+// IsPath reports whether the named option of a backend type holds a file path
+func IsPath(backendType, name string) bool {
+	option, _ := findOption(backendType, name)
+	return option.Path
+}
+
+// findOption returns the named option of a backend type, and false if the
+// type has no such option
+func findOption(backendType, name string) (BackendOption, bool) {
+	for _, option := range backendOptions[BackendType(backendType)] {
+		if option.Name == name {
+			return option, true
+		}
+	}
+	return BackendOption{}, false
+}
+
+// OptionsFor returns the options of a backend type, and false if the type
+// is not supported
+func OptionsFor(backendType string) ([]BackendOption, bool) {
+	options, ok := backendOptions[BackendType(backendType)]
+	return options, ok
+}
+
+// BackendTypeNames returns the sorted names of the supported backend types
+func BackendTypeNames() []string {
+	names := make([]string, 0, len(backendOptions))
+	for backendType := range backendOptions {
+		names = append(names, string(backendType))
+	}
+	sort.Strings(names)
+	return names
+}
+
 // NewBackend creates a new secret backend based on the given type
 func NewBackend(backendType string) (Backend, error) {
 	switch BackendType(backendType) {
@@ -0,0 +1,74 @@
+package secrets
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultBatchParallelism is the number of concurrent GetSecret calls made
+// when a backend does not implement BatchGetter
+const DefaultBatchParallelism = 4
+
+// GetSecrets retrieves the given keys from the backend. If the backend
+// implements BatchGetter it is used directly, otherwise the keys are fetched
+// with at most parallelism concurrent GetSecret calls.
+func GetSecrets(ctx context.Context, backend Backend, keys []string, parallelism int) (map[string]string, map[string]error) {
+	if batcher, ok := backend.(BatchGetter); ok {
+		return batcher.GetSecrets(ctx, keys)
+	}
+
+	return getSecretsParallel(ctx, backend.GetSecret, keys, parallelism)
+}
+
+// getSecretsParallel calls get for each key with at most parallelism calls
+// in flight. Once ctx is done no more calls are started, and the keys that
+// weren't fetched fail with ctx.Err().
+func getSecretsParallel(ctx context.Context, get func(ctx context.Context, key string) (string, error), keys []string, parallelism int) (map[string]string, map[string]error) {
+	if parallelism <= 0 {
+		parallelism = DefaultBatchParallelism
+	}
+
+	values := make(map[string]string, len(keys))
+	errs := make(map[string]error)
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, parallelism)
+	)
+	for i, key := range keys {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		// The select picks at random when both are ready, and no call may
+		// start once ctx is done
+		if ctx.Err() != nil {
+			mu.Lock()
+			for _, key := range keys[i:] {
+				errs[key] = ctx.Err()
+			}
+			mu.Unlock()
+			break
+		}
+
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			value, err := get(ctx, key)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[key] = err
+				return
+			}
+			values[key] = value
+		}(key)
+	}
+	wg.Wait()
+
+	return values, errs
+}
@@ -0,0 +1,65 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestGetSecretsParallelCancel(t *testing.T) {
+	tests := []struct {
+		name   string
+		cancel string // Key whose call cancels the context, "" to cancel before the batch
+		calls  []string
+		values map[string]string
+	}{
+		{name: "cancelled before", calls: nil, values: map[string]string{}},
+		{name: "cancelled by the first call", cancel: "A", calls: []string{"A"}, values: map[string]string{"A": "a"}},
+		{name: "cancelled by the second call", cancel: "B", calls: []string{"A", "B"}, values: map[string]string{"A": "a", "B": "b"}},
+	}
+
+	keys := []string{"A", "B", "C", "D"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel == "" {
+				cancel()
+			}
+
+			// The calls ignore the context, like a backend that can't be
+			// interrupted would
+			var (
+				mu    sync.Mutex
+				calls []string
+			)
+			get := func(ctx context.Context, key string) (string, error) {
+				mu.Lock()
+				calls = append(calls, key)
+				mu.Unlock()
+				if key == tt.cancel {
+					cancel()
+				}
+				return map[string]string{"A": "a", "B": "b", "C": "c", "D": "d"}[key], nil
+			}
+
+			values, errs := getSecretsParallel(ctx, get, keys, 1)
+			if !reflect.DeepEqual(calls, tt.calls) {
+				t.Errorf("calls = %q, want %q", calls, tt.calls)
+			}
+			if !reflect.DeepEqual(values, tt.values) {
+				t.Errorf("values = %q, want %q", values, tt.values)
+			}
+			for _, key := range keys {
+				if _, ok := tt.values[key]; ok {
+					continue
+				}
+				if !errors.Is(errs[key], context.Canceled) {
+					t.Errorf("error of %s = %v, want %v", key, errs[key], context.Canceled)
+				}
+			}
+		})
+	}
+}
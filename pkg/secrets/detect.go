@@ -0,0 +1,65 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// Detection is a secret store found on the machine
+type Detection struct {
+	Name   string            // Name of the store, e.g. "1Password"
+	Type   string            // Backend type using the store, or "" if no backend supports it
+	Config map[string]string // Backend options holding the store's settings, as found in the environment
+	Note   string            // How the store was found, or why it can't be used
+}
+
+// Usable reports whether a backend can use the store
+func (d Detection) Usable() bool {
+	return d.Type != ""
+}
+
+// DetectBackends looks for the secret stores available on the machine,
+// usable ones first
+func DetectBackends() []Detection {
+	var usable, unsupported []Detection
+
+	if runtime.GOOS == "darwin" {
+		if path, err := exec.LookPath("security"); err == nil {
+			usable = append(usable, Detection{Name: "macOS Keychain", Type: string(MacOSKeychainManager), Note: "found " + path})
+		}
+	}
+
+	if path, err := exec.LookPath("op"); err == nil {
+		usable = append(usable, Detection{
+			Name: "1Password",
+			Type: string(OnePass),
+			Note: fmt.Sprintf("found %s, store its credentials with `imbued credentials set-onepass`", path),
+		})
+	}
+
+	// The values are copied, as the server doesn't share this environment
+	if address := os.Getenv("VAULT_ADDR"); address != "" {
+		if token := os.Getenv("VAULT_TOKEN"); token != "" {
+			usable = append(usable, Detection{
+				Name:   "HashiCorp Vault",
+				Type:   string(Vault),
+				Config: map[string]string{"address": address, "token": token},
+				Note:   "VAULT_ADDR and VAULT_TOKEN are set",
+			})
+		} else {
+			unsupported = append(unsupported, Detection{Name: "HashiCorp Vault", Note: "VAULT_ADDR is set but VAULT_TOKEN isn't"})
+		}
+	}
+
+	if path, err := exec.LookPath("secret-tool"); err == nil {
+		unsupported = append(unsupported, Detection{Name: "Secret Service", Note: fmt.Sprintf("found %s, but imbued has no Secret Service backend yet", path)})
+	}
+
+	if path, err := exec.LookPath("pass"); err == nil {
+		unsupported = append(unsupported, Detection{Name: "pass", Note: fmt.Sprintf("found %s, but imbued has no pass backend yet", path)})
+	}
+
+	return append(usable, unsupported...)
+}
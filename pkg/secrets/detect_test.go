@@ -0,0 +1,84 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestDetectBackends(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("the keychain is always detected on macOS")
+	}
+
+	tests := []struct {
+		name     string
+		commands []string // Commands found in the PATH
+		env      map[string]string
+		want     []string // Names of the detected stores, followed by their backend type
+	}{
+		{name: "nothing", want: nil},
+		{
+			name:     "usable first",
+			commands: []string{"pass", "op"},
+			want:     []string{"1Password onepass", "pass "},
+		},
+		{
+			name: "vault",
+			env:  map[string]string{"VAULT_ADDR": "https://vault.example.com", "VAULT_TOKEN": "s.abc"},
+			want: []string{"HashiCorp Vault vault"},
+		},
+		{
+			name: "vault without a token",
+			env:  map[string]string{"VAULT_ADDR": "https://vault.example.com"},
+			want: []string{"HashiCorp Vault "},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bin := t.TempDir()
+			for _, command := range tt.commands {
+				if err := os.WriteFile(filepath.Join(bin, command), []byte("#!/bin/sh\n"), 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			t.Setenv("PATH", bin)
+			t.Setenv("VAULT_ADDR", "")
+			t.Setenv("VAULT_TOKEN", "")
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			var got []string
+			for _, detection := range DetectBackends() {
+				got = append(got, detection.Name+" "+detection.Type)
+				if detection.Usable() != (detection.Type != "") {
+					t.Errorf("%s: Usable() = %v", detection.Name, detection.Usable())
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DetectBackends() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectBackendsVaultConfig(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "https://vault.example.com")
+	t.Setenv("VAULT_TOKEN", "s.abc")
+
+	// The server doesn't share the environment, so values are copied
+	want := map[string]string{"address": "https://vault.example.com", "token": "s.abc"}
+	for _, detection := range DetectBackends() {
+		if detection.Type == string(Vault) {
+			if !reflect.DeepEqual(detection.Config, want) {
+				t.Errorf("Config = %q, want %q", detection.Config, want)
+			}
+			return
+		}
+	}
+	t.Error("DetectBackends() didn't detect Vault")
+}
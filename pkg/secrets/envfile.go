@@ -2,6 +2,7 @@ package secrets
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -14,8 +15,14 @@ type EnvFileBackend struct {
 	secrets  map[string]string
 }
 
+func init() {
+	RegisterBackendOptions(EnvFile,
+		BackendOption{Name: "file_path", Description: "Path of the .env file holding the secrets", Required: true, Path: true},
+	)
+}
+
 // Initialize initializes the EnvFileBackend with the given configuration
-func (b *EnvFileBackend) Initialize(config map[string]string) error {
+func (b *EnvFileBackend) Initialize(ctx context.Context, config map[string]string) error {
 	filePath, ok := config["file_path"]
 	if !ok {
 		return fmt.Errorf("file_path is required for env_file backend")
@@ -61,19 +68,34 @@ func (b *EnvFileBackend) Initialize(config map[string]string) error {
 	return nil
 }
 
-func (b *EnvFileBackend) StoreSecrets(secrets map[string]string) error {
+func (b *EnvFileBackend) StoreSecrets(ctx context.Context, secrets map[string]string) error {
 	return errors.New("we do not support storing secrets in env_file backend")
 }
 
 // GetSecret retrieves a secret by its key
-func (b *EnvFileBackend) GetSecret(key string) (string, error) {
+func (b *EnvFileBackend) GetSecret(ctx context.Context, key string) (string, error) {
 	value, ok := b.secrets[key]
 	if !ok {
-		return "", fmt.Errorf("secret not found: %s", key)
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, key)
 	}
 	return value, nil
 }
 
+// GetSecrets retrieves several secrets at once from the parsed file
+func (b *EnvFileBackend) GetSecrets(ctx context.Context, keys []string) (map[string]string, map[string]error) {
+	values := make(map[string]string, len(keys))
+	errs := make(map[string]error)
+	for _, key := range keys {
+		value, err := b.GetSecret(ctx, key)
+		if err != nil {
+			errs[key] = err
+			continue
+		}
+		values[key] = value
+	}
+	return values, errs
+}
+
 // Close cleans up any resources used by the backend
 func (b *EnvFileBackend) Close() error {
 	// Nothing to clean up for EnvFileBackend
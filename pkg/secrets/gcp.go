@@ -1,6 +1,7 @@
 package secrets
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -11,8 +12,15 @@ type GCPSecretManagerBackend struct {
 	initialized bool
 }
 
+func init() {
+	RegisterBackendOptions(GCPSecretManager,
+		BackendOption{Name: "project_id", Description: "ID of the GCP project holding the secrets", Required: true},
+		BackendOption{Name: "credentials", Description: "Path of the service account credentials file", Required: true, Path: true},
+	)
+}
+
 // Initialize initializes the GCPSecretManagerBackend with the given configuration
-func (b *GCPSecretManagerBackend) Initialize(config map[string]string) error {
+func (b *GCPSecretManagerBackend) Initialize(ctx context.Context, config map[string]string) error {
 	projectID, ok := config["project_id"]
 	if !ok {
 		return fmt.Errorf("project_id is required for gcp_secret_manager backend")
@@ -34,7 +42,7 @@ func (b *GCPSecretManagerBackend) Initialize(config map[string]string) error {
 }
 
 // GetSecret retrieves a secret by its key
-func (b *GCPSecretManagerBackend) GetSecret(key string) (string, error) {
+func (b *GCPSecretManagerBackend) GetSecret(ctx context.Context, key string) (string, error) {
 	if !b.initialized {
 		return "", fmt.Errorf("gcp_secret_manager backend not initialized")
 	}
@@ -44,7 +52,7 @@ func (b *GCPSecretManagerBackend) GetSecret(key string) (string, error) {
 	return fmt.Sprintf("gcp-secret-%s", key), nil
 }
 
-func (b *GCPSecretManagerBackend) StoreSecrets(secrets map[string]string) error {
+func (b *GCPSecretManagerBackend) StoreSecrets(ctx context.Context, secrets map[string]string) error {
 	if !b.initialized {
 		return fmt.Errorf("gcp_secret_manager backend not initialized")
 	}
@@ -1,73 +1,36 @@
 package secrets
 
 import (
-	"github.com/keybase/go-keychain"
+	"context"
 )
 
+// MacOSKeychainBackend stores secrets in the macOS keychain. Its keychain
+// calls are in macOSKeychain_darwin.go, and fail on other platforms
 type MacOSKeychainBackend struct{}
 
-func NewMacOSKeychainBackend() *MacOSKeychainBackend {
-	return &MacOSKeychainBackend{}
+// The keychain backend takes no options
+func init() {
+	RegisterBackendOptions(MacOSKeychainManager)
 }
 
-// Get retrieves a secret from the macOS keychain.
-func (b *MacOSKeychainBackend) Get(service, account string) (string, error) {
-	query := keychain.NewItem()
-	query.SetSecClass(keychain.SecClassGenericPassword)
-	query.SetService(service)
-	query.SetAccount(account)
-	query.SetMatchLimit(keychain.MatchLimitOne)
-	query.SetReturnData(true)
-
-	results, err := keychain.QueryItem(query)
-	if err != nil {
-		return "", err
-	}
-	if len(results) == 0 {
-		return "", nil // No matching item found
-	}
-
-	return string(results[0].Data), nil
-}
-
-// Set stores a secret in the macOS keychain.
-func (b *MacOSKeychainBackend) Set(service, account, secret string) error {
-	item := keychain.NewItem()
-	item.SetSecClass(keychain.SecClassGenericPassword)
-	item.SetService(service)
-	item.SetAccount(account)
-	item.SetData([]byte(secret))
-	item.SetAccessible(keychain.AccessibleWhenUnlocked)
-
-	// Add or update the item in the keychain
-	err := keychain.AddItem(item)
-	if err == keychain.ErrorDuplicateItem {
-		// Update the existing item
-		return keychain.UpdateItem(item, item)
-	}
-	return err
-}
-
-// Delete removes a secret from the macOS keychain.
-func (b *MacOSKeychainBackend) Delete(service, account string) error {
-	item := keychain.NewItem()
-	item.SetSecClass(keychain.SecClassGenericPassword)
-	item.SetService(service)
-	item.SetAccount(account)
-
-	return keychain.DeleteItem(item)
+func NewMacOSKeychainBackend() *MacOSKeychainBackend {
+	return &MacOSKeychainBackend{}
 }
 
-func (b *MacOSKeychainBackend) Initialize(config map[string]string) error {
+func (b *MacOSKeychainBackend) Initialize(ctx context.Context, config map[string]string) error {
 	// No initialization needed for macOS Keychain
 	return nil
 }
 
 // GetSecret retrieves a secret by its key
-func (b *MacOSKeychainBackend) GetSecret(key string) (string, error) {
+func (b *MacOSKeychainBackend) GetSecret(ctx context.Context, key string) (string, error) {
 	if key == "" {
 		return "", nil
 	}
+	// Keychain queries can't be interrupted, so only check before starting one
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	secret, err := b.Get("imbued", key)
 	if err != nil {
 		return "", err
@@ -75,8 +38,11 @@ func (b *MacOSKeychainBackend) GetSecret(key string) (string, error) {
 	return secret, nil
 }
 
-func (b *MacOSKeychainBackend) StoreSecrets(secrets map[string]string) error {
+func (b *MacOSKeychainBackend) StoreSecrets(ctx context.Context, secrets map[string]string) error {
 	for key, value := range secrets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if err := b.Set("imbued", key, value); err != nil {
 			return err
 		}
@@ -0,0 +1,57 @@
+//go:build darwin
+
+package secrets
+
+import (
+	"fmt"
+
+	"github.com/keybase/go-keychain"
+)
+
+// Get retrieves a secret from the macOS keychain.
+func (b *MacOSKeychainBackend) Get(service, account string) (string, error) {
+	query := keychain.NewItem()
+	query.SetSecClass(keychain.SecClassGenericPassword)
+	query.SetService(service)
+	query.SetAccount(account)
+	query.SetMatchLimit(keychain.MatchLimitOne)
+	query.SetReturnData(true)
+
+	results, err := keychain.QueryItem(query)
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "", fmt.Errorf("%w: service=%s, account=%s", ErrSecretNotFound, service, account)
+	}
+
+	return string(results[0].Data), nil
+}
+
+// Set stores a secret in the macOS keychain.
+func (b *MacOSKeychainBackend) Set(service, account, secret string) error {
+	item := keychain.NewItem()
+	item.SetSecClass(keychain.SecClassGenericPassword)
+	item.SetService(service)
+	item.SetAccount(account)
+	item.SetData([]byte(secret))
+	item.SetAccessible(keychain.AccessibleWhenUnlocked)
+
+	// Add or update the item in the keychain
+	err := keychain.AddItem(item)
+	if err == keychain.ErrorDuplicateItem {
+		// Update the existing item
+		return keychain.UpdateItem(item, item)
+	}
+	return err
+}
+
+// Delete removes a secret from the macOS keychain.
+func (b *MacOSKeychainBackend) Delete(service, account string) error {
+	item := keychain.NewItem()
+	item.SetSecClass(keychain.SecClassGenericPassword)
+	item.SetService(service)
+	item.SetAccount(account)
+
+	return keychain.DeleteItem(item)
+}
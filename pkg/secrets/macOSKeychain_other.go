@@ -0,0 +1,23 @@
+//go:build !darwin
+
+package secrets
+
+import "errors"
+
+// errNoKeychain is returned by the keychain calls on platforms other than macOS
+var errNoKeychain = errors.New("the macOS keychain is only available on macOS")
+
+// Get fails, as there's no macOS keychain on this platform
+func (b *MacOSKeychainBackend) Get(service, account string) (string, error) {
+	return "", errNoKeychain
+}
+
+// Set fails, as there's no macOS keychain on this platform
+func (b *MacOSKeychainBackend) Set(service, account, secret string) error {
+	return errNoKeychain
+}
+
+// Delete fails, as there's no macOS keychain on this platform
+func (b *MacOSKeychainBackend) Delete(service, account string) error {
+	return errNoKeychain
+}
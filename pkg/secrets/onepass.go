@@ -2,7 +2,11 @@ package secrets
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -20,6 +24,12 @@ const (
 	KeychainVaultIDKey = "vault_id"
 )
 
+// onePassDefaultField is the item field returned by GetSecret
+const onePassDefaultField = "password"
+
+// ErrKeychainItemNotFound is returned by GetKeychainItem when no matching item exists
+var ErrKeychainItemNotFound = errors.New("keychain item not found")
+
 // OnePassBackend implements the Backend interface for 1Password
 type OnePassBackend struct {
 	accountToken string
@@ -27,10 +37,15 @@ type OnePassBackend struct {
 	initialized  bool
 }
 
+// The 1Password credentials are read from the keychain rather than the config
+func init() {
+	RegisterBackendOptions(OnePass)
+}
+
 // Initialize initializes the OnePassBackend with the given configuration
-func (b *OnePassBackend) Initialize(config map[string]string) error {
+func (b *OnePassBackend) Initialize(ctx context.Context, config map[string]string) error {
 	// Verify that the 1Password CLI is installed and working
-	if err := b.verifyCliInstallation(); err != nil {
+	if err := b.verifyCliInstallation(ctx); err != nil {
 		return fmt.Errorf("1Password CLI verification failed: %w", err)
 	}
 
@@ -61,7 +76,7 @@ func GetKeychainItem(service, account string) (string, error) {
 
 	if err := cmd.Run(); err != nil {
 		if strings.Contains(stderr.String(), "could not be found") {
-			return "", fmt.Errorf("keychain item not found: service=%s, account=%s", service, account)
+			return "", fmt.Errorf("%w: service=%s, account=%s", ErrKeychainItemNotFound, service, account)
 		}
 		return "", fmt.Errorf("failed to get keychain item: %w, stderr: %s", err, stderr.String())
 	}
@@ -70,8 +85,8 @@ func GetKeychainItem(service, account string) (string, error) {
 }
 
 // verifyCliInstallation checks if the 1Password CLI is installed and working
-func (b *OnePassBackend) verifyCliInstallation() error {
-	cmd := exec.Command("op", "--version")
+func (b *OnePassBackend) verifyCliInstallation(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "op", "--version")
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
@@ -84,13 +99,19 @@ func (b *OnePassBackend) verifyCliInstallation() error {
 }
 
 // GetSecret retrieves a secret by its key
-func (b *OnePassBackend) GetSecret(key string) (string, error) {
+func (b *OnePassBackend) GetSecret(ctx context.Context, key string) (string, error) {
+	return b.GetSecretField(ctx, key, onePassDefaultField)
+}
+
+// GetSecretField retrieves the field with the given label from an item
+func (b *OnePassBackend) GetSecretField(ctx context.Context, key, field string) (string, error) {
 	if !b.initialized {
 		return "", fmt.Errorf("onepass backend not initialized")
 	}
 
 	// Set the 1Password account token as an environment variable
-	cmd := exec.Command("op", "item", "get", key, "--vault", b.vaultID, "--format", "json")
+	vault, item := b.item(key)
+	cmd := exec.CommandContext(ctx, "op", "item", "get", item, "--vault", vault, "--format", "json")
 	cmd.Env = append(os.Environ(), fmt.Sprintf("OP_SERVICE_ACCOUNT_TOKEN=%s", b.accountToken))
 
 	var stdout, stderr bytes.Buffer
@@ -100,7 +121,7 @@ func (b *OnePassBackend) GetSecret(key string) (string, error) {
 	if err := cmd.Run(); err != nil {
 		// Check if the error is due to item not found
 		if strings.Contains(stderr.String(), "not found") {
-			return "", fmt.Errorf("secret not found: %s", key)
+			return "", fmt.Errorf("%w: %s", ErrSecretNotFound, key)
 		}
 		return "", fmt.Errorf("failed to get secret from 1Password: %w, stderr: %s",
 			err, stderr.String())
@@ -120,38 +141,127 @@ func (b *OnePassBackend) GetSecret(key string) (string, error) {
 		return "", fmt.Errorf("unexpected response format from 1Password")
 	}
 
-	// Look for the password field
-	for _, field := range fields {
-		fieldMap, ok := field.(map[string]interface{})
+	// Look for the requested field
+	for _, itemField := range fields {
+		fieldMap, ok := itemField.(map[string]interface{})
 		if !ok {
 			continue
 		}
 
-		// Check if this is the password field
-		if label, ok := fieldMap["label"].(string); ok && label == "password" {
+		// Check if this is the requested field
+		if label, ok := fieldMap["label"].(string); ok && label == field {
 			if value, ok := fieldMap["value"].(string); ok {
 				return value, nil
 			}
 		}
 	}
 
-	return "", fmt.Errorf("password field not found in 1Password item: %s", key)
+	return "", fmt.Errorf("%s field not found in 1Password item: %s", field, key)
 }
 
-func (b *OnePassBackend) StoreSecrets(secrets map[string]string) error {
+// GetSecrets retrieves several secrets with a single `op inject` call. The
+// password field of each item is rendered into a template, separated by a
+// random boundary line so that multi-line values survive the round trip. If
+// the batch call fails (for example because one of the items is missing) each
+// key is fetched individually so that errors are reported per key.
+func (b *OnePassBackend) GetSecrets(ctx context.Context, keys []string) (map[string]string, map[string]error) {
+	values := make(map[string]string, len(keys))
+	errs := make(map[string]error)
+	if !b.initialized {
+		for _, key := range keys {
+			errs[key] = fmt.Errorf("onepass backend not initialized")
+		}
+		return values, errs
+	}
+
+	// Keys that can't be expressed as a secret reference are fetched one by one
+	var batched, single []string
+	for _, key := range keys {
+		if strings.ContainsAny(key, "/{}\n") {
+			single = append(single, key)
+		} else {
+			batched = append(batched, key)
+		}
+	}
+
+	if len(batched) > 0 {
+		injected, err := b.injectSecrets(ctx, batched)
+		if err != nil {
+			single = append(single, batched...)
+		} else {
+			for key, value := range injected {
+				values[key] = value
+			}
+		}
+	}
+
+	for _, key := range single {
+		value, err := b.GetSecret(ctx, key)
+		if err != nil {
+			errs[key] = err
+			continue
+		}
+		values[key] = value
+	}
+
+	return values, errs
+}
+
+// injectSecrets resolves the password field of the given items using `op inject`
+func (b *OnePassBackend) injectSecrets(ctx context.Context, keys []string) (map[string]string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate template boundary: %w", err)
+	}
+	boundary := fmt.Sprintf("--imbued-%s--", hex.EncodeToString(nonce))
+
+	var template strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&template, "%s\n{{ op://%s/%s/%s }}\n", boundary, b.vaultID, key, onePassDefaultField)
+	}
+	fmt.Fprintf(&template, "%s\n", boundary)
+
+	cmd := exec.CommandContext(ctx, "op", "inject")
+	cmd.Env = append(os.Environ(), fmt.Sprintf("OP_SERVICE_ACCOUNT_TOKEN=%s", b.accountToken))
+	cmd.Stdin = strings.NewReader(template.String())
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to inject secrets from 1Password: %w, stderr: %s",
+			err, stderr.String())
+	}
+
+	// The output is the boundary followed by one section per key, in order
+	sections := strings.Split(stdout.String(), boundary+"\n")
+	if len(sections) != len(keys)+2 || sections[0] != "" || sections[len(sections)-1] != "" {
+		return nil, fmt.Errorf("unexpected output from 1Password inject")
+	}
+
+	values := make(map[string]string, len(keys))
+	for i, key := range keys {
+		values[key] = strings.TrimSuffix(sections[i+1], "\n")
+	}
+	return values, nil
+}
+
+func (b *OnePassBackend) StoreSecrets(ctx context.Context, secrets map[string]string) error {
 	if !b.initialized {
 		return fmt.Errorf("onepass backend not initialized")
 	}
 
 	for key, value := range secrets {
 		// Check if the secret already exists
-		_, err := b.GetSecret(key)
+		_, err := b.GetSecret(ctx, key)
 		if err == nil {
 			return fmt.Errorf("secret with key %s already exists", key)
 		}
 
 		// Store the secret in 1Password
-		cmd := exec.Command("op", "item", "create", "--vault", b.vaultID, "--category", "password", "--title", key, fmt.Sprintf("password=%s", value))
+		vault, item := b.item(key)
+		cmd := exec.CommandContext(ctx, "op", "item", "create", "--vault", vault, "--category", "password", "--title", item, fmt.Sprintf("password=%s", value))
 		cmd.Env = append(os.Environ(), fmt.Sprintf("OP_SERVICE_ACCOUNT_TOKEN=%s", b.accountToken))
 
 		var stderr bytes.Buffer
@@ -165,6 +275,15 @@ func (b *OnePassBackend) StoreSecrets(secrets map[string]string) error {
 	return fmt.Errorf("storing secrets in 1Password is not implemented")
 }
 
+// item returns the vault and the title of the item a key refers to. Keys
+// are item titles in the backend's vault, or vault/item to read another one.
+func (b *OnePassBackend) item(key string) (string, string) {
+	if vault, item, ok := strings.Cut(key, "/"); ok {
+		return vault, item
+	}
+	return b.vaultID, key
+}
+
 // Close cleans up any resources used by the backend
 func (b *OnePassBackend) Close() error {
 	b.initialized = false
@@ -174,20 +293,20 @@ func (b *OnePassBackend) Close() error {
 // StoreOnePassCredentials stores 1Password credentials in the macOS Keychain
 func StoreOnePassCredentials(accountToken, vaultID string) error {
 	// Store account token
-	if err := storeKeychainItem(KeychainServiceName, KeychainAccountTokenKey, accountToken); err != nil {
+	if err := StoreKeychainItem(KeychainServiceName, KeychainAccountTokenKey, accountToken); err != nil {
 		return fmt.Errorf("failed to store account token in keychain: %w", err)
 	}
 
 	// Store vault ID
-	if err := storeKeychainItem(KeychainServiceName, KeychainVaultIDKey, vaultID); err != nil {
+	if err := StoreKeychainItem(KeychainServiceName, KeychainVaultIDKey, vaultID); err != nil {
 		return fmt.Errorf("failed to store vault ID in keychain: %w", err)
 	}
 
 	return nil
 }
 
-// storeKeychainItem stores an item in the macOS Keychain
-func storeKeychainItem(service, account, password string) error {
+// StoreKeychainItem stores an item in the macOS Keychain, replacing any existing item
+func StoreKeychainItem(service, account, password string) error {
 	// First, try to delete any existing item
 	deleteCmd := exec.Command("security", "delete-generic-password", "-s", service, "-a", account)
 	// Ignore errors from delete command, as the item might not exist
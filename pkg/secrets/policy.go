@@ -0,0 +1,339 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when a backend's circuit breaker is open and
+// calls are rejected without reaching the backend
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// Policy controls how calls to a backend are bounded and retried
+type Policy struct {
+	// Timeout bounds each individual call to the backend (0 disables it)
+	Timeout time.Duration
+	// Retries is the number of times a failed call is retried
+	Retries int
+	// Backoff is the base delay between retries, doubled on every attempt and jittered
+	Backoff time.Duration
+	// BreakerThreshold is the number of consecutive failures that opens the circuit breaker (0 disables it)
+	BreakerThreshold int
+	// BreakerCooldown is how long the circuit breaker stays open before letting a trial call through
+	BreakerCooldown time.Duration
+}
+
+const (
+	// MaxRetries is the highest number of retries a policy may set
+	MaxRetries = 10
+	// MaxBackoff bounds the delay between retries, before jitter
+	MaxBackoff = 30 * time.Second
+)
+
+// DefaultPolicy is the policy of backends when neither their config nor the
+// global config sets one
+var DefaultPolicy = Policy{
+	Timeout:          30 * time.Second,
+	Retries:          2,
+	Backoff:          250 * time.Millisecond,
+	BreakerThreshold: 5,
+	BreakerCooldown:  30 * time.Second,
+}
+
+// backoff returns the jittered delay before the given retry attempt (starting at 1)
+func (p Policy) backoff(attempt int) time.Duration {
+	if p.Backoff <= 0 {
+		return 0
+	}
+
+	// Doubled on every attempt, up to MaxBackoff
+	delay := p.Backoff
+	for i := 1; i < attempt && delay < MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > MaxBackoff {
+		delay = MaxBackoff
+	}
+
+	// Full jitter between half and one and a half times the delay
+	return delay/2 + time.Duration(rand.Int64N(int64(delay)+1))
+}
+
+// BreakerState is the state of a circuit breaker
+type BreakerState string
+
+const (
+	// BreakerClosed lets every call through
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen rejects every call until the cooldown has elapsed
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen lets a single trial call through
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// BreakerStatus is a snapshot of a circuit breaker's state
+type BreakerStatus struct {
+	State     BreakerState
+	Failures  int
+	OpenUntil time.Time
+	LastError string
+}
+
+// Breaker is a circuit breaker that fails fast after repeated backend
+// failures. A Breaker is safe for concurrent use.
+type Breaker struct {
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	openUntil time.Time
+	probing   bool
+	lastError string
+}
+
+// NewBreaker creates a new closed Breaker
+func NewBreaker() *Breaker {
+	return &Breaker{state: BreakerClosed}
+}
+
+// Allow reports whether a call may go through under the given policy
+func (b *Breaker) Allow(policy Policy) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Now().Before(b.openUntil) {
+			return fmt.Errorf("%w until %s: %s", ErrCircuitOpen, b.openUntil.Format(time.TimeOnly), b.lastError)
+		}
+		b.state = BreakerHalfOpen
+		b.probing = false
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probing {
+			return fmt.Errorf("%w: waiting for trial call", ErrCircuitOpen)
+		}
+		b.probing = true
+	}
+
+	return nil
+}
+
+// Success records a successful call, closing the breaker
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure records a failed call, opening the breaker once the policy's threshold is reached
+func (b *Breaker) Failure(policy Policy, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	b.lastError = err.Error()
+	if policy.BreakerThreshold > 0 && (b.state == BreakerHalfOpen || b.failures >= policy.BreakerThreshold) {
+		b.state = BreakerOpen
+		b.openUntil = time.Now().Add(policy.BreakerCooldown)
+	}
+}
+
+// Status returns a snapshot of the breaker's state
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return BreakerStatus{
+		State:     b.state,
+		Failures:  b.failures,
+		OpenUntil: b.openUntil,
+		LastError: b.lastError,
+	}
+}
+
+// isRetryable reports whether a failed call may succeed if retried
+func isRetryable(err error) bool {
+	return !errors.Is(err, ErrSecretNotFound) && !errors.Is(err, ErrCircuitOpen)
+}
+
+// callWithPolicy runs fn with the policy's timeout, retries and circuit breaker
+func callWithPolicy(ctx context.Context, policy Policy, breaker *Breaker, fn func(ctx context.Context) error) error {
+	var err error
+	for attempt := 0; attempt <= policy.Retries; attempt++ {
+		if attempt > 0 {
+			if err := sleepContext(ctx, policy.backoff(attempt)); err != nil {
+				return err
+			}
+		}
+
+		if err := breaker.Allow(policy); err != nil {
+			return err
+		}
+
+		callCtx, cancel := withTimeout(ctx, policy.Timeout)
+		err = fn(callCtx)
+		cancel()
+
+		if err == nil || errors.Is(err, ErrSecretNotFound) {
+			// A missing secret is a healthy answer from the backend
+			breaker.Success()
+			return err
+		}
+
+		breaker.Failure(policy, err)
+		if !isRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// withTimeout returns a context bounded by timeout, or ctx itself if timeout is not positive
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// sleepContext waits for the given duration or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// policyBackend wraps a backend so that every call goes through a policy
+type policyBackend struct {
+	backend Backend
+	policy  Policy
+	breaker *Breaker
+}
+
+// Initialize initializes the wrapped backend
+func (b *policyBackend) Initialize(ctx context.Context, config map[string]string) error {
+	return callWithPolicy(ctx, b.policy, b.breaker, func(ctx context.Context) error {
+		return b.backend.Initialize(ctx, config)
+	})
+}
+
+// GetSecret retrieves a secret from the wrapped backend
+func (b *policyBackend) GetSecret(ctx context.Context, key string) (string, error) {
+	var value string
+	err := callWithPolicy(ctx, b.policy, b.breaker, func(ctx context.Context) error {
+		var err error
+		value, err = b.backend.GetSecret(ctx, key)
+		return err
+	})
+	return value, err
+}
+
+// GetSecretField retrieves a field of a secret from the wrapped backend
+func (b *policyBackend) GetSecretField(ctx context.Context, key, field string) (string, error) {
+	if _, ok := b.backend.(FieldGetter); !ok {
+		return "", fmt.Errorf("backend does not support secret fields")
+	}
+
+	var value string
+	err := callWithPolicy(ctx, b.policy, b.breaker, func(ctx context.Context) error {
+		var err error
+		value, err = GetSecretField(ctx, b.backend, key, field)
+		return err
+	})
+	return value, err
+}
+
+// GetSecrets retrieves several secrets from the wrapped backend. Batches are
+// retried for the keys that failed with a retryable error only.
+func (b *policyBackend) GetSecrets(ctx context.Context, keys []string) (map[string]string, map[string]error) {
+	batcher, ok := b.backend.(BatchGetter)
+	if !ok {
+		return getSecretsParallel(ctx, b.GetSecret, keys, DefaultBatchParallelism)
+	}
+
+	values := make(map[string]string, len(keys))
+	errs := make(map[string]error)
+	remaining := keys
+	for attempt := 0; attempt <= b.policy.Retries && len(remaining) > 0; attempt++ {
+		if attempt > 0 {
+			if err := sleepContext(ctx, b.policy.backoff(attempt)); err != nil {
+				break
+			}
+		}
+
+		if err := b.breaker.Allow(b.policy); err != nil {
+			for _, key := range remaining {
+				errs[key] = err
+			}
+			break
+		}
+
+		callCtx, cancel := withTimeout(ctx, b.policy.Timeout)
+		fetched, fetchErrs := batcher.GetSecrets(callCtx, remaining)
+		cancel()
+
+		var retry []string
+		var lastErr error
+		for _, key := range remaining {
+			if value, ok := fetched[key]; ok {
+				values[key] = value
+				delete(errs, key)
+				continue
+			}
+
+			err := fetchErrs[key]
+			if err == nil {
+				err = fmt.Errorf("no value returned for %s", key)
+			}
+			errs[key] = err
+			if isRetryable(err) {
+				retry = append(retry, key)
+				lastErr = err
+			}
+		}
+
+		// The batch only counts as a failure if the backend answered nothing at all
+		if len(retry) == len(remaining) {
+			b.breaker.Failure(b.policy, lastErr)
+		} else {
+			b.breaker.Success()
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+		remaining = retry
+	}
+
+	return values, errs
+}
+
+// StoreSecrets stores secrets in the wrapped backend. Stores are not retried,
+// since a partially applied store may not be safe to repeat.
+func (b *policyBackend) StoreSecrets(ctx context.Context, secrets map[string]string) error {
+	policy := b.policy
+	policy.Retries = 0
+	return callWithPolicy(ctx, policy, b.breaker, func(ctx context.Context) error {
+		return b.backend.StoreSecrets(ctx, secrets)
+	})
+}
+
+// Close closes the wrapped backend
+func (b *policyBackend) Close() error {
+	return b.backend.Close()
+}
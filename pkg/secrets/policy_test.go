@@ -0,0 +1,287 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff time.Duration
+		attempt int
+		delay   time.Duration // Delay before jitter
+	}{
+		{"disabled", 0, 3, 0},
+		{"first retry", 250 * time.Millisecond, 1, 250 * time.Millisecond},
+		{"doubled", 250 * time.Millisecond, 3, time.Second},
+		{"capped", 250 * time.Millisecond, 10, MaxBackoff},
+		{"no overflow", 250 * time.Millisecond, 100, MaxBackoff},
+		{"base above the cap", time.Hour, 1, MaxBackoff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := Policy{Backoff: tt.backoff}
+			for i := 0; i < 100; i++ {
+				got := policy.backoff(tt.attempt)
+				if got < tt.delay/2 || got > tt.delay/2*3 {
+					t.Fatalf("backoff(%d) = %s, want between %s and %s", tt.attempt, got, tt.delay/2, tt.delay/2*3)
+				}
+			}
+		})
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	type step struct {
+		op      string // "allow", "success" or "failure"
+		blocked bool   // Whether allow is expected to reject the call
+	}
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		steps    []step
+		state    BreakerState
+		failures int
+	}{
+		{
+			name:     "below threshold",
+			policy:   Policy{BreakerThreshold: 2, BreakerCooldown: time.Hour},
+			steps:    []step{{op: "failure"}, {op: "allow"}},
+			state:    BreakerClosed,
+			failures: 1,
+		},
+		{
+			name:     "opens at threshold",
+			policy:   Policy{BreakerThreshold: 2, BreakerCooldown: time.Hour},
+			steps:    []step{{op: "failure"}, {op: "failure"}, {op: "allow", blocked: true}},
+			state:    BreakerOpen,
+			failures: 2,
+		},
+		{
+			name:     "success resets failures",
+			policy:   Policy{BreakerThreshold: 2, BreakerCooldown: time.Hour},
+			steps:    []step{{op: "failure"}, {op: "success"}, {op: "failure"}, {op: "allow"}},
+			state:    BreakerClosed,
+			failures: 1,
+		},
+		{
+			name:     "disabled",
+			policy:   Policy{BreakerCooldown: time.Hour},
+			steps:    []step{{op: "failure"}, {op: "failure"}, {op: "failure"}, {op: "allow"}},
+			state:    BreakerClosed,
+			failures: 3,
+		},
+		{
+			name:     "single trial after cooldown",
+			policy:   Policy{BreakerThreshold: 1},
+			steps:    []step{{op: "failure"}, {op: "allow"}, {op: "allow", blocked: true}},
+			state:    BreakerHalfOpen,
+			failures: 1,
+		},
+		{
+			name:     "successful trial closes",
+			policy:   Policy{BreakerThreshold: 1},
+			steps:    []step{{op: "failure"}, {op: "allow"}, {op: "success"}, {op: "allow"}},
+			state:    BreakerClosed,
+			failures: 0,
+		},
+		{
+			name:     "failed trial reopens",
+			policy:   Policy{BreakerThreshold: 3},
+			steps:    []step{{op: "failure"}, {op: "failure"}, {op: "failure"}, {op: "allow"}, {op: "failure"}},
+			state:    BreakerOpen,
+			failures: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker := NewBreaker()
+			for i, s := range tt.steps {
+				switch s.op {
+				case "allow":
+					err := breaker.Allow(tt.policy)
+					if s.blocked && !errors.Is(err, ErrCircuitOpen) {
+						t.Fatalf("step %d: Allow() = %v, want %v", i, err, ErrCircuitOpen)
+					}
+					if !s.blocked && err != nil {
+						t.Fatalf("step %d: Allow() = %v, want nil", i, err)
+					}
+				case "success":
+					breaker.Success()
+				case "failure":
+					breaker.Failure(tt.policy, errors.New("connection refused"))
+				}
+			}
+
+			status := breaker.Status()
+			if status.State != tt.state || status.Failures != tt.failures {
+				t.Errorf("Status() = %s with %d failures, want %s with %d", status.State, status.Failures, tt.state, tt.failures)
+			}
+		})
+	}
+}
+
+// batchBackend is a backend answering batches from a script, one response
+// per call, the last one repeating
+type batchBackend struct {
+	// Error of each key a response doesn't return a value for. A nil error
+	// returns neither a value nor an error.
+	responses []map[string]error
+	calls     [][]string
+}
+
+func (b *batchBackend) Initialize(ctx context.Context, config map[string]string) error {
+	return nil
+}
+
+func (b *batchBackend) GetSecret(ctx context.Context, key string) (string, error) {
+	return "", errors.New("not supported")
+}
+
+func (b *batchBackend) GetSecrets(ctx context.Context, keys []string) (map[string]string, map[string]error) {
+	response := b.responses[min(len(b.calls), len(b.responses)-1)]
+	b.calls = append(b.calls, keys)
+
+	values := make(map[string]string)
+	errs := make(map[string]error)
+	for _, key := range keys {
+		err, failed := response[key]
+		if !failed {
+			values[key] = "value of " + key
+		} else if err != nil {
+			errs[key] = err
+		}
+	}
+	return values, errs
+}
+
+func (b *batchBackend) StoreSecrets(ctx context.Context, secrets map[string]string) error {
+	return nil
+}
+
+func (b *batchBackend) Close() error {
+	return nil
+}
+
+func TestPolicyBackendGetSecrets(t *testing.T) {
+	errUnavailable := errors.New("service unavailable")
+
+	tests := []struct {
+		name      string
+		policy    Policy
+		keys      []string
+		responses []map[string]error
+		calls     [][]string
+		values    []string
+		errs      map[string]error
+		state     BreakerState
+	}{
+		{
+			name:      "retries failed keys only",
+			policy:    Policy{Retries: 2},
+			keys:      []string{"a", "b", "c"},
+			responses: []map[string]error{{"b": errUnavailable, "c": ErrSecretNotFound}, {}},
+			calls:     [][]string{{"a", "b", "c"}, {"b"}},
+			values:    []string{"a", "b"},
+			errs:      map[string]error{"c": ErrSecretNotFound},
+			state:     BreakerClosed,
+		},
+		{
+			name:      "keys without an answer are retried",
+			policy:    Policy{Retries: 1},
+			keys:      []string{"a", "b"},
+			responses: []map[string]error{{"b": nil}, {}},
+			calls:     [][]string{{"a", "b"}, {"b"}},
+			values:    []string{"a", "b"},
+			errs:      map[string]error{},
+			state:     BreakerClosed,
+		},
+		{
+			name:      "gives up after the retries",
+			policy:    Policy{Retries: 2},
+			keys:      []string{"a", "b"},
+			responses: []map[string]error{{"b": errUnavailable}},
+			calls:     [][]string{{"a", "b"}, {"b"}, {"b"}},
+			values:    []string{"a"},
+			errs:      map[string]error{"b": errUnavailable},
+			state:     BreakerClosed,
+		},
+		{
+			name:      "missing secrets aren't retried",
+			policy:    Policy{Retries: 2},
+			keys:      []string{"a"},
+			responses: []map[string]error{{"a": ErrSecretNotFound}},
+			calls:     [][]string{{"a"}},
+			errs:      map[string]error{"a": ErrSecretNotFound},
+			state:     BreakerClosed,
+		},
+		{
+			name:      "no retries",
+			policy:    Policy{},
+			keys:      []string{"a"},
+			responses: []map[string]error{{"a": errUnavailable}},
+			calls:     [][]string{{"a"}},
+			errs:      map[string]error{"a": errUnavailable},
+			state:     BreakerClosed,
+		},
+		{
+			name:      "failed batch opens the breaker",
+			policy:    Policy{Retries: 2, BreakerThreshold: 1, BreakerCooldown: time.Hour},
+			keys:      []string{"a", "b"},
+			responses: []map[string]error{{"a": errUnavailable, "b": errUnavailable}},
+			calls:     [][]string{{"a", "b"}},
+			errs:      map[string]error{"a": ErrCircuitOpen, "b": ErrCircuitOpen},
+			state:     BreakerOpen,
+		},
+		{
+			name:      "partial answer keeps the breaker closed",
+			policy:    Policy{Retries: 1, BreakerThreshold: 1, BreakerCooldown: time.Hour},
+			keys:      []string{"a", "b"},
+			responses: []map[string]error{{"b": errUnavailable}, {}},
+			calls:     [][]string{{"a", "b"}, {"b"}},
+			values:    []string{"a", "b"},
+			errs:      map[string]error{},
+			state:     BreakerClosed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &batchBackend{responses: tt.responses}
+			tt.policy.Backoff = time.Millisecond
+			b := &policyBackend{backend: backend, policy: tt.policy, breaker: NewBreaker()}
+
+			values, errs := b.GetSecrets(context.Background(), tt.keys)
+
+			if !reflect.DeepEqual(backend.calls, tt.calls) {
+				t.Errorf("GetSecrets() calls = %q, want %q", backend.calls, tt.calls)
+			}
+			if len(values) != len(tt.values) {
+				t.Errorf("GetSecrets() values = %q, want %q", values, tt.values)
+			}
+			for _, key := range tt.values {
+				if values[key] != "value of "+key {
+					t.Errorf("GetSecrets() value of %s = %q", key, values[key])
+				}
+			}
+			if len(errs) != len(tt.errs) {
+				t.Errorf("GetSecrets() errors = %v, want %v", errs, tt.errs)
+			}
+			for key, want := range tt.errs {
+				if !errors.Is(errs[key], want) {
+					t.Errorf("GetSecrets() error of %s = %v, want %v", key, errs[key], want)
+				}
+			}
+			if state := b.breaker.Status().State; state != tt.state {
+				t.Errorf("breaker state = %s, want %s", state, tt.state)
+			}
+		})
+	}
+}
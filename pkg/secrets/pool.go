@@ -0,0 +1,377 @@
+package secrets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pool keeps initialized backends alive between daemon requests, so that
+// backends with expensive setup (parsing a file, probing a CLI) only pay for
+// it once. Entries are keyed by config path and a hash of the backend
+// configuration, with its references resolved, and are invalidated when the
+// modification time of the config file or of a file the backend reads
+// changes, or when they have been idle for longer than the idle timeout.
+// References are resolved once per configuration and config modification
+// time, so a credential changed in the keychain is picked up once the
+// config changes or the pool is invalidated. Every call to a pooled backend
+// goes through the caller's Policy, with a circuit breaker per backend that
+// outlives failed initializations, and is dropped once the backend is gone
+// and idle. A Pool is safe for concurrent use.
+type Pool struct {
+	mu          sync.Mutex
+	entries     map[string]*poolEntry
+	resolved    map[string]*resolvedConfig // Keyed by the pool key of the unresolved configuration
+	breakers    map[string]*Breaker
+	breakerUsed map[string]time.Time // Last time each breaker was acquired
+	idleTimeout time.Duration
+	done        chan struct{}
+}
+
+// poolEntry is a single initialized backend in the pool
+type poolEntry struct {
+	key       string
+	backend   Backend
+	err       error
+	ready     chan struct{}
+	modTime   time.Time
+	fileTimes map[string]time.Time // Modification times of the files the backend reads
+	lastUsed  time.Time
+	refs      int
+	evicted   bool
+}
+
+// resolvedConfig is a backend configuration with its references resolved
+type resolvedConfig struct {
+	modTime time.Time // Modification time of the config file when resolved
+	config  map[string]string
+	key     string // Pool key of the resolved configuration
+}
+
+// NewPool creates a new Pool that closes backends idle for longer than idleTimeout
+func NewPool(idleTimeout time.Duration) *Pool {
+	p := &Pool{
+		entries:     make(map[string]*poolEntry),
+		resolved:    make(map[string]*resolvedConfig),
+		breakers:    make(map[string]*Breaker),
+		breakerUsed: make(map[string]time.Time),
+		idleTimeout: idleTimeout,
+		done:        make(chan struct{}),
+	}
+
+	if idleTimeout > 0 {
+		go p.janitor()
+	}
+
+	return p
+}
+
+// Acquire returns an initialized backend for the given config, wrapped so
+// that every call follows the policy. source is the file the backend's
+// options were read from, which their references are scoped to. The
+// returned release function must be called once the caller is done with
+// the backend.
+func (p *Pool) Acquire(ctx context.Context, configPath, source, backendType string, backendConfig map[string]string, policy Policy) (Backend, func(), error) {
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stat config file: %w", err)
+	}
+
+	// Credentials may be kept in the keychain rather than in the config. They
+	// are part of the key, so that changing one starts a new backend.
+	resolved, err := p.resolve(configPath, source, backendType, backendConfig, info.ModTime())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve backend config: %w", err)
+	}
+	backendConfig, key := resolved.config, resolved.key
+	fileTimes := optionFileTimes(backendType, backendConfig)
+	now := time.Now()
+
+	p.mu.Lock()
+	breaker := p.breakerLocked(key)
+	entry, ok := p.entries[key]
+	if ok && (!entry.modTime.Equal(info.ModTime()) || !maps.EqualFunc(entry.fileTimes, fileTimes, time.Time.Equal)) {
+		// The config, or a file the backend read, changed since this backend
+		// was initialized
+		p.evictLocked(entry)
+		ok = false
+	}
+	if !ok {
+		entry = &poolEntry{
+			key:       key,
+			ready:     make(chan struct{}),
+			modTime:   info.ModTime(),
+			fileTimes: fileTimes,
+		}
+		p.entries[key] = entry
+		entry.refs++
+		entry.lastUsed = now
+		p.mu.Unlock()
+
+		entry.backend, entry.err = initBackend(ctx, backendType, backendConfig, policy, breaker)
+		close(entry.ready)
+	} else {
+		entry.refs++
+		entry.lastUsed = now
+		p.mu.Unlock()
+
+		<-entry.ready
+	}
+
+	release := func() { p.release(entry) }
+	if entry.err != nil {
+		p.mu.Lock()
+		p.evictLocked(entry)
+		p.mu.Unlock()
+		release()
+		return nil, nil, entry.err
+	}
+
+	return &policyBackend{backend: entry.backend, policy: policy, breaker: breaker}, release, nil
+}
+
+// Status returns the circuit breaker status of the backend for the given
+// config. Backends that were never acquired report a closed breaker.
+// References aren't resolved again, the status is the one of the backend
+// last acquired for the configuration.
+func (p *Pool) Status(configPath, source, backendType string, backendConfig map[string]string) BreakerStatus {
+	closed := BreakerStatus{State: BreakerClosed}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	resolved, ok := p.resolved[poolKey(configPath, source, backendType, backendConfig)]
+	if !ok {
+		return closed
+	}
+	breaker, ok := p.breakers[resolved.key]
+	if !ok {
+		return closed
+	}
+	return breaker.Status()
+}
+
+// resolve returns the backend configuration with its references resolved,
+// resolving them again only if the config changed since the last time
+func (p *Pool) resolve(configPath, source, backendType string, backendConfig map[string]string, modTime time.Time) (*resolvedConfig, error) {
+	key := poolKey(configPath, source, backendType, backendConfig)
+
+	p.mu.Lock()
+	resolved, ok := p.resolved[key]
+	p.mu.Unlock()
+	if ok && resolved.modTime.Equal(modTime) {
+		return resolved, nil
+	}
+
+	// The keychain may prompt, so it isn't read while holding p.mu
+	config, err := ResolveReferences(backendConfig, source)
+	if err != nil {
+		return nil, err
+	}
+	resolved = &resolvedConfig{
+		modTime: modTime,
+		config:  config,
+		key:     poolKey(configPath, source, backendType, config),
+	}
+
+	p.mu.Lock()
+	p.resolved[key] = resolved
+	p.mu.Unlock()
+
+	return resolved, nil
+}
+
+// breakerLocked returns the circuit breaker for a pool key, creating it if
+// needed. The caller must hold p.mu.
+func (p *Pool) breakerLocked(key string) *Breaker {
+	breaker, ok := p.breakers[key]
+	if !ok {
+		breaker = NewBreaker()
+		p.breakers[key] = breaker
+	}
+	p.breakerUsed[key] = time.Now()
+	return breaker
+}
+
+// Invalidate closes and removes every backend initialized for the given
+// config path, or for every config if configPath is empty, along with their
+// circuit breakers and resolved references
+func (p *Pool) Invalidate(configPath string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	prefix := configPath + "#"
+	matches := func(key string) bool {
+		return configPath == "" || strings.HasPrefix(key, prefix)
+	}
+	for key, entry := range p.entries {
+		if matches(key) {
+			p.evictLocked(entry)
+		}
+	}
+	for key := range p.resolved {
+		if matches(key) {
+			delete(p.resolved, key)
+		}
+	}
+	for key := range p.breakers {
+		if matches(key) {
+			delete(p.breakers, key)
+			delete(p.breakerUsed, key)
+		}
+	}
+}
+
+// Close closes every backend in the pool and stops the idle janitor
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	select {
+	case <-p.done:
+	default:
+		close(p.done)
+	}
+
+	for _, entry := range p.entries {
+		p.evictLocked(entry)
+	}
+	clear(p.resolved)
+	clear(p.breakers)
+	clear(p.breakerUsed)
+
+	return nil
+}
+
+// release drops a reference to the entry, closing it if it was evicted while in use
+func (p *Pool) release(entry *poolEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry.refs--
+	entry.lastUsed = time.Now()
+	if entry.evicted && entry.refs == 0 {
+		closeEntry(entry)
+	}
+}
+
+// evictLocked removes the entry from the pool, closing it once it is no longer in use.
+// The caller must hold p.mu.
+func (p *Pool) evictLocked(entry *poolEntry) {
+	if entry.evicted {
+		return
+	}
+	entry.evicted = true
+	if p.entries[entry.key] == entry {
+		delete(p.entries, entry.key)
+	}
+	if entry.refs == 0 {
+		closeEntry(entry)
+	}
+}
+
+// janitor periodically evicts backends that have been idle for too long, and
+// drops the circuit breakers and resolved references of backends that are
+// no longer in the pool
+func (p *Pool) janitor() {
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case now := <-ticker.C:
+			p.mu.Lock()
+			for _, entry := range p.entries {
+				if entry.refs == 0 && now.Sub(entry.lastUsed) > p.idleTimeout {
+					p.evictLocked(entry)
+				}
+			}
+			for key, used := range p.breakerUsed {
+				if _, ok := p.entries[key]; !ok && now.Sub(used) > p.idleTimeout {
+					delete(p.breakers, key)
+					delete(p.breakerUsed, key)
+				}
+			}
+			for key, resolved := range p.resolved {
+				if _, ok := p.breakers[resolved.key]; !ok {
+					delete(p.resolved, key)
+				}
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// closeEntry closes the entry's backend if it was successfully initialized
+func closeEntry(entry *poolEntry) {
+	if entry.backend != nil && entry.err == nil {
+		entry.backend.Close()
+	}
+}
+
+// initBackend creates and initializes a backend of the given type under the policy
+func initBackend(ctx context.Context, backendType string, backendConfig map[string]string, policy Policy, breaker *Breaker) (Backend, error) {
+	backend, err := NewBackend(backendType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create secret backend: %w", err)
+	}
+
+	err = callWithPolicy(ctx, policy, breaker, func(ctx context.Context) error {
+		return backend.Initialize(ctx, backendConfig)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize secret backend: %w", err)
+	}
+
+	return backend, nil
+}
+
+// optionFileTimes returns the modification times of the files named by the
+// path options of a backend, with the zero time for missing files, so that
+// backends reading a file are initialized again once it changes
+func optionFileTimes(backendType string, backendConfig map[string]string) map[string]time.Time {
+	options, _ := OptionsFor(backendType)
+
+	var times map[string]time.Time
+	for _, option := range options {
+		path := backendConfig[option.Name]
+		if !option.Path || path == "" {
+			continue
+		}
+		if times == nil {
+			times = make(map[string]time.Time)
+		}
+		if info, err := os.Stat(path); err == nil {
+			times[path] = info.ModTime()
+		} else {
+			times[path] = time.Time{}
+		}
+	}
+	return times
+}
+
+// poolKey builds the pool key for a config path and backend configuration
+func poolKey(configPath, source, backendType string, backendConfig map[string]string) string {
+	keys := make([]string, 0, len(backendConfig))
+	for key := range backendConfig {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00", source, backendType)
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%s\x00%s\x00", key, backendConfig[key])
+	}
+
+	return configPath + "#" + hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,222 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testPoolConfig writes a config and the .env file of its env_file backend,
+// and returns their paths
+func testPoolConfig(t *testing.T, env string) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, ".imbued")
+	envPath := filepath.Join(dir, "secrets.env")
+	if err := os.WriteFile(configPath, []byte(`backend_type = "env_file"`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(envPath, []byte(env), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return configPath, envPath
+}
+
+// acquire acquires the env_file backend of the config from the pool
+func acquire(t *testing.T, p *Pool, configPath, envPath string) (Backend, func()) {
+	t.Helper()
+	backend, release, err := p.Acquire(context.Background(), configPath, configPath, string(EnvFile), map[string]string{"file_path": envPath}, DefaultPolicy)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	return backend, release
+}
+
+// touch changes the modification time of a file, as a later write would
+func touch(t *testing.T, path string, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// countingBackend counts the calls to Close of the backend it wraps
+type countingBackend struct {
+	Backend
+	closes atomic.Int32
+}
+
+func (b *countingBackend) Close() error {
+	b.closes.Add(1)
+	return b.Backend.Close()
+}
+
+func TestPoolSharesInitialization(t *testing.T) {
+	p := NewPool(time.Minute)
+	defer p.Close()
+	configPath, envPath := testPoolConfig(t, "API_KEY=abc\n")
+
+	// Concurrent requests wait for the same initialization
+	const requests = 20
+	backends := make([]Backend, requests)
+	releases := make([]func(), requests)
+	errs := make([]error, requests)
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var backend Backend
+			backend, releases[i], errs[i] = p.Acquire(context.Background(), configPath, configPath, string(EnvFile), map[string]string{"file_path": envPath}, DefaultPolicy)
+			if errs[i] == nil {
+				backends[i] = backend.(*policyBackend).backend
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, backend := range backends {
+		if errs[i] != nil {
+			t.Fatalf("request %d: Acquire() error = %v", i, errs[i])
+		}
+		if backend != backends[0] {
+			t.Fatalf("request %d got another backend than request 0", i)
+		}
+	}
+	for _, release := range releases {
+		release()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.entries) != 1 {
+		t.Fatalf("pool holds %d entries, want 1", len(p.entries))
+	}
+	for _, entry := range p.entries {
+		if entry.refs != 0 {
+			t.Errorf("entry refs = %d after every release, want 0", entry.refs)
+		}
+	}
+}
+
+func TestPoolStaleness(t *testing.T) {
+	p := NewPool(time.Minute)
+	defer p.Close()
+	configPath, envPath := testPoolConfig(t, "API_KEY=one\n")
+
+	get := func() string {
+		t.Helper()
+		backend, release := acquire(t, p, configPath, envPath)
+		defer release()
+		value, err := backend.GetSecret(context.Background(), "API_KEY")
+		if err != nil {
+			t.Fatalf("GetSecret() error = %v", err)
+		}
+		return value
+	}
+
+	if got := get(); got != "one" {
+		t.Fatalf("GetSecret() = %q, want one", got)
+	}
+
+	// A change to the file the backend reads is picked up
+	touch(t, envPath, "API_KEY=two\n")
+	if got := get(); got != "two" {
+		t.Errorf("GetSecret() after the .env file changed = %q, want two", got)
+	}
+
+	// So is a change to the config, even if the file kept its modification time
+	info, err := os.Stat(envPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(envPath, []byte("API_KEY=three\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(envPath, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(); got != "two" {
+		t.Fatalf("GetSecret() of an unchanged config = %q, want two", got)
+	}
+	touch(t, configPath, `backend_type = "env_file"`)
+	if got := get(); got != "three" {
+		t.Errorf("GetSecret() after the config changed = %q, want three", got)
+	}
+}
+
+func TestPoolEvictWhileInUse(t *testing.T) {
+	p := NewPool(time.Minute)
+	defer p.Close()
+	configPath, envPath := testPoolConfig(t, "API_KEY=abc\n")
+
+	backend, release := acquire(t, p, configPath, envPath)
+
+	// Count the closes of the pooled backend
+	counting := &countingBackend{}
+	p.mu.Lock()
+	for _, entry := range p.entries {
+		counting.Backend = entry.backend
+		entry.backend = counting
+	}
+	p.mu.Unlock()
+
+	p.Invalidate(configPath)
+
+	// The backend stays usable until released
+	if value, err := backend.GetSecret(context.Background(), "API_KEY"); err != nil || value != "abc" {
+		t.Errorf("GetSecret() of an evicted backend in use = %q, %v, want abc", value, err)
+	}
+	if closes := counting.closes.Load(); closes != 0 {
+		t.Errorf("evicted backend in use closed %d times, want 0", closes)
+	}
+
+	release()
+	if closes := counting.closes.Load(); closes != 1 {
+		t.Errorf("evicted backend closed %d times after its release, want 1", closes)
+	}
+
+	// The next request initializes a new backend
+	next, release := acquire(t, p, configPath, envPath)
+	defer release()
+	if next.(*policyBackend).backend == counting.Backend {
+		t.Error("Acquire() after Invalidate() returned the evicted backend")
+	}
+}
+
+func TestPoolJanitor(t *testing.T) {
+	p := NewPool(20 * time.Millisecond)
+	defer p.Close()
+	configPath, envPath := testPoolConfig(t, "API_KEY=abc\n")
+
+	_, release := acquire(t, p, configPath, envPath)
+	release()
+
+	// Idle backends are closed, then their breakers and resolved references
+	// are dropped
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		p.mu.Lock()
+		remaining := len(p.entries) + len(p.breakers) + len(p.breakerUsed) + len(p.resolved)
+		p.mu.Unlock()
+		if remaining == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pool still holds %d entries, breakers or references", remaining)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if status := p.Status(configPath, configPath, string(EnvFile), map[string]string{"file_path": envPath}); status.State != BreakerClosed {
+		t.Errorf("Status() of a dropped backend = %v, want closed", status.State)
+	}
+}
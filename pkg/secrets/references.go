@@ -0,0 +1,94 @@
+package secrets
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// BackendCredentialsService is the keychain service holding backend
+	// credentials moved out of .imbued files
+	BackendCredentialsService = "com.novacove.imbued.backend"
+
+	// keychainReferencePrefix marks a backend option whose value is stored in
+	// the keychain, e.g. "keychain:vault.token"
+	keychainReferencePrefix = "keychain:"
+)
+
+// KeychainReference returns the backend option value referring to the
+// keychain item with the given name
+func KeychainReference(name string) string {
+	return keychainReferencePrefix + name
+}
+
+// ReferenceAccount returns the keychain account holding the value a config
+// file refers to by name, e.g. "/Users/me/src/app/.imbued:vault.token".
+// Accounts are scoped to the file, so that a config can't read the
+// credentials of another one by naming them.
+func ReferenceAccount(configPath, name string) (string, error) {
+	absPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	return absPath + ":" + name, nil
+}
+
+// referenceAccount returns the keychain account a reference of the config
+// at configPath refers to. References name their value, and files migrated
+// by older versions of imbued hold the account itself, which is only
+// accepted when it is scoped to the file.
+func referenceAccount(configPath, reference string) (string, error) {
+	account, err := ReferenceAccount(configPath, "")
+	if err != nil {
+		return "", err
+	}
+	if name, ok := strings.CutPrefix(reference, account); ok {
+		reference = name
+	}
+	if reference == "" || strings.Contains(reference, ":") {
+		return "", fmt.Errorf("reference %q doesn't name a value of %s", keychainReferencePrefix+reference, configPath)
+	}
+	return account + reference, nil
+}
+
+// IsReference reports whether a backend option value refers to a value
+// stored outside of the config
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, keychainReferencePrefix)
+}
+
+// ResolveReferences returns a copy of the backend options read from the
+// config at configPath, with references replaced by the values they refer to
+func ResolveReferences(options map[string]string, configPath string) (map[string]string, error) {
+	resolved := make(map[string]string, len(options))
+	for name, value := range options {
+		if reference, ok := strings.CutPrefix(value, keychainReferencePrefix); ok {
+			account, err := referenceAccount(configPath, reference)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve %s: %w", name, err)
+			}
+			item, err := GetKeychainItem(BackendCredentialsService, account)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve %s: %w", name, err)
+			}
+			value = item
+		}
+		resolved[name] = value
+	}
+	return resolved, nil
+}
+
+// StoreReference stores a backend credential of the config at configPath in
+// the keychain under the given name, and returns the reference to use in
+// its place
+func StoreReference(configPath, name, value string) (string, error) {
+	account, err := referenceAccount(configPath, name)
+	if err != nil {
+		return "", err
+	}
+	if err := StoreKeychainItem(BackendCredentialsService, account, value); err != nil {
+		return "", err
+	}
+	return KeychainReference(name), nil
+}
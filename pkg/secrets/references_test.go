@@ -0,0 +1,34 @@
+package secrets
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReferenceAccount(t *testing.T) {
+	const configPath = "/src/app/.imbued"
+
+	tests := []struct {
+		reference string
+		want      string
+		err       string
+	}{
+		{reference: "vault.token", want: "/src/app/.imbued:vault.token"},
+		{reference: "/src/app/.imbued:vault.token", want: "/src/app/.imbued:vault.token"},
+		{reference: "/src/other/.imbued:vault.token", err: "doesn't name a value of /src/app/.imbued"},
+		{reference: "", err: "doesn't name a value"},
+	}
+
+	for _, tt := range tests {
+		got, err := referenceAccount(configPath, tt.reference)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("referenceAccount(%q) = %q, %v, want error %q", tt.reference, got, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("referenceAccount(%q) = %q, %v, want %q", tt.reference, got, err, tt.want)
+		}
+	}
+}
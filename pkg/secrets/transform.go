@@ -0,0 +1,91 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// transforms maps the name of each supported transform to its implementation
+var transforms = map[string]func(string) (string, error){
+	"base64decode": func(value string) (string, error) {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		return string(decoded), err
+	},
+	"base64urldecode": func(value string) (string, error) {
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(strings.TrimSpace(value), "="))
+		return string(decoded), err
+	},
+	"base64encode": func(value string) (string, error) {
+		return base64.StdEncoding.EncodeToString([]byte(value)), nil
+	},
+	"hexdecode": func(value string) (string, error) {
+		decoded, err := hex.DecodeString(strings.TrimSpace(value))
+		return string(decoded), err
+	},
+	"trim": func(value string) (string, error) {
+		return strings.TrimSpace(value), nil
+	},
+	"lower": func(value string) (string, error) {
+		return strings.ToLower(value), nil
+	},
+	"upper": func(value string) (string, error) {
+		return strings.ToUpper(value), nil
+	},
+}
+
+// TransformNames returns the sorted names of the supported transforms
+func TransformNames() []string {
+	names := make([]string, 0, len(transforms))
+	for name := range transforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsTransform reports whether name is a supported transform
+func IsTransform(name string) bool {
+	_, ok := transforms[name]
+	return ok
+}
+
+// ApplyTransform applies the named transform to a secret value
+func ApplyTransform(name, value string) (string, error) {
+	transform, ok := transforms[name]
+	if !ok {
+		return "", fmt.Errorf("unknown transform: %s", name)
+	}
+
+	transformed, err := transform(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to apply %s: %w", name, err)
+	}
+
+	return transformed, nil
+}
+
+// ExtractJSONKey parses a secret value as a JSON object and returns the
+// value of the given key. String values are returned as is, anything else is
+// returned as JSON.
+func ExtractJSONKey(value, key string) (string, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(value), &object); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object: %w", err)
+	}
+
+	raw, ok := object[key]
+	if !ok {
+		return "", fmt.Errorf("JSON key %q not found in secret", key)
+	}
+
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return str, nil
+	}
+
+	return string(raw), nil
+}
@@ -1,6 +1,7 @@
 package secrets
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -11,8 +12,15 @@ type VaultBackend struct {
 	initialized bool
 }
 
+func init() {
+	RegisterBackendOptions(Vault,
+		BackendOption{Name: "address", Description: "Address of the Vault server", Required: true},
+		BackendOption{Name: "token", Description: "Token used to authenticate to Vault", Required: true, Credential: true},
+	)
+}
+
 // Initialize initializes the VaultBackend with the given configuration
-func (b *VaultBackend) Initialize(config map[string]string) error {
+func (b *VaultBackend) Initialize(ctx context.Context, config map[string]string) error {
 	address, ok := config["address"]
 	if !ok {
 		return fmt.Errorf("address is required for vault backend")
@@ -34,7 +42,7 @@ func (b *VaultBackend) Initialize(config map[string]string) error {
 }
 
 // GetSecret retrieves a secret by its key
-func (b *VaultBackend) GetSecret(key string) (string, error) {
+func (b *VaultBackend) GetSecret(ctx context.Context, key string) (string, error) {
 	if !b.initialized {
 		return "", fmt.Errorf("vault backend not initialized")
 	}
@@ -44,7 +52,7 @@ func (b *VaultBackend) GetSecret(key string) (string, error) {
 	return fmt.Sprintf("vault-secret-%s", key), nil
 }
 
-func (b *VaultBackend) StoreSecrets(secrets map[string]string) error {
+func (b *VaultBackend) StoreSecrets(ctx context.Context, secrets map[string]string) error {
 	if !b.initialized {
 		return fmt.Errorf("vault backend not initialized")
 	}
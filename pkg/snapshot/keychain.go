@@ -0,0 +1,40 @@
+package snapshot
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/novacove/imbued/pkg/secrets"
+)
+
+const (
+	// KeychainServiceName is the name of the keychain service for the snapshot key
+	KeychainServiceName = "com.novacove.imbued.snapshot"
+
+	// KeychainKeyAccount is the account of the snapshot key in the keychain
+	KeychainKeyAccount = "encryption_key"
+)
+
+// KeychainKeyProvider returns the snapshot key stored in the macOS Keychain,
+// generating and storing a new random key the first time it is needed
+func KeychainKeyProvider() ([]byte, error) {
+	encoded, err := secrets.GetKeychainItem(KeychainServiceName, KeychainKeyAccount)
+	if err == nil {
+		return hex.DecodeString(encoded)
+	} else if !errors.Is(err, secrets.ErrKeychainItemNotFound) {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate snapshot key: %w", err)
+	}
+
+	if err := secrets.StoreKeychainItem(KeychainServiceName, KeychainKeyAccount, hex.EncodeToString(key)); err != nil {
+		return nil, fmt.Errorf("failed to store snapshot key: %w", err)
+	}
+
+	return key, nil
+}
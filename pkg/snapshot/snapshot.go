@@ -0,0 +1,199 @@
+package snapshot
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// KeyProvider returns the 32-byte key used to encrypt snapshots
+type KeyProvider func() ([]byte, error)
+
+// Value is a secret value captured in a snapshot
+type Value struct {
+	Value     string    `json:"value"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// Store keeps an encrypted on-disk snapshot of the last successfully fetched
+// secret values of each config, so that they can be served when the backend
+// is unreachable. Each config gets its own file, named after a hash of the
+// config path. A Store is safe for concurrent use.
+type Store struct {
+	dir         string
+	keyProvider KeyProvider
+
+	mu  sync.Mutex
+	key []byte
+}
+
+// NewStore creates a new Store that keeps snapshots in dir
+func NewStore(dir string, keyProvider KeyProvider) *Store {
+	return &Store{
+		dir:         dir,
+		keyProvider: keyProvider,
+	}
+}
+
+// Save records the given values in the snapshot for the config, keeping
+// previously recorded values for secrets that weren't fetched this time
+func (s *Store) Save(configPath string, values map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot, err := s.readLocked(configPath)
+	if err != nil {
+		// An unreadable snapshot is replaced rather than blocking new ones
+		snapshot = make(map[string]Value)
+	}
+
+	now := time.Now()
+	for name, value := range values {
+		snapshot[name] = Value{Value: value, FetchedAt: now}
+	}
+
+	return s.writeLocked(configPath, snapshot)
+}
+
+// Load returns the snapshotted values of the given secrets that are no older
+// than maxStaleness. Secrets without a fresh enough value are omitted.
+func (s *Store) Load(configPath string, secretNames []string, maxStaleness time.Duration) (map[string]Value, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot, err := s.readLocked(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]Value)
+	for _, name := range secretNames {
+		value, ok := snapshot[name]
+		if !ok || time.Since(value.FetchedAt) > maxStaleness {
+			continue
+		}
+		values[name] = value
+	}
+
+	return values, nil
+}
+
+// Delete removes the snapshot for the config
+func (s *Store) Delete(configPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.path(configPath)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove snapshot: %w", err)
+	}
+	return nil
+}
+
+// path returns the snapshot file path for a config
+func (s *Store) path(configPath string) string {
+	sum := sha256.Sum256([]byte(configPath))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".snap")
+}
+
+// readLocked reads and decrypts the snapshot for a config. A missing
+// snapshot is returned as an empty map. The caller must hold s.mu.
+func (s *Store) readLocked(configPath string) (map[string]Value, error) {
+	data, err := os.ReadFile(s.path(configPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return make(map[string]Value), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	aead, err := s.aeadLocked()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("snapshot is truncated")
+	}
+
+	// The config path is bound as additional data so snapshots can't be swapped between projects
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(configPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt snapshot: %w", err)
+	}
+	defer clear(plaintext)
+
+	snapshot := make(map[string]Value)
+	if err := json.Unmarshal(plaintext, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// writeLocked encrypts and writes the snapshot for a config. The caller must hold s.mu.
+func (s *Store) writeLocked(configPath string, snapshot map[string]Value) error {
+	aead, err := s.aeadLocked()
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	defer clear(plaintext)
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	data := aead.Seal(nonce, nonce, plaintext, []byte(configPath))
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a partial snapshot
+	path := s.path(configPath)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// aeadLocked returns the cipher used to seal snapshots, fetching the key on
+// first use. The caller must hold s.mu.
+func (s *Store) aeadLocked() (cipher.AEAD, error) {
+	if s.key == nil {
+		key, err := s.keyProvider()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get snapshot key: %w", err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("snapshot key must be 32 bytes, got %d", len(key))
+		}
+		s.key = key
+	}
+
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
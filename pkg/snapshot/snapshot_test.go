@@ -0,0 +1,145 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// staticKey returns a key provider always returning key
+func staticKey(key []byte) KeyProvider {
+	return func() ([]byte, error) {
+		return key, nil
+	}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	s := NewStore(t.TempDir(), staticKey(bytes.Repeat([]byte{1}, 32)))
+
+	if err := s.Save("/app/.imbued", map[string]string{"DB_PASSWORD": "s3cr3t", "API_KEY": "key"}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	// Secrets not fetched again keep their snapshotted value
+	if err := s.Save("/app/.imbued", map[string]string{"API_KEY": "new key"}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	data, err := os.ReadFile(s.path("/app/.imbued"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("s3cr3t")) {
+		t.Error("snapshot holds a value in plain text")
+	}
+
+	values, err := s.Load("/app/.imbued", []string{"DB_PASSWORD", "API_KEY", "MISSING"}, time.Hour)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(values) != 2 || values["DB_PASSWORD"].Value != "s3cr3t" || values["API_KEY"].Value != "new key" {
+		t.Errorf("Load() = %v", values)
+	}
+
+	if values, err := s.Load("/app/.imbued", []string{"DB_PASSWORD"}, 0); err != nil || len(values) != 0 {
+		t.Errorf("Load() of stale values = %v, %v, want none", values, err)
+	}
+
+	if err := s.Delete("/app/.imbued"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if values, err := s.Load("/app/.imbued", []string{"DB_PASSWORD"}, time.Hour); err != nil || len(values) != 0 {
+		t.Errorf("Load() after Delete() = %v, %v, want none", values, err)
+	}
+}
+
+func TestStoreDecryptErrors(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+
+	tests := []struct {
+		name   string
+		key    []byte
+		tamper func(t *testing.T, s *Store)
+		err    string
+	}{
+		{
+			name: "snapshot of another config",
+			key:  key,
+			tamper: func(t *testing.T, s *Store) {
+				if err := os.Rename(s.path("/other/.imbued"), s.path("/app/.imbued")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			err: "failed to decrypt snapshot",
+		},
+		{
+			name: "other key",
+			key:  bytes.Repeat([]byte{2}, 32),
+			err:  "failed to decrypt snapshot",
+		},
+		{
+			name: "modified ciphertext",
+			key:  key,
+			tamper: func(t *testing.T, s *Store) {
+				data, err := os.ReadFile(s.path("/app/.imbued"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				data[len(data)-1] ^= 0xff
+				if err := os.WriteFile(s.path("/app/.imbued"), data, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			err: "failed to decrypt snapshot",
+		},
+		{
+			name: "truncated",
+			key:  key,
+			tamper: func(t *testing.T, s *Store) {
+				if err := os.WriteFile(s.path("/app/.imbued"), []byte("short"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			err: "snapshot is truncated",
+		},
+		{
+			name: "invalid key",
+			key:  bytes.Repeat([]byte{1}, 16),
+			err:  "snapshot key must be 32 bytes, got 16",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writer := NewStore(dir, staticKey(key))
+			for _, configPath := range []string{"/app/.imbued", "/other/.imbued"} {
+				if err := writer.Save(configPath, map[string]string{"DB_PASSWORD": configPath}); err != nil {
+					t.Fatalf("Save() error = %v", err)
+				}
+			}
+			if tt.tamper != nil {
+				tt.tamper(t, writer)
+			}
+
+			reader := NewStore(dir, staticKey(tt.key))
+			values, err := reader.Load("/app/.imbued", []string{"DB_PASSWORD"}, time.Hour)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Load() = %v, %v, want error %q", values, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestStoreKeyProviderError(t *testing.T) {
+	errLocked := errors.New("keychain is locked")
+	s := NewStore(t.TempDir(), func() ([]byte, error) {
+		return nil, errLocked
+	})
+
+	if err := s.Save("/app/.imbued", map[string]string{"DB_PASSWORD": "s3cr3t"}); !errors.Is(err, errLocked) {
+		t.Errorf("Save() error = %v, want %v", err, errLocked)
+	}
+}
@@ -23,6 +23,8 @@ const (
 	SecretAccess AccessType = "secret_access"
 	// SecretAccessFailure represents a failed secret access
 	SecretAccessFailure AccessType = "secret_access_failure"
+	// ProfileSelection represents a profile selected automatically by a profile rule
+	ProfileSelection AccessType = "profile_selection"
 )
 
 // AccessRecord represents a record of an access or authentication event
@@ -32,6 +34,9 @@ type AccessRecord struct {
 	ProcessID   string     `json:"process_id"`
 	SecretNames []string   `json:"secret_names,omitempty"`
 	Error       string     `json:"error,omitempty"`
+	ConfigPath  string     `json:"config_path,omitempty"`
+	Profile     string     `json:"profile,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
 }
 
 // Tracker defines the interface for tracking access and authentication events
@@ -46,6 +51,8 @@ type Tracker interface {
 	TrackSecretAccess(processID string, secretNames []string) error
 	// TrackSecretAccessFailure tracks a failed secret access
 	TrackSecretAccessFailure(processID string, secretNames []string, err error) error
+	// TrackProfileSelection tracks a profile selected automatically for a config
+	TrackProfileSelection(processID, configPath, profile, reason string) error
 	// Close closes the tracker
 	Close() error
 }
@@ -127,6 +134,18 @@ func (t *FileTracker) TrackSecretAccessFailure(processID string, secretNames []s
 	})
 }
 
+// TrackProfileSelection tracks a profile selected automatically for a config
+func (t *FileTracker) TrackProfileSelection(processID, configPath, profile, reason string) error {
+	return t.trackEvent(AccessRecord{
+		Timestamp:  time.Now(),
+		Type:       ProfileSelection,
+		ProcessID:  processID,
+		ConfigPath: configPath,
+		Profile:    profile,
+		Reason:     reason,
+	})
+}
+
 // trackEvent writes an event to the log file
 func (t *FileTracker) trackEvent(record AccessRecord) error {
 	t.mu.Lock()
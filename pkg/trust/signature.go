@@ -0,0 +1,165 @@
+package trust
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SignatureSuffix is appended to a config's path to name its detached signature
+const SignatureSuffix = ".sig"
+
+// ErrNotSigned is returned by Verify when a config has no signature
+var ErrNotSigned = errors.New("config is not signed")
+
+// TrustedKey is a team signing key whose signatures are trusted
+type TrustedKey struct {
+	Name      string // Comment identifying the key, e.g. the team or owner
+	PublicKey ed25519.PublicKey
+}
+
+// LoadTrustedKeys reads a trusted keys file. Each line holds a base64
+// encoded ed25519 public key optionally followed by a name; blank lines and
+// lines starting with # are ignored. A missing file holds no keys.
+func LoadTrustedKeys(path string) ([]TrustedKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trusted keys: %w", err)
+	}
+
+	var keys []TrustedKey
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		encoded, name, _ := strings.Cut(text, " ")
+		publicKey, err := DecodePublicKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted key on line %d: %w", line, err)
+		}
+		keys = append(keys, TrustedKey{Name: strings.TrimSpace(name), PublicKey: publicKey})
+	}
+
+	return keys, nil
+}
+
+// DecodePublicKey decodes a base64 encoded ed25519 public key
+func DecodePublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// GenerateSigningKey creates a new signing key, writes its seed to path and
+// returns the base64 encoded public key to share with the team
+func GenerateSigningKey(path string) (string, error) {
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("signing key %s already exists", path)
+	}
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	seed := base64.StdEncoding.EncodeToString(privateKey.Seed())
+	if err := os.WriteFile(path, []byte(seed+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write signing key: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(publicKey), nil
+}
+
+// LoadSigningKey reads a signing key written by GenerateSigningKey
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode signing key: %w", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key must be %d bytes, got %d", ed25519.SeedSize, len(seed))
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// signaturePrefix starts the data covered by a signature, so that
+// signatures of configs can't be mistaken for signatures of anything else
+const signaturePrefix = "imbued config signature v1\x00"
+
+// signedData returns the data a signature of a config covers: its path in
+// its project and its contents. A signed file copied elsewhere in the
+// project, or included under another name, doesn't verify.
+func signedData(projectPath string, data []byte) []byte {
+	return append([]byte(signaturePrefix+projectPath+"\x00"), data...)
+}
+
+// Sign writes a detached signature of the config next to it. projectPath is
+// the path of the config relative to the root of its project.
+func Sign(configPath, projectPath string, privateKey ed25519.PrivateKey) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, signedData(projectPath, data)))
+	if err := os.WriteFile(configPath+SignatureSuffix, []byte(signature+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write signature: %w", err)
+	}
+
+	return nil
+}
+
+// Verify checks the detached signature of a config, found at projectPath in
+// its project, against the trusted keys and returns the key that signed it.
+// It returns ErrNotSigned if the config has no signature.
+func Verify(configPath, projectPath string, keys []TrustedKey) (TrustedKey, error) {
+	encoded, err := os.ReadFile(configPath + SignatureSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return TrustedKey{}, ErrNotSigned
+	}
+	if err != nil {
+		return TrustedKey{}, fmt.Errorf("failed to read signature: %w", err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return TrustedKey{}, fmt.Errorf("failed to decode signature: %w", err)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return TrustedKey{}, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	signed := signedData(projectPath, data)
+	for _, key := range keys {
+		if ed25519.Verify(key.PublicKey, signed, signature) {
+			return key, nil
+		}
+	}
+
+	return TrustedKey{}, fmt.Errorf("signature doesn't match any trusted key for %s", projectPath)
+}
@@ -0,0 +1,132 @@
+package trust
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	newKey := func(name string) (TrustedKey, ed25519.PrivateKey) {
+		t.Helper()
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return TrustedKey{Name: name, PublicKey: publicKey}, privateKey
+	}
+	platform, platformKey := newKey("platform")
+	security, _ := newKey("security")
+	_, outsiderKey := newKey("outsider")
+
+	tests := []struct {
+		name        string
+		signer      ed25519.PrivateKey // Key signing the config, none if nil
+		signedPath  string             // Path in the project the config is signed at
+		projectPath string             // Path in the project the config is verified at
+		modify      func(configPath string) error
+		keys        []TrustedKey
+		want        string // Name of the key expected to verify the config
+		err         string
+	}{
+		{
+			name:        "trusted key",
+			signer:      platformKey,
+			signedPath:  "app/.imbued",
+			projectPath: "app/.imbued",
+			keys:        []TrustedKey{security, platform},
+			want:        "platform",
+		},
+		{
+			name:        "untrusted key",
+			signer:      outsiderKey,
+			signedPath:  "app/.imbued",
+			projectPath: "app/.imbued",
+			keys:        []TrustedKey{security, platform},
+			err:         "signature doesn't match any trusted key for app/.imbued",
+		},
+		{
+			name:        "no trusted keys",
+			signer:      platformKey,
+			signedPath:  "app/.imbued",
+			projectPath: "app/.imbued",
+			err:         "signature doesn't match any trusted key",
+		},
+		{
+			name:        "moved in the project",
+			signer:      platformKey,
+			signedPath:  "app/.imbued",
+			projectPath: "other/.imbued",
+			keys:        []TrustedKey{platform},
+			err:         "signature doesn't match any trusted key for other/.imbued",
+		},
+		{
+			name:        "modified config",
+			signer:      platformKey,
+			signedPath:  "app/.imbued",
+			projectPath: "app/.imbued",
+			modify: func(configPath string) error {
+				return os.WriteFile(configPath, []byte("secrets.TOKEN = { env = \"TOKEN\" }\n"), 0o644)
+			},
+			keys: []TrustedKey{platform},
+			err:  "signature doesn't match any trusted key",
+		},
+		{
+			name:        "corrupted signature",
+			signer:      platformKey,
+			signedPath:  "app/.imbued",
+			projectPath: "app/.imbued",
+			modify: func(configPath string) error {
+				return os.WriteFile(configPath+SignatureSuffix, []byte("not base64!\n"), 0o644)
+			},
+			keys: []TrustedKey{platform},
+			err:  "failed to decode signature",
+		},
+		{
+			name:        "not signed",
+			projectPath: "app/.imbued",
+			keys:        []TrustedKey{platform},
+			err:         ErrNotSigned.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), ".imbued")
+			if err := os.WriteFile(configPath, []byte("secrets.API_KEY = { env = \"API_KEY\" }\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.signer != nil {
+				if err := Sign(configPath, tt.signedPath, tt.signer); err != nil {
+					t.Fatalf("Sign() error = %v", err)
+				}
+			}
+			if tt.modify != nil {
+				if err := tt.modify(configPath); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			key, err := Verify(configPath, tt.projectPath, tt.keys)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Verify() = %q, %v, want error %q", key.Name, err, tt.err)
+				}
+				if tt.signer == nil && !errors.Is(err, ErrNotSigned) {
+					t.Errorf("Verify() error = %v, want %v", err, ErrNotSigned)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if key.Name != tt.want {
+				t.Errorf("Verify() key = %q, want %q", key.Name, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package trust
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Status is the trust status of a config
+type Status string
+
+const (
+	// StatusAllowed means the config was allowed and hasn't changed since
+	StatusAllowed Status = "allowed"
+	// StatusUnknown means the config was never allowed or denied
+	StatusUnknown Status = "unknown"
+	// StatusModified means the config was allowed but has changed since
+	StatusModified Status = "modified"
+	// StatusDenied means the config was explicitly denied
+	StatusDenied Status = "denied"
+)
+
+// Entry is the recorded decision for a config, or for a project
+type Entry struct {
+	Status    Status    `json:"status"`
+	Hash      string    `json:"hash,omitempty"`    // Content hash of the config when it was allowed
+	Project   bool      `json:"project,omitempty"` // Whether the entry is the root directory of a project
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Store records which configs the user allowed or denied, keyed by the
+// absolute path of the config. An allowed config stays trusted only as long
+// as the content hash of its files matches the one recorded when it was
+// allowed. The store also records the projects in which the user allowed a
+// config, keyed by the absolute path of their root directory. A Store is
+// safe for concurrent use.
+type Store struct {
+	path string
+
+	mu sync.Mutex
+}
+
+// NewStore creates a new Store kept in the file at path
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// Status returns the trust status of a config whose files currently hash to hash
+func (s *Store) Status(configPath, hash string) (Status, error) {
+	key, err := storeKey(configPath)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.readLocked()
+	if err != nil {
+		return "", err
+	}
+
+	entry, ok := entries[key]
+	switch {
+	case !ok:
+		return StatusUnknown, nil
+	case entry.Status == StatusDenied:
+		return StatusDenied, nil
+	case entry.Hash != hash:
+		return StatusModified, nil
+	default:
+		return StatusAllowed, nil
+	}
+}
+
+// Allow trusts a config as long as its files hash to hash
+func (s *Store) Allow(configPath, hash string) error {
+	return s.set(configPath, Entry{Status: StatusAllowed, Hash: hash, UpdatedAt: time.Now()})
+}
+
+// Deny distrusts a config until it is allowed again
+func (s *Store) Deny(configPath string) error {
+	return s.set(configPath, Entry{Status: StatusDenied, UpdatedAt: time.Now()})
+}
+
+// AllowProject records that the user trusts the project rooted at root,
+// which allowing one of its configs does
+func (s *Store) AllowProject(root string) error {
+	return s.set(root, Entry{Status: StatusAllowed, Project: true, UpdatedAt: time.Now()})
+}
+
+// ProjectAllowed reports whether the project rooted at root was allowed
+func (s *Store) ProjectAllowed(root string) (bool, error) {
+	key, err := storeKey(root)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.readLocked()
+	if err != nil {
+		return false, err
+	}
+
+	entry := entries[key]
+	return entry.Project && entry.Status == StatusAllowed, nil
+}
+
+// set records the entry of a config or project
+func (s *Store) set(configPath string, entry Entry) error {
+	key, err := storeKey(configPath)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.readLocked()
+	if err != nil {
+		return err
+	}
+	entries[key] = entry
+
+	return s.writeLocked(entries)
+}
+
+// readLocked reads the recorded entries. The caller must hold s.mu.
+func (s *Store) readLocked() (map[string]Entry, error) {
+	entries := make(map[string]Entry)
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trust store: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse trust store: %w", err)
+	}
+
+	return entries, nil
+}
+
+// writeLocked writes the entries to the store's file. The caller must hold s.mu.
+func (s *Store) writeLocked(entries map[string]Entry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal trust store: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create trust store directory: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a partial store
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write trust store: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write trust store: %w", err)
+	}
+
+	return nil
+}
+
+// storeKey returns the key a config or project is recorded under: its
+// absolute path with symlinks resolved
+func storeKey(configPath string) (string, error) {
+	absPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	if resolved, err := filepath.EvalSymlinks(absPath); err == nil {
+		return resolved, nil
+	}
+	return absPath, nil
+}
+
+// HashFiles returns the content hash of a config made of the given files,
+// covering both their paths and their contents
+func HashFiles(paths []string) (string, error) {
+	hash := sha256.New()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		absPath, err := storeKey(path)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(hash, "%s\x00%d\x00", absPath, len(data))
+		hash.Write(data)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
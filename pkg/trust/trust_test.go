@@ -0,0 +1,142 @@
+package trust
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".imbued":      "secrets.A = {}\n",
+		"copy.imbued":  "secrets.A = {}\n",
+		"base.imbued":  "secrets.B = {}\n",
+		"split.imbued": "secrets.A = {}\nsecrets.B = {}\n",
+		"empty.imbued": "",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, ".imbued"), filepath.Join(dir, "link.imbued")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		a, b  []string
+		equal bool
+	}{
+		{"same files", []string{".imbued", "base.imbued"}, []string{".imbued", "base.imbued"}, true},
+		{"symlink to the same file", []string{".imbued"}, []string{"link.imbued"}, true},
+		{"same content at another path", []string{".imbued"}, []string{"copy.imbued"}, false},
+		{"other order", []string{".imbued", "base.imbued"}, []string{"base.imbued", ".imbued"}, false},
+		{"added file", []string{".imbued"}, []string{".imbued", "empty.imbued"}, false},
+		{"content moved between files", []string{".imbued", "base.imbued"}, []string{"split.imbued", "empty.imbued"}, false},
+	}
+
+	hash := func(names []string) string {
+		t.Helper()
+		var paths []string
+		for _, name := range names {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+		h, err := HashFiles(paths)
+		if err != nil {
+			t.Fatalf("HashFiles(%q) error = %v", names, err)
+		}
+		return h
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if equal := hash(tt.a) == hash(tt.b); equal != tt.equal {
+				t.Errorf("HashFiles(%q) == HashFiles(%q) is %v, want %v", tt.a, tt.b, equal, tt.equal)
+			}
+		})
+	}
+
+	t.Run("modified file", func(t *testing.T) {
+		before := hash([]string{"base.imbued"})
+		if err := os.WriteFile(filepath.Join(dir, "base.imbued"), []byte("secrets.C = {}\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if hash([]string{"base.imbued"}) == before {
+			t.Error("HashFiles() didn't change with the file's content")
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := HashFiles([]string{filepath.Join(dir, "missing.imbued")}); err == nil {
+			t.Error("HashFiles() of a missing file succeeded")
+		}
+	})
+}
+
+func TestStoreStatus(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(filepath.Join(dir, "state", "trust.json"))
+	configPath := filepath.Join(dir, ".imbued")
+
+	steps := []struct {
+		name   string
+		op     func() error
+		hash   string
+		status Status
+	}{
+		{name: "never allowed", hash: "h1", status: StatusUnknown},
+		{name: "allowed", op: func() error { return store.Allow(configPath, "h1") }, hash: "h1", status: StatusAllowed},
+		{name: "modified", hash: "h2", status: StatusModified},
+		{name: "denied", op: func() error { return store.Deny(configPath) }, hash: "h1", status: StatusDenied},
+		{name: "allowed again", op: func() error { return store.Allow(configPath, "h2") }, hash: "h2", status: StatusAllowed},
+	}
+
+	for _, step := range steps {
+		if step.op != nil {
+			if err := step.op(); err != nil {
+				t.Fatalf("%s: error = %v", step.name, err)
+			}
+		}
+		status, err := store.Status(configPath, step.hash)
+		if err != nil || status != step.status {
+			t.Errorf("%s: Status() = %s, %v, want %s", step.name, status, err, step.status)
+		}
+	}
+
+	// Another store reading the same file sees the recorded entries
+	if status, err := NewStore(store.path).Status(configPath, "h2"); err != nil || status != StatusAllowed {
+		t.Errorf("Status() from another store = %s, %v, want %s", status, err, StatusAllowed)
+	}
+}
+
+func TestStoreProject(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(filepath.Join(dir, "trust.json"))
+	project := filepath.Join(dir, "project")
+	configPath := filepath.Join(project, ".imbued")
+
+	if allowed, err := store.ProjectAllowed(project); err != nil || allowed {
+		t.Errorf("ProjectAllowed() of a new project = %v, %v, want false", allowed, err)
+	}
+
+	if err := store.AllowProject(project); err != nil {
+		t.Fatal(err)
+	}
+	if allowed, err := store.ProjectAllowed(project); err != nil || !allowed {
+		t.Errorf("ProjectAllowed() = %v, %v, want true", allowed, err)
+	}
+
+	// Allowing the project doesn't allow its configs, nor do configs count
+	// as projects
+	if status, err := store.Status(configPath, "h1"); err != nil || status != StatusUnknown {
+		t.Errorf("Status() of a config of an allowed project = %s, %v, want %s", status, err, StatusUnknown)
+	}
+	if err := store.Allow(configPath, "h1"); err != nil {
+		t.Fatal(err)
+	}
+	if allowed, err := store.ProjectAllowed(configPath); err != nil || allowed {
+		t.Errorf("ProjectAllowed() of an allowed config = %v, %v, want false", allowed, err)
+	}
+}
@@ -28,12 +28,16 @@ fi
 # Socket path for the imbued server
 IMBUED_SOCKET="${IMBUED_SOCKET:-$HOME/.imbued/imbued.sock}"
 
-# Maximum number of directory levels to search up for .imbued file
-IMBUED_MAX_LEVELS="${IMBUED_MAX_LEVELS:-3}"
+# Maximum number of directory levels to search up for .imbued file, when set.
+# Otherwise client.max_levels of the global config applies.
+IMBUED_MAX_LEVELS="${IMBUED_MAX_LEVELS:-}"
 
 # Current .imbued file path
 IMBUED_CURRENT_CONFIG=""
 
+# Values of the current .imbued file available in the current directory
+IMBUED_CURRENT_SCOPE=""
+
 # Function to clean environment variables set by imbued
 imbued_clean_env() {
     if [ -n "$IMBUED_CURRENT_CONFIG" ]; then
@@ -50,6 +54,7 @@ imbued_clean_env() {
         
         # Clear the current config
         IMBUED_CURRENT_CONFIG=""
+        IMBUED_CURRENT_SCOPE=""
         
         # Notify the user
         echo "Imbued: Cleaned environment variables"
@@ -59,18 +64,40 @@ imbued_clean_env() {
 # Function to set environment variables from imbued
 imbued_set_env() {
     local config_path="$1"
+    local inject_flags=()
+    
+    # Only allowed configs are injected
+    local trust_notice
+    if ! trust_notice=$("$IMBUED_BIN" client check-trust --socket "$IMBUED_SOCKET" --config "$config_path" 2>&1); then
+        echo "Imbued: $trust_notice"
+        return 1
+    fi
+    
+    # Only configs within their valid_depth of this directory are injected
+    local depth_scope depth_status
+    depth_scope=$("$IMBUED_BIN" client check-depth --socket "$IMBUED_SOCKET" --config "$config_path" 2>&1)
+    depth_status=$?
+    if [ $depth_status -eq 3 ]; then
+        # Too deep below the config, none of its values are set here
+        echo "Imbued: Not setting variables, $depth_scope"
+        return 0
+    elif [ $depth_status -ne 0 ]; then
+        echo "Imbued: $depth_scope"
+        return 1
+    fi
     
     # Check if we need to authenticate
     if ! "$IMBUED_BIN" client check-auth --socket "$IMBUED_SOCKET" --config "$config_path"  &> /dev/null; then
         echo "Imbued: Authentication required"
         if ! "$IMBUED_BIN" client auth --socket "$IMBUED_SOCKET" --config "$config_path"; then
-            echo "Imbued: Authentication failed"
-            return 1
+            # Plain values don't require authentication
+            echo "Imbued: Authentication failed, only setting plain values"
+            inject_flags=(--plain-only)
         fi
     fi
     
     # Get the list of environment variables to set
-    local env_vars=$("$IMBUED_BIN" client inject-env --socket "$IMBUED_SOCKET" --config "$config_path")
+    local env_vars=$("$IMBUED_BIN" client inject-env --socket "$IMBUED_SOCKET" --config "$config_path" "${inject_flags[@]}")
 
     echo "Imbued: Setting environment variables from $config_path"
     echo "$env_vars"
@@ -103,6 +130,7 @@ imbued_set_env() {
     
     # Set the current config
     IMBUED_CURRENT_CONFIG="$config_path"
+    IMBUED_CURRENT_SCOPE="$depth_scope"
     
     # Notify the user
     echo "Imbued: Set environment variables"
@@ -111,7 +139,12 @@ imbued_set_env() {
 # Function to check for .imbued file and set environment variables
 imbued_check() {
     # Find .imbued file
-    local config_path=$("$IMBUED_BIN" client show-config --socket "$IMBUED_SOCKET" --max-levels "$IMBUED_MAX_LEVELS" 2>/dev/null| grep "Config file:" | cut -d' ' -f3-)
+    local max_levels=()
+    if [ -n "$IMBUED_MAX_LEVELS" ]; then
+        max_levels=(--max-levels "$IMBUED_MAX_LEVELS")
+    fi
+    local config_path
+    config_path=$("$IMBUED_BIN" client find-config --socket "$IMBUED_SOCKET" "${max_levels[@]}" 2>/dev/null) || config_path=""
     
     # If no .imbued file found, clean environment variables
     if [ -z "$config_path" ]; then
@@ -120,10 +153,20 @@ imbued_check() {
         return
     fi
     
-    # If the .imbued file is the same as the current one, do nothing
+    # If the .imbued file is the same as the current one, do nothing unless
+    # moving changed which of its values are available here
     if [ "$config_path" = "$IMBUED_CURRENT_CONFIG" ]; then
-        echo "Imbued: Already using the current .imbued file"
-        return
+        local depth_scope
+        depth_scope=$("$IMBUED_BIN" client check-depth --socket "$IMBUED_SOCKET" --config "$config_path" 2>/dev/null)
+        if [ $? -eq 3 ]; then
+            # Moved deeper than the config's valid_depth: drop its values
+            imbued_clean_env
+            return
+        fi
+        if [ "$depth_scope" = "$IMBUED_CURRENT_SCOPE" ]; then
+            echo "Imbued: Already using the current .imbued file"
+            return
+        fi
     fi
     
     # Clean environment variables from previous .imbued file
@@ -135,6 +178,23 @@ imbued_check() {
     imbued_set_env "$config_path"
 }
 
+# Function to switch the profile of the current .imbued file, e.g. `imbued_use staging`
+imbued_use() {
+    local config_path="$IMBUED_CURRENT_CONFIG"
+
+    # Clean the variables of the old profile before switching
+    imbued_clean_env
+
+    if [ -n "$config_path" ]; then
+        "$IMBUED_BIN" client use --socket "$IMBUED_SOCKET" --config "$config_path" "$@"
+    else
+        "$IMBUED_BIN" client use --socket "$IMBUED_SOCKET" "$@"
+    fi
+
+    # Re-inject with the new profile
+    imbued_check
+}
+
 # Function to run when changing directory
 imbued_cd() {
     # Call the original cd command
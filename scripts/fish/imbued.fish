@@ -25,16 +25,20 @@ else
     set -g _imbued_socket $HOME/.imbued/imbued.sock
 end
 
-# Maximum number of directory levels to search up for .imbued file
+# Maximum number of directory levels to search up for .imbued file, when set.
+# Otherwise client.max_levels of the global config applies.
 if set -q IMBUED_MAX_LEVELS
-    set -g _imbued_max_levels $IMBUED_MAX_LEVELS
+    set -g _imbued_max_levels --max-levels $IMBUED_MAX_LEVELS
 else
-    set -g _imbued_max_levels 3
+    set -g _imbued_max_levels
 end
 
 # Current .imbued file path
 set -g _imbued_current_config ""
 
+# Values of the current .imbued file available in the current directory
+set -g _imbued_current_scope ""
+
 # Function to clean environment variables set by imbued
 function _imbued_clean_env
     if test -n "$_imbued_current_config"
@@ -51,6 +55,7 @@ function _imbued_clean_env
         
         # Clear the current config
         set -g _imbued_current_config ""
+        set -g _imbued_current_scope ""
         
         # Notify the user
         echo "Imbued: Cleaned environment variables"
@@ -60,18 +65,39 @@ end
 # Function to set environment variables from imbued
 function _imbued_set_env
     set -l config_path $argv[1]
+    set -l inject_flags
+    
+    # Only allowed configs are injected
+    set -l trust_notice (eval "$_imbued_bin client check-trust --socket $_imbued_socket --config $config_path" 2>&1)
+    if test $status -ne 0
+        echo "Imbued: $trust_notice"
+        return 1
+    end
+    
+    # Only configs within their valid_depth of this directory are injected
+    set -l depth_scope (eval "$_imbued_bin client check-depth --socket $_imbued_socket --config $config_path" 2>&1)
+    set -l depth_status $status
+    if test $depth_status -eq 3
+        # Too deep below the config, none of its values are set here
+        echo "Imbued: Not setting variables, $depth_scope"
+        return 0
+    else if test $depth_status -ne 0
+        echo "Imbued: $depth_scope"
+        return 1
+    end
     
     # Check if we need to authenticate
     if not eval "$_imbued_bin --client --socket $_imbued_socket --config $config_path --check-auth" > /dev/null 2>&1
         echo "Imbued: Authentication required"
         if not eval "$_imbued_bin --client --socket $_imbued_socket --config $config_path --authenticate"
-            echo "Imbued: Authentication failed"
-            return 1
+            # Plain values don't require authentication
+            echo "Imbued: Authentication failed, only setting plain values"
+            set inject_flags --plain-only
         end
     end
     
     # Get the list of environment variables to set
-    set -l env_vars (eval "$_imbued_bin --client --socket $_imbued_socket --config $config_path --inject-env")
+    set -l env_vars (eval "$_imbued_bin --client --socket $_imbued_socket --config $config_path --inject-env $inject_flags")
     
     # Set each environment variable
     for line in $env_vars
@@ -85,6 +111,7 @@ function _imbued_set_env
     
     # Set the current config
     set -g _imbued_current_config $config_path
+    set -g _imbued_current_scope "$depth_scope"
     
     # Notify the user
     echo "Imbued: Set environment variables"
@@ -93,7 +120,8 @@ end
 # Function to check for .imbued file and set environment variables
 function _imbued_check
     # Find .imbued file
-    set -l config_path (eval "$_imbued_bin --client --socket $_imbued_socket --max-levels $_imbued_max_levels --show-config 2>/dev/null | grep 'Config file:' | cut -d' ' -f3-")
+    set -l config_path (eval "$_imbued_bin client find-config --socket $_imbued_socket $_imbued_max_levels" 2>/dev/null)
+    or set config_path ""
     
     # If no .imbued file found, clean environment variables
     if test -z "$config_path"
@@ -101,9 +129,18 @@ function _imbued_check
         return
     end
     
-    # If the .imbued file is the same as the current one, do nothing
+    # If the .imbued file is the same as the current one, do nothing unless
+    # moving changed which of its values are available here
     if test "$config_path" = "$_imbued_current_config"
-        return
+        set -l depth_scope (eval "$_imbued_bin client check-depth --socket $_imbued_socket --config $config_path" 2>/dev/null)
+        if test $status -eq 3
+            # Moved deeper than the config's valid_depth: drop its values
+            _imbued_clean_env
+            return
+        end
+        if test "$depth_scope" = "$_imbued_current_scope"
+            return
+        end
     end
     
     # Clean environment variables from previous .imbued file
@@ -113,6 +150,23 @@ function _imbued_check
     _imbued_set_env $config_path
 end
 
+# Function to switch the profile of the current .imbued file, e.g. `imbued_use staging`
+function imbued_use
+    set -l config_path $_imbued_current_config
+
+    # Clean the variables of the old profile before switching
+    _imbued_clean_env
+
+    if test -n "$config_path"
+        eval "$_imbued_bin client use --socket $_imbued_socket --config $config_path $argv"
+    else
+        eval "$_imbued_bin client use --socket $_imbued_socket $argv"
+    end
+
+    # Re-inject with the new profile
+    _imbued_check
+end
+
 # Function to run when changing directory
 function _imbued_cd
     # Call the original cd function